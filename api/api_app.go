@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"crypto"
+	"net/http"
 	"time"
 
 	"github.com/golang/glog"
@@ -18,6 +20,211 @@ func (server *Server) getAppCert(c echo.Context) error {
 	return JSONResult(c, app.Cert)
 }
 
+// checkAppCertPerm app itself or with app perm of name
+func (server *Server) checkAppCertPerm(c echo.Context, name string) (bool, error) {
+	if app := server.app(c); app != nil && app.Name == name {
+		return true, nil
+	}
+	return server.checkPerm(c, apps.PermTypeApp, true, name)
+}
+
+type renewCertResult struct {
+	Cert       string `json:"cert"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+func (server *Server) renewAppCert(c echo.Context) error {
+	name := c.ParamValues()[0]
+	if ok, err := server.checkAppCertPerm(c, name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, name)
+	}
+	days, ok, err := IntFormParamD(c, "days", 365)
+	if !ok {
+		return err
+	}
+	if days <= 0 {
+		return JSONErrorf(c, utils.EcodeInvalidParam, "invalid days: %d", days)
+	}
+	keyBits, ok, err := IntFormParamD(c, "key_bits", 2048)
+	if !ok {
+		return err
+	}
+
+	app, err := server.apps.GetAppByName(name)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if app == nil {
+		return JSONErrorf(c, utils.EcodeNotFound, "no such app: %s", name)
+	}
+	if csrPem := c.FormValue("csr"); csrPem != "" {
+		csr, err := utils.DecodeCSRFromPem(csrPem)
+		if err != nil {
+			return JSONErrorf(c, utils.EcodeInvalidParam, "invalid csr: %v", err)
+		}
+		if err := server.apps.RenewCertWithCSR(app, csr, nil, nil, int(days)); err != nil {
+			return JSONError(c, err)
+		}
+		return JSONResult(c, renewCertResult{Cert: app.Cert})
+	}
+	var privKey crypto.Signer
+	newKey := c.FormValue("new_key") == "true"
+	if newKey {
+		if privKey, err = utils.NewPrivateKey("", int(keyBits)); err != nil {
+			glog.Errorf("generate private key fail: %v", err)
+			return JSONErrorf(c, utils.EcodeInvalidParam, "create private key fail: %v", err)
+		}
+	}
+	if _, err := server.apps.RenewCert(app, privKey, nil, nil, int(days)); err != nil {
+		return JSONError(c, err)
+	}
+	result := renewCertResult{Cert: app.Cert}
+	if newKey {
+		if result.PrivateKey, err = utils.EncodePrivateKeyToPem(privKey); err != nil {
+			glog.Errorf("encode private key to pem fail: %v", err)
+			return JSONErrorf(c, utils.EcodeSystemError, "encode private key fail")
+		}
+	}
+	return JSONResult(c, result)
+}
+
+// getAppKey get decrypted server-held private key of app
+func (server *Server) getAppKey(c echo.Context) error {
+	name := c.ParamValues()[0]
+	if ok, err := server.checkAppCertPerm(c, name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, name)
+	}
+	app, err := server.apps.GetAppByName(name)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if app == nil {
+		return JSONErrorf(c, utils.EcodeNotFound, "no such app: %s", name)
+	}
+	keyPem, err := server.apps.PrivateKey(app)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if keyPem == "" {
+		return JSONErrorf(c, utils.EcodeNotFound, "app(%s) has no server-held private key", name)
+	}
+	return JSONResult(c, keyPem)
+}
+
+var keyStoreContentTypes = map[string]string{
+	apps.KeyStorePKCS12: "application/x-pkcs12",
+	apps.KeyStoreJKS:    "application/x-java-keystore",
+}
+
+// getAppKeyStore download server-held key & cert chain of app as pkcs12 or jks
+func (server *Server) getAppKeyStore(c echo.Context) error {
+	name := c.ParamValues()[0]
+	if ok, err := server.checkAppCertPerm(c, name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, name)
+	}
+	format := c.FormValue("format")
+	if format == "" {
+		format = apps.KeyStorePKCS12
+	}
+	contentType, ok := keyStoreContentTypes[format]
+	if !ok {
+		return JSONErrorf(c, utils.EcodeInvalidParam, "invalid format: %s", format)
+	}
+	password := c.FormValue("password")
+	if password == "" {
+		return JSONErrorf(c, utils.EcodeInvalidParam, "missing password")
+	}
+	app, err := server.apps.GetAppByName(name)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if app == nil {
+		return JSONErrorf(c, utils.EcodeNotFound, "no such app: %s", name)
+	}
+	data, err := server.apps.KeyStore(app, format, password)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return c.Blob(http.StatusOK, contentType, data)
+}
+
+func (server *Server) listAppCerts(c echo.Context) error {
+	name := c.ParamValues()[0]
+	if ok, err := server.checkAppCertPerm(c, name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, name)
+	}
+	app, err := server.apps.GetAppByName(name)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if app == nil {
+		return JSONErrorf(c, utils.EcodeNotFound, "no such app: %s", name)
+	}
+	certs, err := server.apps.ListAppCerts(app.ID)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, certs)
+}
+
+func (server *Server) revokeAppCert(c echo.Context) error {
+	name, serial := c.ParamValues()[0], c.ParamValues()[1]
+	if ok, err := server.checkAppCertPerm(c, name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, name)
+	}
+	app, err := server.apps.GetAppByName(name)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if app == nil {
+		return JSONErrorf(c, utils.EcodeNotFound, "no such app: %s", name)
+	}
+	if err := server.apps.RevokeCert(context.Background(), app, serial, c.FormValue("reason")); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
+
+// getCRL get crl signed by root, der encoded or pem if format=pem
+func (server *Server) getCRL(c echo.Context) error {
+	crl, err := server.apps.CRL()
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if c.QueryParam("format") == "pem" {
+		return c.Blob(http.StatusOK, "application/x-pem-file", []byte(utils.EncodeToPem("X509 CRL", crl)))
+	}
+	return c.Blob(http.StatusOK, "application/pkix-crl", crl)
+}
+
+// listExpiringCerts list ca & app certs expiring within days
+func (server *Server) listExpiringCerts(c echo.Context) error {
+	if ok, err := server.checkPerm(c, apps.PermTypeApp, false, ""); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, "app perm")
+	}
+	days, ok, err := IntQueryParamD(c, "days", 30)
+	if !ok {
+		return err
+	}
+	certs, err := server.apps.ListExpiringCerts(int(days))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, certs)
+}
+
 type listAppResult struct {
 	Apps  []apps.App `json:"apps"`
 	Skip  int        `json:"skip"`
@@ -51,8 +258,10 @@ func (server *Server) listApp(c echo.Context) error {
 type newAppRequest struct {
 	Name        string `json:"name" form:"name"`
 	Description string `json:"description" form:"description"`
+	Env         string `json:"env" form:"env"`
 	KeyBits     int    `json:"key_bits" form:"key_bits"`
 	Days        int    `json:"days" form:"days"`
+	CSR         string `json:"csr" form:"csr"`
 }
 
 func (server *Server) newApp(c echo.Context) error {
@@ -67,15 +276,28 @@ func (server *Server) newApp(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return err
 	}
+	app := apps.App{
+		Status:      utils.StatusOk,
+		Name:        req.Name,
+		Description: req.Description,
+		Env:         req.Env}
+	if req.CSR != "" {
+		csr, err := utils.DecodeCSRFromPem(req.CSR)
+		if err != nil {
+			return JSONErrorf(c, utils.EcodeInvalidParam, "invalid csr: %v", err)
+		}
+		if err := server.apps.NewAppWithCSR(&app, csr, nil, nil, req.Days); err != nil {
+			glog.Errorf("create app fail: %v", err)
+			return JSONError(c, err)
+		}
+		return JSONResult(c, app)
+	}
+
 	privKey, err := utils.NewPrivateKey("", req.KeyBits)
 	if err != nil {
 		glog.Errorf("generate private key fail: %v", err)
 		return JSONErrorf(c, "SYSTEM_BUSY", "create private key fail")
 	}
-	app := apps.App{
-		Status:      utils.StatusOk,
-		Name:        req.Name,
-		Description: req.Description}
 	_, err = server.apps.NewApp(&app, privKey, nil, nil, req.Days)
 	if err != nil {
 		glog.Errorf("create app fail: %v", err)
@@ -126,3 +348,45 @@ func (server *Server) isAppNodeOnline(c echo.Context) error {
 	}
 	return JSONResult(c, online)
 }
+
+// getManagedApp get app of name param with app perm(write), nil if failed
+func (server *Server) getManagedApp(c echo.Context) (*apps.App, error) {
+	name := c.ParamValues()[0]
+	if ok, err := server.checkPerm(c, apps.PermTypeApp, true, name); err != nil {
+		return nil, JSONError(c, err)
+	} else if !ok {
+		return nil, server.newNotPermittedResp(c, name)
+	}
+	app, err := server.apps.GetAppByName(name)
+	if err != nil {
+		return nil, JSONError(c, err)
+	}
+	if app == nil {
+		return nil, JSONErrorf(c, utils.EcodeNotFound, "no such app: %s", name)
+	}
+	return app, nil
+}
+
+// disableApp disable app, optionally revoke leases & unplug its app nodes
+func (server *Server) disableApp(c echo.Context) error {
+	app, err := server.getManagedApp(c)
+	if app == nil {
+		return err
+	}
+	if err := server.apps.DisableApp(context.Background(), app,
+		c.FormValue("revoke_leases") == "true", c.FormValue("unplug_nodes") == "true"); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
+
+func (server *Server) enableApp(c echo.Context) error {
+	app, err := server.getManagedApp(c)
+	if app == nil {
+		return err
+	}
+	if err := server.apps.EnableApp(app); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
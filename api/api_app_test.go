@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/infrmods/xbus/apps"
+)
+
+func TestCheckAppCertPerm(t *testing.T) {
+	db, mock := newMockDB(t)
+	server := newTestServer(t, db, mock)
+	foo := &apps.App{ID: 1, Name: "foo"}
+
+	// app itself
+	c, _ := newTestContext(server, http.MethodPost, nil, foo)
+	if ok, err := server.checkAppCertPerm(c, "foo"); err != nil || !ok {
+		t.Errorf("expect permitted, got %v, %v", ok, err)
+	}
+
+	// anonymous
+	c, _ = newTestContext(server, http.MethodPost, nil, nil)
+	if ok, err := server.checkAppCertPerm(c, "foo"); err != nil || ok {
+		t.Errorf("expect not permitted, got %v, %v", ok, err)
+	}
+
+	// others need writable app perm
+	c, _ = newTestContext(server, http.MethodPost, nil, foo)
+	expectAppPerms(mock, apps.PermTypeApp, 1, apps.Perm{ID: 1, Content: "bar"})
+	if ok, err := server.checkAppCertPerm(c, "bar"); err != nil || ok {
+		t.Errorf("expect not permitted, got %v, %v", ok, err)
+	}
+	expectAppPerms(mock, apps.PermTypeApp, 1, apps.Perm{ID: 1, CanWrite: true, Content: "bar"})
+	if ok, err := server.checkAppCertPerm(c, "bar"); err != nil || !ok {
+		t.Errorf("expect permitted, got %v, %v", ok, err)
+	}
+	expectAppPerms(mock, apps.PermTypeApp, 1, apps.Perm{ID: 1, CanWrite: true, Content: "bar"},
+		apps.Perm{ID: 2, Deny: true, Content: "bar"})
+	if ok, err := server.checkAppCertPerm(c, "bar"); err != nil || ok {
+		t.Errorf("expect denied, got %v, %v", ok, err)
+	}
+	checkMockDB(t, mock)
+}
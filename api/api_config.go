@@ -19,11 +19,18 @@ type listResult struct {
 }
 
 func (server *Server) listConfig(c echo.Context) error {
+	if c.QueryParam("watch") == "true" {
+		return server.watchConfigs(c)
+	}
 	if c.QueryParam("keys") != "" {
 		return server.getAllConfigs(c)
 	}
+	if c.QueryParam("range") == "true" {
+		return server.rangeConfigs(c)
+	}
 
 	tag := c.QueryParam("tag")
+	env := c.QueryParam("env")
 	prefix := c.QueryParam("prefix")
 	skip, ok, err := IntQueryParamD(c, "skip", 0)
 	if !ok {
@@ -34,7 +41,7 @@ func (server *Server) listConfig(c echo.Context) error {
 		return err
 	}
 
-	total, configs, err := server.configs.ListDBConfigs(context.Background(), tag, prefix, int(skip), int(limit))
+	total, configs, err := server.configs.ListDBConfigs(context.Background(), tag, env, prefix, int(skip), int(limit))
 	if err != nil {
 		return JSONError(c, err)
 	}
@@ -42,9 +49,50 @@ func (server *Server) listConfig(c echo.Context) error {
 		listResult{Total: total, Configs: configs, Skip: int(skip), Limit: int(limit)})
 }
 
+type configRangeResult struct {
+	Configs  []configs.ConfigItem `json:"configs"`
+	Revision int64                `json:"revision"`
+	More     bool                 `json:"more"`
+	Cursor   string               `json:"cursor,omitempty"`
+}
+
+func (server *Server) rangeConfigs(c echo.Context) error {
+	limit, ok, err := IntQueryParamD(c, "limit", 20)
+	if !ok {
+		return err
+	}
+	revision, ok, err := IntQueryParamD(c, "revision", 0)
+	if !ok {
+		return err
+	}
+	from := c.QueryParam("from")
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		from = utils.NextRangeFromKey(cursor)
+	}
+
+	cfgs, rev, more, err := server.configs.Range(context.Background(), server.configEnv(c),
+		from, c.QueryParam("end"), int(limit), revision)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	result := configRangeResult{Configs: make([]configs.ConfigItem, 0, len(cfgs)), Revision: rev, More: more}
+	for _, cfg := range cfgs {
+		if ok, err := server.checkPerm(c, apps.PermTypeConfig, false, cfg.Name); err != nil {
+			return JSONError(c, err)
+		} else if ok {
+			result.Configs = append(result.Configs, cfg)
+		}
+	}
+	if more && len(cfgs) > 0 {
+		result.Cursor = cfgs[len(cfgs)-1].Name
+	}
+	return JSONResult(c, result)
+}
+
 type configQueryResult struct {
 	Config   *configs.ConfigItem `json:"config"`
 	Revision int64               `json:"revision"`
+	Degraded bool                `json:"degraded,omitempty"`
 }
 
 func (server *Server) getConfig(c echo.Context) error {
@@ -53,16 +101,44 @@ func (server *Server) getConfig(c echo.Context) error {
 	}
 	node := c.Request().Header.Get("node")
 
-	cfg, rev, err := server.configs.Get(context.Background(), server.appID(c), node, c.ParamValues()[0])
+	var cfg *configs.ConfigItem
+	var rev int64
+	var err error
+	if c.QueryParam("refs") == "true" {
+		cfg, rev, err = server.configs.GetResolved(context.Background(), server.appID(c), node,
+			server.configEnv(c), c.ParamValues()[0], server.configPermFilter(c))
+	} else {
+		cfg, rev, err = server.configs.Get(context.Background(), server.appID(c), node, server.configEnv(c), c.ParamValues()[0])
+	}
 	if err != nil {
 		return JSONError(c, err)
 	}
-	return JSONResult(c, configQueryResult{Config: cfg, Revision: rev})
+	if err := server.convertConfig(c, cfg); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, configQueryResult{Config: cfg, Revision: rev, Degraded: cfg.Degraded})
+}
+
+// convertConfig convert config value by format & path query params
+func (server *Server) convertConfig(c echo.Context, cfg *configs.ConfigItem) error {
+	format, path := c.QueryParam("format"), c.QueryParam("path")
+	if format == "" && path == "" {
+		return nil
+	}
+	return server.configs.Convert(cfg, format, path)
+}
+
+// configPermFilter filter config names readable by current app
+func (server *Server) configPermFilter(c echo.Context) configs.NameFilter {
+	return func(name string) (bool, error) {
+		return server.checkPerm(c, apps.PermTypeConfig, false, name)
+	}
 }
 
 type configsQueryResult struct {
 	Configs  []*configs.ConfigItem `json:"configs"`
 	Revision int64                 `json:"revision"`
+	Degraded bool                  `json:"degraded,omitempty"`
 }
 
 func (server *Server) getAllConfigs(c echo.Context) error {
@@ -87,13 +163,18 @@ func (server *Server) getAllConfigs(c echo.Context) error {
 	}
 
 	node := c.Request().Header.Get("node")
+	env := server.configEnv(c)
 	result := configsQueryResult{Configs: make([]*configs.ConfigItem, 0, len(keys)), Revision: 0}
 	for _, key := range keys {
-		if cfg, rev, err := server.configs.Get(context.Background(), server.appID(c), node, key); err == nil {
+		if cfg, rev, err := server.configs.Get(context.Background(), server.appID(c), node, env, key); err == nil {
+			if err := server.convertConfig(c, cfg); err != nil {
+				return JSONError(c, err)
+			}
 			if result.Revision > 0 && rev < result.Revision {
 				result.Revision = rev
 			}
 			result.Configs = append(result.Configs, cfg)
+			result.Degraded = result.Degraded || cfg.Degraded
 		} else {
 			return JSONError(c, err)
 		}
@@ -102,7 +183,30 @@ func (server *Server) getAllConfigs(c echo.Context) error {
 }
 
 func (server *Server) deleteConfig(c echo.Context) error {
-	err := server.configs.Delete(context.Background(), c.ParamValues()[0])
+	name := c.ParamValues()[0]
+	env := c.QueryParam("env")
+	if server.configs.IsProtected(name) {
+		version, ok, err := IntQueryParamD(c, "version", -1)
+		if !ok {
+			return err
+		}
+		change := configs.ConfigChange{Op: configs.ChangeOpDelete, Name: name, Env: env,
+			Version: version, Remark: c.QueryParam("remark"), AppID: server.appID(c)}
+		if err := server.configs.NewChange(context.Background(), &change); err != nil {
+			return JSONError(c, err)
+		}
+		return JSONResult(c, change)
+	}
+
+	override := c.QueryParam("override") == "true"
+	if override {
+		if ok, err := server.checkAdminPerm(c, name); err != nil {
+			return JSONError(c, err)
+		} else if !ok {
+			return server.newNotPermittedResp(c, name)
+		}
+	}
+	err := server.configs.Delete(context.Background(), env, name, server.appID(c), c.QueryParam("remark"), override)
 	if err != nil {
 		return JSONError(c, err)
 	}
@@ -110,11 +214,14 @@ func (server *Server) deleteConfig(c echo.Context) error {
 }
 
 type configPutResult struct {
-	Revision int64 `json:"revision"`
+	Revision int64                 `json:"revision"`
+	Change   *configs.ConfigChange `json:"change,omitempty"`
 }
 
 func (server *Server) putConfig(c echo.Context) error {
 	tag := c.FormValue("tag")
+	format := c.FormValue("format")
+	env := c.FormValue("env")
 	value := c.FormValue("value")
 	if value == "" {
 		return JSONErrorf(c, utils.EcodeInvalidValue, "invalid value")
@@ -124,8 +231,25 @@ func (server *Server) putConfig(c echo.Context) error {
 		return err
 	}
 	remark := c.FormValue("remark")
+	name := c.ParamValues()[0]
+	if server.configs.IsProtected(name) {
+		change := configs.ConfigChange{Op: configs.ChangeOpPut, Tag: tag, Format: format, Name: name, Env: env,
+			Value: value, Version: version, Remark: remark, AppID: server.appID(c)}
+		if err := server.configs.NewChange(context.Background(), &change); err != nil {
+			return JSONError(c, err)
+		}
+		return JSONResult(c, configPutResult{Change: &change})
+	}
 
-	rev, err := server.configs.Put(context.Background(), tag, c.ParamValues()[0], server.appID(c), remark, value, version)
+	override := c.FormValue("override") == "true"
+	if override {
+		if ok, err := server.checkAdminPerm(c, name); err != nil {
+			return JSONError(c, err)
+		} else if !ok {
+			return server.newNotPermittedResp(c, name)
+		}
+	}
+	rev, err := server.configs.Put(context.Background(), tag, format, env, name, server.appID(c), remark, value, version, override)
 	if err != nil {
 		return JSONError(c, err)
 	}
@@ -145,9 +269,66 @@ func (server *Server) watch(c echo.Context) error {
 	defer cancelFunc()
 	node := c.Request().Header.Get("node")
 
-	cfg, rev, err := server.configs.Watch(ctx, server.appID(c), node, c.ParamValues()[0], revision)
+	var cfg *configs.ConfigItem
+	var rev int64
+	if c.QueryParam("refs") == "true" {
+		cfg, rev, err = server.configs.WatchResolved(ctx, server.appID(c), node, server.configEnv(c),
+			c.ParamValues()[0], revision, server.configPermFilter(c))
+	} else {
+		cfg, rev, err = server.configs.Watch(ctx, server.appID(c), node, server.configEnv(c), c.ParamValues()[0], revision)
+	}
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, configQueryResult{Config: cfg, Revision: rev, Degraded: cfg.Degraded})
+}
+
+func (server *Server) watchConfigs(c echo.Context) error {
+	var keys []string
+	prefix := c.QueryParam("prefix")
+	if ks := c.QueryParam("keys"); ks != "" {
+		if err := json.Unmarshal([]byte(ks), &keys); err != nil {
+			return JSONErrorf(c, utils.EcodeInvalidParam, "invalid keys: %v", err)
+		}
+		if len(keys) == 0 {
+			return JSONErrorf(c, utils.EcodeInvalidParam, "empty keys")
+		}
+	} else if prefix == "" {
+		return JSONErrorf(c, utils.EcodeMissingParam, "missing keys or prefix")
+	}
+
+	var filter configs.NameFilter
+	if len(keys) > 0 {
+		notPermitted := make([]string, 0)
+		for _, key := range keys {
+			if ok, err := server.checkPerm(c, apps.PermTypeConfig, false, key); err != nil {
+				return JSONError(c, err)
+			} else if !ok {
+				notPermitted = append(notPermitted, key)
+			}
+		}
+		if len(notPermitted) != 0 {
+			return server.newNotPermittedResp(c, notPermitted...)
+		}
+	} else {
+		filter = server.configPermFilter(c)
+	}
+
+	revision, ok, err := IntQueryParamD(c, "revision", 0)
+	if !ok {
+		return err
+	}
+	timeout, ok, err := IntQueryParamD(c, "timeout", defaultWatchTimeout)
+	if !ok {
+		return err
+	}
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancelFunc()
+	node := c.Request().Header.Get("node")
+
+	changes, err := server.configs.WatchMulti(ctx, server.appID(c), node, server.configEnv(c), keys, prefix, revision, filter)
 	if err != nil {
 		return JSONError(c, err)
 	}
-	return JSONResult(c, configQueryResult{Config: cfg, Revision: rev})
+	return JSONResult(c, changes)
 }
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/configs"
+	"github.com/labstack/echo/v4"
+)
+
+type listConfigChangesResult struct {
+	Changes []configs.ConfigChange `json:"changes"`
+	Skip    int                    `json:"skip"`
+	Limit   int                    `json:"limit"`
+}
+
+func (server *Server) listConfigChanges(c echo.Context) error {
+	var status *int
+	if c.QueryParam("status") != "" {
+		n, ok, err := IntQueryParam(c, "status")
+		if !ok {
+			return err
+		}
+		s := int(n)
+		status = &s
+	}
+	skip, ok, err := IntQueryParamD(c, "skip", 0)
+	if !ok {
+		return err
+	}
+	limit, ok, err := IntQueryParamD(c, "limit", 100)
+	if !ok {
+		return err
+	}
+
+	changes, err := server.configs.ListChanges(status, c.QueryParam("prefix"), int(skip), int(limit))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	permitted := make([]configs.ConfigChange, 0, len(changes))
+	for _, change := range changes {
+		if ok, err := server.checkPerm(c, apps.PermTypeConfig, false, change.Name); err != nil {
+			return JSONError(c, err)
+		} else if ok {
+			permitted = append(permitted, change)
+		}
+	}
+	return JSONResult(c, listConfigChangesResult{Changes: permitted, Skip: int(skip), Limit: int(limit)})
+}
+
+func (server *Server) getConfigChange(c echo.Context) error {
+	id, ok, err := intParam(c, "id", c.ParamValues()[0])
+	if !ok {
+		return err
+	}
+	change, err := server.configs.GetChange(id)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if ok, err := server.checkPerm(c, apps.PermTypeConfig, false, change.Name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, change.Name)
+	}
+	return JSONResult(c, change)
+}
+
+func (server *Server) checkApprovePerm(c echo.Context, name string) (bool, error) {
+	app := server.app(c)
+	if app == nil {
+		return false, nil
+	}
+	groupIds := c.Get("groupIds").([]int64)
+	return server.apps.HasAnyPrefixPerm(apps.PermTypeConfigApproval, app.ID, groupIds, false, name)
+}
+
+type configChangeApproveResult struct {
+	Change   *configs.ConfigChange `json:"change"`
+	Revision int64                 `json:"revision"`
+}
+
+func (server *Server) approveConfigChange(c echo.Context) error {
+	id, ok, err := intParam(c, "id", c.ParamValues()[0])
+	if !ok {
+		return err
+	}
+	change, err := server.configs.GetChange(id)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if ok, err := server.checkApprovePerm(c, change.Name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, change.Name)
+	}
+
+	change, rev, err := server.configs.ApproveChange(context.Background(), id, server.appID(c))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, configChangeApproveResult{Change: change, Revision: rev})
+}
+
+func (server *Server) rejectConfigChange(c echo.Context) error {
+	id, ok, err := intParam(c, "id", c.ParamValues()[0])
+	if !ok {
+		return err
+	}
+	change, err := server.configs.GetChange(id)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if ok, err := server.checkApprovePerm(c, change.Name); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, change.Name)
+	}
+
+	change, err = server.configs.RejectChange(id, server.appID(c))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, change)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/utils"
+	"github.com/labstack/echo/v4"
+)
+
+func TestConfigChangeInvalidID(t *testing.T) {
+	db, mock := newMockDB(t)
+	server := newTestServer(t, db, mock)
+	foo := &apps.App{ID: 1, Name: "foo"}
+
+	for _, handler := range []echo.HandlerFunc{server.getConfigChange, server.approveConfigChange,
+		server.rejectConfigChange, server.deleteConfigFreeze} {
+		c, rec := newTestContext(server, http.MethodPost, nil, foo)
+		c.SetParamNames("id")
+		c.SetParamValues("abc")
+		if err := handler(c); err != nil {
+			t.Fatalf("handler fail: %v", err)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expect bad request, got %d", rec.Code)
+		}
+		if err := decodeResponse(t, rec, nil); err == nil || err.Code != utils.EcodeInvalidParam {
+			t.Errorf("expect invalid param, got %v", err)
+		}
+	}
+	checkMockDB(t, mock)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"time"
+
+	"github.com/infrmods/xbus/configs"
+	"github.com/infrmods/xbus/utils"
+	"github.com/labstack/echo/v4"
+)
+
+func (server *Server) listConfigFreezes(c echo.Context) error {
+	freezes, err := server.configs.ListFreezes()
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, freezes)
+}
+
+func parseTimeParam(c echo.Context, name string, defval time.Time) (time.Time, bool, error) {
+	val := c.FormValue(name)
+	if val == "" {
+		return defval, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return t, false, JSONErrorf(c, utils.EcodeInvalidParam, "invalid %s: %v", name, err)
+	}
+	return t, true, nil
+}
+
+func (server *Server) newConfigFreeze(c echo.Context) error {
+	freeze := configs.ConfigFreeze{
+		Prefix: c.FormValue("prefix"),
+		Reason: c.FormValue("reason"),
+		AppID:  server.appID(c)}
+	var ok bool
+	var err error
+	if freeze.StartTime, ok, err = parseTimeParam(c, "start_time", time.Now()); !ok {
+		return err
+	}
+	if c.FormValue("end_time") == "" {
+		return JSONErrorf(c, utils.EcodeMissingParam, "missing end_time")
+	}
+	if freeze.EndTime, ok, err = parseTimeParam(c, "end_time", time.Time{}); !ok {
+		return err
+	}
+	if ok, err := server.checkAdminPerm(c, freeze.Prefix); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, freeze.Prefix)
+	}
+	if err := server.configs.AddFreeze(&freeze); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, freeze)
+}
+
+func (server *Server) deleteConfigFreeze(c echo.Context) error {
+	id, ok, err := intParam(c, "id", c.ParamValues()[0])
+	if !ok {
+		return err
+	}
+	freeze, err := server.configs.GetFreeze(id)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if ok, err := server.checkAdminPerm(c, freeze.Prefix); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, freeze.Prefix)
+	}
+	if err := server.configs.DeleteFreeze(id); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
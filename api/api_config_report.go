@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/configs"
+	"github.com/infrmods/xbus/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type listUnusedConfigsResult struct {
+	Configs []configs.UnusedConfig `json:"configs"`
+	Skip    int                    `json:"skip"`
+	Limit   int                    `json:"limit"`
+}
+
+func unusedTypeParam(typ string) string {
+	if typ == "" {
+		return configs.UnusedUnread
+	}
+	return typ
+}
+
+func (server *Server) listUnusedConfigs(c echo.Context) error {
+	days, ok, err := IntQueryParamD(c, "days", 90)
+	if !ok {
+		return err
+	}
+	skip, ok, err := IntQueryParamD(c, "skip", 0)
+	if !ok {
+		return err
+	}
+	limit, ok, err := IntQueryParamD(c, "limit", 200)
+	if !ok {
+		return err
+	}
+
+	items, err := server.configs.ListUnused(unusedTypeParam(c.QueryParam("type")), int(days),
+		c.QueryParam("prefix"), int(skip), int(limit))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	permitted := make([]configs.UnusedConfig, 0, len(items))
+	for _, item := range items {
+		if ok, err := server.checkPerm(c, apps.PermTypeConfig, false, item.Name); err != nil {
+			return JSONError(c, err)
+		} else if ok {
+			permitted = append(permitted, item)
+		}
+	}
+	return JSONResult(c, listUnusedConfigsResult{Configs: permitted, Skip: int(skip), Limit: int(limit)})
+}
+
+type archiveConfig struct {
+	Name  string `json:"name"`
+	Env   string `json:"env"`
+	Error string `json:"error,omitempty"`
+}
+
+type archiveConfigsResult struct {
+	Archived []archiveConfig `json:"archived"`
+	Failed   []archiveConfig `json:"failed"`
+}
+
+func (server *Server) archiveUnusedConfigs(c echo.Context) error {
+	days, ok, err := IntFormParamD(c, "days", 90)
+	if !ok {
+		return err
+	}
+	var items []archiveConfig
+	if err := json.Unmarshal([]byte(c.FormValue("configs")), &items); err != nil {
+		return JSONErrorf(c, utils.EcodeInvalidParam, "invalid configs: %v", err)
+	}
+	notPermitted := make([]string, 0)
+	for _, item := range items {
+		if ok, err := server.checkAdminPerm(c, item.Name); err != nil {
+			return JSONError(c, err)
+		} else if !ok {
+			notPermitted = append(notPermitted, item.Name)
+		}
+	}
+	if len(notPermitted) != 0 {
+		return server.newNotPermittedResp(c, notPermitted...)
+	}
+
+	typ := unusedTypeParam(c.FormValue("type"))
+	result := archiveConfigsResult{Archived: make([]archiveConfig, 0), Failed: make([]archiveConfig, 0)}
+	for _, item := range items {
+		if err := server.configs.Archive(context.Background(), typ, int(days), item.Env, item.Name,
+			server.appID(c), c.FormValue("remark")); err != nil {
+			item.Error = err.Error()
+			result.Failed = append(result.Failed, item)
+		} else {
+			result.Archived = append(result.Archived, item)
+		}
+	}
+	return JSONResult(c, result)
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/configs"
+	"github.com/infrmods/xbus/utils"
+	"github.com/labstack/echo/v4"
+)
+
+func (server *Server) listConfigWebhooks(c echo.Context) error {
+	hooks, err := server.configs.ListWebhooks()
+	if err != nil {
+		return JSONError(c, err)
+	}
+	permitted := make([]configs.ConfigWebhook, 0, len(hooks))
+	for _, hook := range hooks {
+		if ok, err := server.checkPerm(c, apps.PermTypeConfig, false, hook.Prefix); err != nil {
+			return JSONError(c, err)
+		} else if ok {
+			permitted = append(permitted, hook)
+		}
+	}
+	return JSONResult(c, permitted)
+}
+
+func (server *Server) newConfigWebhook(c echo.Context) error {
+	hook := configs.ConfigWebhook{
+		Prefix: c.FormValue("prefix"),
+		URL:    c.FormValue("url"),
+		Secret: c.FormValue("secret"),
+		AppID:  server.appID(c)}
+	if hook.URL == "" {
+		return JSONErrorf(c, utils.EcodeMissingParam, "missing url")
+	}
+	if ok, err := server.checkPerm(c, apps.PermTypeConfig, true, hook.Prefix); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, hook.Prefix)
+	}
+	// webhooks are posted from inside the network, hosts not allowed are for admins only
+	if !server.configs.IsWebhookHostAllowed(hook.URL) {
+		if ok, err := server.checkAdminPerm(c, hook.Prefix); err != nil {
+			return JSONError(c, err)
+		} else if !ok {
+			return JSONErrorf(c, utils.EcodeNotPermitted, "webhook host is not allowed: %s", hook.URL)
+		}
+	}
+	if err := server.configs.AddWebhook(&hook); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, hook)
+}
+
+func (server *Server) getPermittedWebhook(c echo.Context, needWrite bool) (*configs.ConfigWebhook, error) {
+	id, ok, err := intParam(c, "id", c.ParamValues()[0])
+	if !ok {
+		return nil, err
+	}
+	hook, err := server.configs.GetWebhook(id)
+	if err != nil {
+		return nil, JSONError(c, err)
+	}
+	if ok, err := server.checkPerm(c, apps.PermTypeConfig, needWrite, hook.Prefix); err != nil {
+		return nil, JSONError(c, err)
+	} else if !ok {
+		return nil, server.newNotPermittedResp(c, hook.Prefix)
+	}
+	return hook, nil
+}
+
+func (server *Server) deleteConfigWebhook(c echo.Context) error {
+	hook, err := server.getPermittedWebhook(c, true)
+	if hook == nil {
+		return err
+	}
+	if err := server.configs.DeleteWebhook(hook.ID); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
+
+type listWebhookDeliveriesResult struct {
+	Deliveries []configs.WebhookDelivery `json:"deliveries"`
+	Skip       int                       `json:"skip"`
+	Limit      int                       `json:"limit"`
+}
+
+func (server *Server) listConfigWebhookDeliveries(c echo.Context) error {
+	hook, err := server.getPermittedWebhook(c, false)
+	if hook == nil {
+		return err
+	}
+	skip, ok, err := IntQueryParamD(c, "skip", 0)
+	if !ok {
+		return err
+	}
+	limit, ok, err := IntQueryParamD(c, "limit", 20)
+	if !ok {
+		return err
+	}
+	deliveries, err := server.configs.ListWebhookDeliveries(hook.ID, int(skip), int(limit))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, listWebhookDeliveriesResult{Deliveries: deliveries, Skip: int(skip), Limit: int(limit)})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/configs"
+	"github.com/infrmods/xbus/utils"
+)
+
+func TestNewConfigWebhook(t *testing.T) {
+	db, mock := newMockDB(t)
+	server := newTestServer(t, db, mock)
+	server.configs = configs.NewConfigCtrl(&configs.Config{KeyPrefix: "/" + t.Name(),
+		WebhookAllowedHosts: []string{"hooks.local", ".example.com"}}, db, testEtcd.Client)
+	foo := &apps.App{ID: 1, Name: "foo"}
+	writer := apps.Perm{ID: 1, CanWrite: true, Content: "db."}
+	add := func(hookURL string) *utils.Error {
+		c, rec := newTestContext(server, http.MethodPost, url.Values{"prefix": {"db."}, "url": {hookURL}}, foo)
+		if err := server.newConfigWebhook(c); err != nil {
+			t.Fatalf("new webhook fail: %v", err)
+		}
+		return decodeResponse(t, rec, nil)
+	}
+	expectInsert := func(hookURL string) {
+		mock.ExpectExec(`insert into config_webhooks`).WithArgs("db.", hookURL, "", 1).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	for _, hookURL := range []string{"http://hooks.local/x", "https://a.example.com:8443/x"} {
+		expectAppPerms(mock, apps.PermTypeConfig, 1, writer)
+		expectInsert(hookURL)
+		if err := add(hookURL); err != nil {
+			t.Errorf("add webhook(%s) fail: %v", hookURL, err)
+		}
+	}
+
+	// other hosts need admin perm
+	for _, hookURL := range []string{"http://127.0.0.1:2379/v3/kv/put", "http://example.com.evil/x"} {
+		expectAppPerms(mock, apps.PermTypeConfig, 1, writer)
+		expectAppPerms(mock, apps.PermTypeAdmin, 1)
+		if err := add(hookURL); err == nil || err.Code != utils.EcodeNotPermitted {
+			t.Errorf("expect not permitted of %s, got %v", hookURL, err)
+		}
+	}
+	expectAppPerms(mock, apps.PermTypeConfig, 1, writer)
+	expectAppPerms(mock, apps.PermTypeAdmin, 1, apps.Perm{ID: 2, Content: "db."})
+	expectInsert("http://127.0.0.1/x")
+	if err := add("http://127.0.0.1/x"); err != nil {
+		t.Errorf("add webhook by admin fail: %v", err)
+	}
+	checkMockDB(t, mock)
+}
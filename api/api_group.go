@@ -0,0 +1,147 @@
+package api
+
+import (
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// checkGroupPerm group changes affect perms of members, global perm admin is required
+func (server *Server) checkGroupPerm(c echo.Context, needWrite bool) (bool, error) {
+	if ok, err := server.checkPerm(c, apps.PermTypePermAdmin, needWrite, ""); err != nil {
+		return false, JSONError(c, err)
+	} else if !ok {
+		return false, server.newNotPermittedResp(c, "perm admin")
+	}
+	return true, nil
+}
+
+func (server *Server) getGroupParam(c echo.Context) (*apps.Group, error) {
+	name := c.ParamValues()[0]
+	group, err := server.apps.GetGroupByName(name)
+	if err != nil {
+		return nil, JSONError(c, err)
+	}
+	if group == nil {
+		return nil, JSONErrorf(c, utils.EcodeNotFound, "no such group: %s", name)
+	}
+	return group, nil
+}
+
+func (server *Server) listGroups(c echo.Context) error {
+	if ok, err := server.checkGroupPerm(c, false); !ok {
+		return err
+	}
+	groups, err := server.apps.ListGroups()
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, groups)
+}
+
+type newGroupRequest struct {
+	Name        string `json:"name" form:"name"`
+	Description string `json:"description" form:"description"`
+}
+
+func (server *Server) newGroup(c echo.Context) error {
+	if ok, err := server.checkGroupPerm(c, true); !ok {
+		return err
+	}
+	var req newGroupRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	group := apps.Group{Status: utils.StatusOk, Name: req.Name, Description: req.Description}
+	if err := server.apps.NewGroup(&group); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
+
+type groupInfo struct {
+	Group   *apps.Group `json:"group"`
+	Members []string    `json:"members"`
+	Perms   []apps.Perm `json:"perms"`
+}
+
+func (server *Server) getGroup(c echo.Context) error {
+	if ok, err := server.checkGroupPerm(c, false); !ok {
+		return err
+	}
+	group, err := server.getGroupParam(c)
+	if group == nil {
+		return err
+	}
+	members, err := server.apps.GetGroupMembers(group.ID)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	perms, err := server.apps.GetGroupPerms(group.ID)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	info := groupInfo{Group: group, Members: make([]string, 0, len(members)), Perms: perms}
+	for _, app := range members {
+		info.Members = append(info.Members, app.Name)
+	}
+	return JSONResult(c, info)
+}
+
+func (server *Server) deleteGroup(c echo.Context) error {
+	if ok, err := server.checkGroupPerm(c, true); !ok {
+		return err
+	}
+	group, err := server.getGroupParam(c)
+	if group == nil {
+		return err
+	}
+	if err := server.apps.DeleteGroup(group, server.permOperator(c)); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
+
+func (server *Server) getGroupMemberParams(c echo.Context) (*apps.Group, *apps.App, error) {
+	group, err := server.getGroupParam(c)
+	if group == nil {
+		return nil, nil, err
+	}
+	name := c.ParamValues()[1]
+	app, err := server.apps.GetAppByName(name)
+	if err != nil {
+		return nil, nil, JSONError(c, err)
+	}
+	if app == nil {
+		return nil, nil, JSONErrorf(c, utils.EcodeNotFound, "no such app: %s", name)
+	}
+	return group, app, nil
+}
+
+func (server *Server) addGroupMember(c echo.Context) error {
+	if ok, err := server.checkGroupPerm(c, true); !ok {
+		return err
+	}
+	group, app, err := server.getGroupMemberParams(c)
+	if app == nil {
+		return err
+	}
+	if err := server.apps.AddGroupMember(group.ID, app.ID); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
+
+func (server *Server) removeGroupMember(c echo.Context) error {
+	if ok, err := server.checkGroupPerm(c, true); !ok {
+		return err
+	}
+	group, app, err := server.getGroupMemberParams(c)
+	if app == nil {
+		return err
+	}
+	if err := server.apps.RemoveGroupMember(group.ID, app.ID); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/utils"
+	"github.com/labstack/echo/v4"
+)
+
+var permTargetTypes = map[string]int{"app": apps.PermTargetApp, "group": apps.PermTargetGroup}
+
+// permTarget get perm target type & id from params, app public is the public target
+func (server *Server) permTarget(targetTypeName, target string) (int, int64, error) {
+	targetType, ok := permTargetTypes[targetTypeName]
+	if !ok {
+		return 0, 0, utils.Errorf(utils.EcodeInvalidParam, "invalid target type: %s", targetTypeName)
+	}
+	if target == "" {
+		return 0, 0, utils.Errorf(utils.EcodeMissingParam, "missing target")
+	}
+	targetID, err := server.apps.PermTarget(targetType, target)
+	if err != nil {
+		return 0, 0, err
+	}
+	return targetType, targetID, nil
+}
+
+func (server *Server) permOperator(c echo.Context) string {
+	if app := server.app(c); app != nil {
+		return app.Name
+	}
+	return ""
+}
+
+// checkPermAdminPerm check current app has perm admin perm covering content,
+// unlike checkPerm names of its own prefix are not implied(an app could grant itself admin perms)
+func (server *Server) checkPermAdminPerm(c echo.Context, content string) (bool, error) {
+	app := server.app(c)
+	if app == nil {
+		return false, nil
+	}
+	groupIds := c.Get("groupIds").([]int64)
+	return server.apps.HasPermAdminPerm(app.ID, groupIds, content)
+}
+
+func (server *Server) listPerms(c echo.Context) error {
+	prefix := c.QueryParam("prefix")
+	if ok, err := server.checkPermAdminPerm(c, prefix); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, prefix)
+	}
+	typ, ok, err := IntQueryParamD(c, "type", apps.PermTypeConfig)
+	if !ok {
+		return err
+	}
+	var appName, groupName, prefixP *string
+	var canWrite *bool
+	if name := c.QueryParam("app"); name != "" {
+		appName = &name
+	} else if name := c.QueryParam("group"); name != "" {
+		groupName = &name
+	}
+	if prefix != "" {
+		prefixP = &prefix
+	}
+	if write := c.QueryParam("write"); write != "" {
+		b := write == "true"
+		canWrite = &b
+	}
+	perms, err := server.apps.GetPerms(int(typ), appName, groupName, canWrite, prefixP)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if perms == nil {
+		perms = make([]apps.Perm, 0)
+	}
+	return JSONResult(c, perms)
+}
+
+func (server *Server) grantPerm(c echo.Context) error {
+	content := c.FormValue("content")
+	if ok, err := server.checkPermAdminPerm(c, content); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, content)
+	}
+	typ, ok, err := IntFormParam(c, "type")
+	if !ok {
+		return err
+	}
+	targetType, targetID, err := server.permTarget(c.FormValue("target_type"), c.FormValue("target"))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	perm := apps.Perm{PermType: int(typ), TargetType: targetType, TargetID: targetID,
+		CanWrite: c.FormValue("write") == "true", Deny: c.FormValue("deny") == "true", Content: content}
+	if err := server.apps.GrantPerm(&perm, server.permOperator(c)); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, perm)
+}
+
+func (server *Server) revokePerm(c echo.Context) error {
+	id, ok, err := intParam(c, "id", c.ParamValues()[0])
+	if !ok {
+		return err
+	}
+	perm, err := server.apps.GetPermByID(id)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	if perm == nil {
+		return JSONErrorf(c, utils.EcodeNotFound, "no such perm: %d", id)
+	}
+	if ok, err := server.checkPermAdminPerm(c, perm.Content); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, perm.Content)
+	}
+	if err := server.apps.RevokePerm(perm, server.permOperator(c)); err != nil {
+		return JSONError(c, err)
+	}
+	return JSONOk(c)
+}
+
+func (server *Server) listPermAudits(c echo.Context) error {
+	prefix := c.QueryParam("prefix")
+	if ok, err := server.checkPermAdminPerm(c, prefix); err != nil {
+		return JSONError(c, err)
+	} else if !ok {
+		return server.newNotPermittedResp(c, prefix)
+	}
+	skip, ok, err := IntQueryParamD(c, "skip", 0)
+	if !ok {
+		return err
+	}
+	limit, ok, err := IntQueryParamD(c, "limit", 100)
+	if !ok {
+		return err
+	}
+	audits, err := server.apps.ListPermAudits(prefix, int(skip), int(limit))
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, audits)
+}
+
+// explainPerm explain perm decision of app(default current) on name,
+// perm admin is required unless explaining the current app
+func (server *Server) explainPerm(c echo.Context) error {
+	name := c.QueryParam("name")
+	current := apps.PermPublicTarget
+	if app := server.app(c); app != nil {
+		current = app.Name
+	}
+	appName := c.QueryParam("app")
+	if appName == "" {
+		appName = current
+	}
+	if appName != current {
+		if ok, err := server.checkPerm(c, apps.PermTypePermAdmin, false, name); err != nil {
+			return JSONError(c, err)
+		} else if !ok {
+			return server.newNotPermittedResp(c, name)
+		}
+	}
+	typ, ok, err := IntQueryParamD(c, "type", apps.PermTypeConfig)
+	if !ok {
+		return err
+	}
+	explanation, err := server.apps.ExplainPerm(appName, int(typ), c.QueryParam("write") == "true", name)
+	if err != nil {
+		return JSONError(c, err)
+	}
+	return JSONResult(c, explanation)
+}
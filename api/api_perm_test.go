@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type testResponse struct {
+	Ok     bool            `json:"ok"`
+	Result json.RawMessage `json:"result"`
+	Error  *utils.Error    `json:"error"`
+}
+
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, result interface{}) *utils.Error {
+	var resp testResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response fail: %v, %s", err, rec.Body.String())
+	}
+	if !resp.Ok {
+		return resp.Error
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			t.Fatalf("decode result fail: %v, %s", err, resp.Result)
+		}
+	}
+	return nil
+}
+
+func grantForm(content string, write, deny bool) url.Values {
+	form := url.Values{"type": {strconv.Itoa(apps.PermTypeApp)}, "target_type": {"app"}, "target": {"public"}, "content": {content}}
+	if write {
+		form.Set("write", "true")
+	}
+	if deny {
+		form.Set("deny", "true")
+	}
+	return form
+}
+
+func TestGrantPerm(t *testing.T) {
+	db, mock := newMockDB(t)
+	server := newTestServer(t, db, mock)
+	foo := &apps.App{ID: 1, Name: "foo"}
+	admin := apps.Perm{ID: 1, CanWrite: true, Content: "foo."}
+	grant := func(form url.Values) (*apps.Perm, *utils.Error) {
+		c, rec := newTestContext(server, http.MethodPost, form, foo)
+		if err := server.grantPerm(c); err != nil {
+			t.Fatalf("grant perm fail: %v", err)
+		}
+		var perm apps.Perm
+		return &perm, decodeResponse(t, rec, &perm)
+	}
+	expectExisting := func(canWrite, deny bool) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`select id, can_write, deny, create_time from perms`).
+			WithArgs(apps.PermTypeApp, apps.PermTargetApp, apps.PermPublicTargetID, "foo.keya").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "can_write", "deny", "create_time"}).
+				AddRow(5, canWrite, deny, time.Now()))
+	}
+	expectAudit := func(canWrite, deny bool) {
+		mock.ExpectExec(`insert into perm_audits`).WithArgs(apps.PermActionGrant, 5, apps.PermTypeApp, apps.PermTargetApp,
+			apps.PermPublicTargetID, canWrite, deny, "foo.keya", "foo").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+
+	// own prefix does not imply perm admin
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1)
+	if _, err := grant(grantForm("foo.keya", true, false)); err == nil || err.Code != utils.EcodeNotPermitted {
+		t.Fatalf("expect not permitted, got %v", err)
+	}
+
+	// granted content must not be wider than the perm admin perm
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, apps.Perm{ID: 1, CanWrite: true, Content: "foo.*"})
+	if _, err := grant(grantForm("foo.**", true, false)); err == nil || err.Code != utils.EcodeNotPermitted {
+		t.Fatalf("expect not permitted, got %v", err)
+	}
+
+	// new perm
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`select id, can_write, deny, create_time from perms`).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+	if _, err := grant(grantForm("foo.keya", false, false)); err == nil || err.Code != utils.EcodeSystemError {
+		t.Fatalf("expect system error, got %v", err)
+	}
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`select id, can_write, deny, create_time from perms`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "can_write", "deny", "create_time"}))
+	mock.ExpectExec(`insert into perms`).WithArgs(apps.PermTypeApp, apps.PermTargetApp, apps.PermPublicTargetID, false, false, "foo.keya").
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	expectAudit(false, false)
+	if perm, err := grant(grantForm("foo.keya", false, false)); err != nil || perm.ID != 5 {
+		t.Fatalf("grant new perm fail: %+v, %v", perm, err)
+	}
+
+	// allow perm is upgraded to write, never downgraded
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	expectExisting(false, false)
+	mock.ExpectExec(`update perms set can_write=\? where id=\?`).WithArgs(true, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(true, false)
+	if perm, err := grant(grantForm("foo.keya", true, false)); err != nil || !perm.CanWrite {
+		t.Fatalf("upgrade perm fail: %+v, %v", perm, err)
+	}
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	expectExisting(true, false)
+	mock.ExpectRollback()
+	if perm, err := grant(grantForm("foo.keya", false, false)); err != nil || !perm.CanWrite {
+		t.Fatalf("expect perm unchanged: %+v, %v", perm, err)
+	}
+
+	// deny perm of write only is widened to all
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	expectExisting(true, true)
+	mock.ExpectExec(`update perms set can_write=\? where id=\?`).WithArgs(false, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(false, true)
+	if perm, err := grant(grantForm("foo.keya", false, true)); err != nil || perm.CanWrite || !perm.Deny {
+		t.Fatalf("widen deny perm fail: %+v, %v", perm, err)
+	}
+
+	// allow & deny of the same content conflict
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	expectExisting(false, true)
+	mock.ExpectRollback()
+	if _, err := grant(grantForm("foo.keya", true, false)); err == nil || err.Code != utils.EcodeNameDuplicated {
+		t.Fatalf("expect conflict, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestRevokePerm(t *testing.T) {
+	db, mock := newMockDB(t)
+	server := newTestServer(t, db, mock)
+	foo := &apps.App{ID: 1, Name: "foo"}
+	revoke := func() *utils.Error {
+		c, rec := newTestContext(server, http.MethodDelete, nil, foo)
+		c.SetParamNames("id")
+		c.SetParamValues("5")
+		if err := server.revokePerm(c); err != nil {
+			t.Fatalf("revoke perm fail: %v", err)
+		}
+		return decodeResponse(t, rec, nil)
+	}
+	expectPerm := func() {
+		mock.ExpectQuery(`select \* from perms where id=\?`).WithArgs(5).WillReturnRows(sqlmock.NewRows(permColumns).
+			AddRow(5, apps.PermTypeConfigApproval, apps.PermTargetApp, 1, false, false, "foo.keya", time.Now()))
+	}
+
+	expectPerm()
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1)
+	if err := revoke(); err == nil || err.Code != utils.EcodeNotPermitted {
+		t.Fatalf("expect not permitted, got %v", err)
+	}
+
+	expectPerm()
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, apps.Perm{ID: 1, CanWrite: true, Content: "foo."})
+	mock.ExpectBegin()
+	mock.ExpectExec(`delete from perms where id=\?`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert into perm_audits`).WithArgs(apps.PermActionRevoke, 5, apps.PermTypeConfigApproval,
+		apps.PermTargetApp, 1, false, false, "foo.keya", "foo").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := revoke(); err != nil {
+		t.Fatalf("revoke perm fail: %v", err)
+	}
+
+	// revoked by others concurrently
+	expectPerm()
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, apps.Perm{ID: 1, CanWrite: true, Content: "foo."})
+	mock.ExpectBegin()
+	mock.ExpectExec(`delete from perms where id=\?`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	if err := revoke(); err == nil || err.Code != utils.EcodeNotFound {
+		t.Fatalf("expect not found, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestListPermsPermAdmin(t *testing.T) {
+	db, mock := newMockDB(t)
+	server := newTestServer(t, db, mock)
+	foo := &apps.App{ID: 1, Name: "foo"}
+	list := func(handler func(c echo.Context) error, prefix string) *utils.Error {
+		c, rec := newTestContext(server, http.MethodGet, nil, foo)
+		c.Request().URL.RawQuery = url.Values{"prefix": {prefix}}.Encode()
+		if err := handler(c); err != nil {
+			t.Fatalf("list fail: %v", err)
+		}
+		return decodeResponse(t, rec, nil)
+	}
+
+	// own prefix does not imply perm admin
+	for _, handler := range []func(c echo.Context) error{server.listPerms, server.listPermAudits} {
+		expectAppPerms(mock, apps.PermTypePermAdmin, 1)
+		if err := list(handler, "foo."); err == nil || err.Code != utils.EcodeNotPermitted {
+			t.Fatalf("expect not permitted, got %v", err)
+		}
+	}
+
+	admin := apps.Perm{ID: 1, CanWrite: true, Content: "foo."}
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	mock.ExpectQuery(`select \* from perms where perm_type=\? and content like \?`).
+		WithArgs(apps.PermTypeConfig, "foo.x%").WillReturnRows(sqlmock.NewRows(permColumns))
+	if err := list(server.listPerms, "foo.x"); err != nil {
+		t.Fatalf("list perms fail: %v", err)
+	}
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	mock.ExpectQuery(`select \* from perm_audits where content like \?`).WithArgs("foo.x%", 0, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "action", "perm_id", "perm_type", "target_type", "target_id",
+			"can_write", "deny", "content", "operator", "create_time"}))
+	if err := list(server.listPermAudits, "foo.x"); err != nil {
+		t.Fatalf("list perm audits fail: %v", err)
+	}
+	expectAppPerms(mock, apps.PermTypePermAdmin, 1, admin)
+	if err := list(server.listPermAudits, ""); err == nil || err.Code != utils.EcodeNotPermitted {
+		t.Fatalf("expect not permitted, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/utils"
+	"github.com/infrmods/xbus/utils/etcdtest"
+	"github.com/labstack/echo/v4"
+)
+
+var testEtcd *etcdtest.Server
+
+func TestMain(m *testing.M) {
+	server, err := etcdtest.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start embedded etcd fail: %v\n", err)
+		os.Exit(1)
+	}
+	testEtcd = server
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+var permColumns = []string{"id", "perm_type", "target_type", "target_id", "can_write", "deny", "content", "create_time"}
+
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("new sqlmock fail: %v", err)
+	}
+	return db, mock
+}
+
+func checkMockDB(t *testing.T, mock sqlmock.Sqlmock) {
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
+
+// newTestServer new server with app ctrl of a temp self-signed root, key prefix of test name
+func newTestServer(t *testing.T, db *sql.DB, mock sqlmock.Sqlmock) *Server {
+	dir, err := ioutil.TempDir("", "xbus-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem, err := utils.EncodePrivateKeyToPem(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := apps.Config{Cert: apps.CertsConfig{
+		RootCert: filepath.Join(dir, "rootcert.pem"), RootKey: filepath.Join(dir, "rootkey.pem")},
+		KeyPrefix: "/" + strings.Replace(t.Name(), "/", "_", -1), CertGracePeriod: time.Hour, RequestTimeout: time.Second}
+	if err := utils.WritePem(config.Cert.RootCert, 0644, "CERTIFICATE", der); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(config.Cert.RootKey, []byte(keyPem), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`select \* from revoked_certs`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "serial_no", "app_id", "reason", "revoke_time"}))
+	appCtrl, err := apps.NewAppCtrl(&config, db, testEtcd.Client)
+	if err != nil {
+		t.Fatalf("new app ctrl fail: %v", err)
+	}
+	return &Server{etcdClient: testEtcd.Client, apps: appCtrl, e: echo.New()}
+}
+
+// newTestContext new context of app(anonymous if nil) with form values
+func newTestContext(server *Server, method string, form url.Values, app *apps.App, groupIDs ...int64) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := server.e.NewContext(req, rec)
+	c.Set("app", app)
+	if groupIDs == nil {
+		groupIDs = []int64{}
+	}
+	c.Set("groupIds", groupIDs)
+	return c, rec
+}
+
+// expectAppPerms expect perms of type granted to app(no groups) queried from db
+func expectAppPerms(mock sqlmock.Sqlmock, permType int, appID int64, perms ...apps.Perm) {
+	rows := sqlmock.NewRows(permColumns)
+	for _, perm := range perms {
+		rows.AddRow(perm.ID, permType, apps.PermTargetApp, appID, perm.CanWrite, perm.Deny, perm.Content, time.Now())
+	}
+	mock.ExpectQuery(`select \* from perms`).WithArgs(apps.PermTargetApp, appID, apps.PermPublicTargetID, permType).
+		WillReturnRows(rows)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/http"
@@ -114,7 +115,15 @@ func (server *Server) prepare() {
 	server.registerV1ServiceAPIs(server.e.Group("/api/v1/services"))
 	server.e.GET("/api/v1/service-descs", server.v1WatchServiceDesc)
 	server.registerConfigAPIs(server.e.Group("/api/configs"))
+	server.registerConfigChangeAPIs(server.e.Group("/api/config-changes"))
+	server.registerConfigWebhookAPIs(server.e.Group("/api/config-webhooks"))
+	server.registerConfigFreezeAPIs(server.e.Group("/api/config-freezes"))
+	server.registerConfigReportAPIs(server.e.Group("/api/config-reports"))
 	server.registerAppAPIs(server.e.Group("/api/apps"))
+	server.registerPermAPIs(server.e.Group("/api/perms"))
+	server.registerGroupAPIs(server.e.Group("/api/groups"))
+	server.e.GET("/api/crl", server.getCRL)
+	server.e.GET("/api/certs/expiring", server.listExpiringCerts)
 	server.registerLeaseAPIs(server.e.Group("/api/leases"))
 	p := prometheus.NewPrometheus("xbus", nil)
 	p.Use(server.e)
@@ -187,10 +196,12 @@ func (server *Server) getRemoteIP(c echo.Context) net.IP {
 func (server *Server) verifyApp(h echo.HandlerFunc) echo.HandlerFunc {
 	return echo.HandlerFunc(func(c echo.Context) error {
 		var appName string
+		var appCert *x509.Certificate
 		req := c.Request()
 		if server.tls {
 			if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
-				appName = req.TLS.PeerCertificates[0].Subject.CommonName
+				appCert = req.TLS.PeerCertificates[0]
+				appName = appCert.Subject.CommonName
 				c.Set("tlsAppName", appName)
 			} else if server.config.DevNets != nil {
 				if devApp := req.Header.Get("Dev-App"); devApp != "" {
@@ -210,6 +221,12 @@ func (server *Server) verifyApp(h echo.HandlerFunc) echo.HandlerFunc {
 			// TODO: http request sign verify
 		}
 
+		if appCert != nil && server.apps.IsCertRevoked(appCert) {
+			glog.V(1).Infof("app(%s) cert(%s) is revoked", appName, appCert.SerialNumber)
+			return JSONErrorC(c, http.StatusUnauthorized,
+				utils.Errorf(utils.EcodeNotPermitted, "app cert is revoked"))
+		}
+
 		c.Set("app", (*apps.App)(nil))
 		c.Set("groupIds", []int64{})
 		if appName != "" {
@@ -219,7 +236,20 @@ func (server *Server) verifyApp(h echo.HandlerFunc) echo.HandlerFunc {
 					utils.Errorf(utils.EcodeSystemError, "get app fail"))
 			} else if app == nil {
 				glog.V(1).Infof("no such app: %s", appName)
+			} else if app.Status != utils.StatusOk {
+				glog.V(1).Infof("app(%s) is disabled", appName)
+				return JSONErrorC(c, http.StatusUnauthorized,
+					utils.Errorf(utils.EcodeNotPermitted, "app is disabled"))
 			} else {
+				if appCert != nil {
+					if ok, err := server.apps.VerifyAppCert(app, appCert); err != nil {
+						return JSONErrorC(c, http.StatusServiceUnavailable, err)
+					} else if !ok {
+						glog.V(1).Infof("app(%s) cert(%s) is replaced", appName, appCert.SerialNumber)
+						return JSONErrorC(c, http.StatusUnauthorized,
+							utils.Errorf(utils.EcodeNotPermitted, "app cert is replaced or expired"))
+					}
+				}
 				c.Set("app", app)
 				c.Set("groupIds", groupIds)
 			}
@@ -246,36 +276,34 @@ func (server *Server) app(c echo.Context) *apps.App {
 	return c.Get("app").(*apps.App)
 }
 
+func (server *Server) configEnv(c echo.Context) string {
+	if env := c.Request().Header.Get("env"); env != "" {
+		return env
+	}
+	if x := c.Get("app").(*apps.App); x != nil {
+		return x.Env
+	}
+	return ""
+}
+
 func (server *Server) newNotPermittedResp(c echo.Context, keys ...string) error {
 	msg := fmt.Sprintf("not permitted: [%s] %s", server.appName(c), strings.Join(keys, ", "))
 	return JSONError(c, utils.NewNotPermittedError(msg, keys))
 }
 
 func (server *Server) checkPerm(c echo.Context, permType int, needWrite bool, name string) (bool, error) {
-	app := c.Get("app").(*apps.App)
+	groupIds := c.Get("groupIds").([]int64)
+	return server.apps.HasPerm(permType, server.app(c), groupIds, needWrite, name)
+}
+
+// checkAdminPerm check current app has admin perm of name
+func (server *Server) checkAdminPerm(c echo.Context, name string) (bool, error) {
+	app := server.app(c)
 	if app == nil {
-		if needWrite {
-			return false, nil
-		}
-		if has, err := server.apps.HasAnyPrefixPerm(permType, apps.PermPublicTargetID, nil, needWrite, name); err == nil {
-			if !has {
-				return false, nil
-			}
-		} else {
-			return false, err
-		}
-	} else if !strings.HasPrefix(name, app.Name+".") {
-		groupIds := c.Get("groupIds").([]int64)
-		if has, err := server.apps.HasAnyPrefixPerm(permType, app.ID, groupIds, needWrite, name); err == nil {
-			if !has {
-				return false, nil
-			}
-		} else {
-			return false, err
-		}
+		return false, nil
 	}
-
-	return true, nil
+	groupIds := c.Get("groupIds").([]int64)
+	return server.apps.HasAnyPrefixPerm(apps.PermTypeAdmin, app.ID, groupIds, false, name)
 }
 
 func (server *Server) newPermChecker(permType int, needWrite bool) echo.MiddlewareFunc {
@@ -330,10 +358,59 @@ func (server *Server) registerConfigAPIs(g *echo.Group) {
 		server.newPermChecker(apps.PermTypeConfig, true))
 }
 
+func (server *Server) registerConfigChangeAPIs(g *echo.Group) {
+	g.GET("", echo.HandlerFunc(server.listConfigChanges))
+	g.GET("/:id", echo.HandlerFunc(server.getConfigChange))
+	g.POST("/:id/approve", echo.HandlerFunc(server.approveConfigChange))
+	g.POST("/:id/reject", echo.HandlerFunc(server.rejectConfigChange))
+}
+
+func (server *Server) registerConfigWebhookAPIs(g *echo.Group) {
+	g.GET("", echo.HandlerFunc(server.listConfigWebhooks))
+	g.POST("", echo.HandlerFunc(server.newConfigWebhook))
+	g.DELETE("/:id", echo.HandlerFunc(server.deleteConfigWebhook))
+	g.GET("/:id/deliveries", echo.HandlerFunc(server.listConfigWebhookDeliveries))
+}
+
+func (server *Server) registerConfigFreezeAPIs(g *echo.Group) {
+	g.GET("", echo.HandlerFunc(server.listConfigFreezes))
+	g.POST("", echo.HandlerFunc(server.newConfigFreeze))
+	g.DELETE("/:id", echo.HandlerFunc(server.deleteConfigFreeze))
+}
+
+func (server *Server) registerConfigReportAPIs(g *echo.Group) {
+	g.GET("/unused", echo.HandlerFunc(server.listUnusedConfigs))
+	g.POST("/unused/archive", echo.HandlerFunc(server.archiveUnusedConfigs))
+}
+
+func (server *Server) registerPermAPIs(g *echo.Group) {
+	g.GET("", echo.HandlerFunc(server.listPerms))
+	g.POST("", echo.HandlerFunc(server.grantPerm))
+	g.DELETE("/:id", echo.HandlerFunc(server.revokePerm))
+	g.GET("/audits", echo.HandlerFunc(server.listPermAudits))
+	g.GET("/explain", echo.HandlerFunc(server.explainPerm))
+}
+
+func (server *Server) registerGroupAPIs(g *echo.Group) {
+	g.GET("", echo.HandlerFunc(server.listGroups))
+	g.PUT("", echo.HandlerFunc(server.newGroup))
+	g.GET("/:name", echo.HandlerFunc(server.getGroup))
+	g.DELETE("/:name", echo.HandlerFunc(server.deleteGroup))
+	g.PUT("/:name/members/:app", echo.HandlerFunc(server.addGroupMember))
+	g.DELETE("/:name/members/:app", echo.HandlerFunc(server.removeGroupMember))
+}
+
 func (server *Server) registerAppAPIs(g *echo.Group) {
 	g.GET("/:name/cert", echo.HandlerFunc(server.getAppCert))
+	g.POST("/:name/cert/renew", echo.HandlerFunc(server.renewAppCert))
+	g.GET("/:name/key", echo.HandlerFunc(server.getAppKey))
+	g.POST("/:name/keystore", echo.HandlerFunc(server.getAppKeyStore))
+	g.GET("/:name/certs", echo.HandlerFunc(server.listAppCerts))
+	g.POST("/:name/certs/:serial/revoke", echo.HandlerFunc(server.revokeAppCert))
 	g.GET("/:name/nodes", echo.HandlerFunc(server.watchAppNodes))
 	g.GET("/:name/online", echo.HandlerFunc(server.isAppNodeOnline))
+	g.POST("/:name/disable", echo.HandlerFunc(server.disableApp))
+	g.POST("/:name/enable", echo.HandlerFunc(server.enableApp))
 	g.GET("", echo.HandlerFunc(server.listApp))
 	g.PUT("", echo.HandlerFunc(server.newApp))
 }
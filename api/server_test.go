@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/infrmods/xbus/apps"
+)
+
+func TestCheckPerm(t *testing.T) {
+	db, mock := newMockDB(t)
+	server := newTestServer(t, db, mock)
+	foo := &apps.App{ID: 1, Name: "foo"}
+	deny := apps.Perm{ID: 2, Deny: true, Content: "foo.secret."}
+
+	cases := []struct {
+		name    string
+		allowed bool
+	}{
+		{"foo.keya", true},
+		{"foo.secret.keya", false},
+		{"bar.keya", false},
+	}
+	for _, c := range cases {
+		expectAppPerms(mock, apps.PermTypeConfig, 1, deny)
+		ctx, _ := newTestContext(server, http.MethodGet, nil, foo)
+		ok, err := server.checkPerm(ctx, apps.PermTypeConfig, false, c.name)
+		if err != nil {
+			t.Fatalf("check perm fail: %v", err)
+		}
+		if ok != c.allowed {
+			t.Errorf("perm of %s should be %v", c.name, c.allowed)
+		}
+	}
+	checkMockDB(t, mock)
+}
@@ -6,12 +6,14 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"database/sql"
+	"fmt"
 	"math/big"
 	"net"
 	"os"
 	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/coreos/etcd/clientv3"
 	"github.com/gocomm/dbutil"
@@ -78,6 +80,17 @@ type Config struct {
 	KeyPrefix             string `default:"/apps" yaml:"key_prefix"`
 	DumpKeyCertDir        string `yaml:"dump_keycert_dir"`
 	DumpKeyCertWithAppDir bool   `default:"true" yaml:"dump_keycert_with_appdir"`
+
+	DisableServerKey       bool          `yaml:"disable_server_key"`
+	MasterKey              string        `yaml:"master_key"`      // base64 encoded aes-256 key encrypts private keys
+	MasterKeyFile          string        `yaml:"master_key_file"` // file contains base64 encoded master key
+	CertGracePeriod        time.Duration `default:"168h" yaml:"cert_grace_period"`
+	CRLValidity            time.Duration `default:"24h" yaml:"crl_validity"`
+	RevokedRefreshInterval time.Duration `default:"1m" yaml:"revoked_refresh_interval"`
+	CertExpiryWarnDays     int           `default:"30" yaml:"cert_expiry_warn_days"`
+	CertExpiryInterval     time.Duration `default:"1h" yaml:"cert_expiry_interval"`
+	PermRefreshInterval    time.Duration `default:"1m" yaml:"perm_refresh_interval"`
+	RequestTimeout         time.Duration `default:"5s" yaml:"request_timeout"`
 }
 
 // AppCtrl app ctrl
@@ -86,6 +99,10 @@ type AppCtrl struct {
 	db           *sql.DB
 	CertsManager *CertsCtrl
 	etcdClient   *clientv3.Client
+	keyCipher    *KeyCipher
+
+	revoked   revocationList
+	permCache permCache
 }
 
 // NewAppCtrl new app ctrl
@@ -94,7 +111,15 @@ func NewAppCtrl(config *Config, db *sql.DB, etcdClient *clientv3.Client) (*AppCt
 	if err != nil {
 		return nil, err
 	}
-	return &AppCtrl{config: config, db: db, CertsManager: certs, etcdClient: etcdClient}, nil
+	keyCipher, err := LoadKeyCipher(config.MasterKey, config.MasterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	ctrl := &AppCtrl{config: config, db: db, CertsManager: certs, etcdClient: etcdClient, keyCipher: keyCipher}
+	if err := ctrl.reloadRevoked(); err != nil {
+		return nil, fmt.Errorf("load revoked certs fail: %v", err)
+	}
+	return ctrl, nil
 }
 
 // GetAppCertPool get app certPool
@@ -104,17 +129,33 @@ func (ctrl *AppCtrl) GetAppCertPool() *x509.CertPool {
 
 var rAppName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-_]+$`)
 
-// NewApp new app
-func (ctrl *AppCtrl) NewApp(app *App, key crypto.Signer, dnsNames []string, ips []net.IP, days int) (crypto.Signer, error) {
+func checkNewApp(app *App) error {
 	if !rAppName.MatchString(app.Name) {
-		return nil, utils.Errorf(utils.EcodeInvalidName, "invalid app name: %s", app.Name)
+		return utils.Errorf(utils.EcodeInvalidName, "invalid app name: %s", app.Name)
 	}
 	lowerName := strings.ToLower(app.Name)
 	for _, name := range []string{"public", "global", "app", "xbus", "null", "unknown"} {
 		if lowerName == name {
-			return nil, utils.Errorf(utils.EcodeInvalidName, "reserved name: %s", app.Name)
+			return utils.Errorf(utils.EcodeInvalidName, "reserved name: %s", app.Name)
 		}
 	}
+	if app.Env != "" && !utils.IsValidEnv(app.Env) {
+		return utils.Errorf(utils.EcodeInvalidEnv, "invalid env: %s", app.Env)
+	}
+	return nil
+}
+
+// errServerKeyGenDisabled server side key generation disabled error
+var errServerKeyGenDisabled = utils.NewError(utils.EcodeNotPermitted, "server-held private key is disabled, enroll with csr")
+
+// NewApp new app
+func (ctrl *AppCtrl) NewApp(app *App, key crypto.Signer, dnsNames []string, ips []net.IP, days int) (crypto.Signer, error) {
+	if ctrl.config.DisableServerKey {
+		return nil, errServerKeyGenDisabled
+	}
+	if err := checkNewApp(app); err != nil {
+		return nil, err
+	}
 
 	var err error
 	if key == nil {
@@ -139,21 +180,39 @@ func (ctrl *AppCtrl) NewApp(app *App, key crypto.Signer, dnsNames []string, ips
 		glog.Errorf("encode private key to pem fail: %v", err)
 		return nil, utils.NewSystemError("encode private key pem fail")
 	}
-	app.PrivateKey = data
+	if app.PrivateKey, err = ctrl.encryptKey(data); err != nil {
+		glog.Errorf("encrypt private key fail: %v", err)
+		return nil, utils.NewSystemError("encrypt private key fail")
+	}
 
+	if err := ctrl.insertApp(app); err != nil {
+		return nil, err
+	}
+	ctrl.dumpKeyCert(app, data)
+	return key, nil
+}
+
+func (ctrl *AppCtrl) insertApp(app *App) error {
 	if err := InsertApp(ctrl.db, app); err != nil {
 		if err == dbutil.ZeroEffected {
-			return nil, utils.NewError(utils.EcodeNameDuplicated, "name duplicated")
+			return utils.NewError(utils.EcodeNameDuplicated, "name duplicated")
 		}
 
 		glog.Errorf("insert app(%s) fail: %v", app.Name, err)
-		return nil, utils.NewSystemError("create app fail")
+		return utils.NewSystemError("create app fail")
 	}
-	ctrl.dumpKeyCert(app, key)
-	return key, nil
+	ctrl.permsChanged("new app: " + app.Name)
+	if cert, err := newAppCert(app.ID, app.Cert); err == nil {
+		if err := insertAppCert(ctrl.db, cert); err != nil {
+			glog.Warningf("insert app(%s) cert history fail: %v", app.Name, err)
+		}
+	} else {
+		glog.Warningf("parse app(%s) cert fail: %v", app.Name, err)
+	}
+	return nil
 }
 
-func (ctrl *AppCtrl) dumpKeyCert(app *App, key crypto.Signer) {
+func (ctrl *AppCtrl) dumpKeyCert(app *App, keyPem string) {
 	if ctrl.config.DumpKeyCertDir != "" {
 		dir := ctrl.config.DumpKeyCertDir
 		if ctrl.config.DumpKeyCertWithAppDir {
@@ -165,8 +224,10 @@ func (ctrl *AppCtrl) dumpKeyCert(app *App, key crypto.Signer) {
 				return
 			}
 		}
-		if err := utils.WriteFile(path.Join(dir, app.Name+"key.pem"), 0600, []byte(app.PrivateKey)); err != nil {
-			glog.Warningf("dump key(%s) fail: %v", app.Name, err)
+		if keyPem != "" {
+			if err := utils.WriteFile(path.Join(dir, app.Name+"key.pem"), 0600, []byte(keyPem)); err != nil {
+				glog.Warningf("dump key(%s) fail: %v", app.Name, err)
+			}
 		}
 		if err := utils.WriteFile(path.Join(dir, app.Name+"cert.pem"), 0644, []byte(app.Cert)); err != nil {
 			glog.Warningf("dump cert(%s) fail: %v", app.Name, err)
@@ -178,24 +239,16 @@ func (ctrl *AppCtrl) dumpKeyCert(app *App, key crypto.Signer) {
 func (ctrl *AppCtrl) GetPerms(typ int, appName *string, groupName *string, canWrite *bool, prefix *string) ([]Perm, error) {
 	var targetType *int
 	var targetID *int64
-	if appName != nil {
-		if app, err := GetAppByName(ctrl.db, *appName); err == nil {
-			t := PermTargetApp
-			targetType = &t
-			targetID = &app.ID
-		} else {
-			glog.Errorf("get app(%s) fail: %v", *appName, err)
-			return nil, utils.NewSystemError("get app fail")
+	if appName != nil || groupName != nil {
+		t, name := PermTargetApp, appName
+		if appName == nil {
+			t, name = PermTargetGroup, groupName
 		}
-	} else if groupName != nil {
-		if group, err := GetGroupByName(ctrl.db, *groupName); err == nil {
-			t := PermTargetGroup
-			targetType = &t
-			targetID = &group.ID
-		} else {
-			glog.Errorf("get group(%s) fail: %v", *groupName, err)
-			return nil, utils.NewSystemError("get group fail")
+		id, err := ctrl.PermTarget(t, *name)
+		if err != nil {
+			return nil, err
 		}
+		targetType, targetID = &t, &id
 	}
 
 	perms, err := GetPerms(ctrl.db, typ, targetType, targetID, canWrite, prefix)
@@ -226,8 +279,13 @@ func (ctrl *AppCtrl) ListApp(skip, limit int) ([]App, error) {
 	return apps, nil
 }
 
-// GetAppGroupByName get app group byname
+// GetAppGroupByName get app group byname, from perm snapshot if loaded
 func (ctrl *AppCtrl) GetAppGroupByName(name string) (*App, []int64, error) {
+	if snapshot := ctrl.permSnapshot(); snapshot != nil {
+		if app, groupIDs := snapshot.appGroup(name); app != nil {
+			return app, groupIDs, nil
+		}
+	}
 	app, groupIDs, err := GetAppGroupByName(ctrl.db, name)
 	if err != nil {
 		glog.Errorf("get app&group(%s) fail: %v", name, err)
@@ -238,7 +296,11 @@ func (ctrl *AppCtrl) GetAppGroupByName(name string) (*App, []int64, error) {
 
 // NewGroup new group
 func (ctrl *AppCtrl) NewGroup(group *Group) error {
+	if !rAppName.MatchString(group.Name) {
+		return utils.Errorf(utils.EcodeInvalidName, "invalid group name: %s", group.Name)
+	}
 	if err := InsertGroup(ctrl.db, group); err == nil {
+		ctrl.permsChanged("new group: " + group.Name)
 		return nil
 	} else if err == dbutil.ZeroEffected {
 		return utils.NewError(utils.EcodeNameDuplicated, "name duplicated")
@@ -261,9 +323,13 @@ func (ctrl *AppCtrl) GetGroupByName(name string) (*Group, error) {
 // AddGroupMember add group member
 func (ctrl *AppCtrl) AddGroupMember(groupID, appID int64) error {
 	if err := NewGroupMember(ctrl.db, groupID, appID); err != nil {
+		if err == dbutil.ZeroEffected {
+			return utils.NewError(utils.EcodeNameDuplicated, "member exists")
+		}
 		glog.Errorf("add group member(group: %d, app: %d) fail: %v", groupID, appID, err)
 		return utils.NewSystemError("add member fail")
 	}
+	ctrl.permsChanged("add group member")
 	return nil
 }
 
@@ -277,38 +343,47 @@ func (ctrl *AppCtrl) GetGroupMembers(groupID int64) ([]App, error) {
 	return apps, nil
 }
 
-// NewGroupPerm new group perm
-func (ctrl *AppCtrl) NewGroupPerm(permType int, groupID int64, canWrite bool, content string) (int64, error) {
-	perm := Perm{PermType: permType, TargetType: PermTargetGroup,
-		TargetID: groupID, CanWrite: canWrite, Content: content}
-	err := InsertPerm(ctrl.db, &perm)
+// HasAnyPrefixPerm has any prefix perm, evaluated with perm snapshot if loaded
+func (ctrl *AppCtrl) HasAnyPrefixPerm(typ int, appID int64, groupIDs []int64, needWrite bool, content string) (bool, error) {
+	perms, err := ctrl.appPerms(typ, appID, groupIDs)
 	if err != nil {
-		glog.Errorf("new group perm fail: %v", err)
-		return 0, utils.NewSystemError("new group perm fail")
+		glog.Errorf("get hasAnyPrefixPerm(type:%d, app:%d, groups:%v, needWrite:%v, content:%v) fail: %v",
+			typ, appID, groupIDs, needWrite, content, err)
+		return false, utils.NewSystemError("get perm fail")
 	}
-	return perm.ID, nil
+	return EvalPerms(perms, needWrite, content), nil
 }
 
-// NewAppPerm new app perm
-func (ctrl *AppCtrl) NewAppPerm(permType int, appID int64, canWrite bool, content string) (int64, error) {
-	perm := Perm{PermType: permType, TargetType: PermTargetApp,
-		TargetID: appID, CanWrite: canWrite, Content: content}
-	if err := InsertPerm(ctrl.db, &perm); err != nil {
-		glog.Errorf("new app perm fail: %v", err)
-		return 0, utils.NewSystemError("new app perm fail")
+// HasPermAdminPerm has perm admin perm to grant/revoke content, content must be covered by
+// an allowed perm admin perm and overlaps no denied one
+func (ctrl *AppCtrl) HasPermAdminPerm(appID int64, groupIDs []int64, content string) (bool, error) {
+	perms, err := ctrl.appPerms(PermTypePermAdmin, appID, groupIDs)
+	if err != nil {
+		glog.Errorf("get perm admin perms(app:%d, groups:%v) of %s fail: %v", appID, groupIDs, content, err)
+		return false, utils.NewSystemError("get perm fail")
 	}
-	return perm.ID, nil
+	return evalGrantPerms(perms, content), nil
 }
 
-// HasAnyPrefixPerm has any prefix perm
-func (ctrl *AppCtrl) HasAnyPrefixPerm(typ int, appID int64, groupIDs []int64, needWrite bool, content string) (bool, error) {
-	has, err := HasAnyPrefixPerm(ctrl.db, typ, appID, groupIDs, needWrite, content)
+// HasPerm has perm of name, names of app's own prefix are allowed unless denied explicitly;
+// anonymous(nil app) is never permitted to write
+func (ctrl *AppCtrl) HasPerm(typ int, app *App, groupIDs []int64, needWrite bool, name string) (bool, error) {
+	appID := int64(PermPublicTargetID)
+	if app != nil {
+		appID = app.ID
+	} else if needWrite {
+		return false, nil
+	}
+	perms, err := ctrl.appPerms(typ, appID, groupIDs)
 	if err != nil {
-		glog.Errorf("get hasAnyPrefixPerm(type:%d, app:%d, groups:%v, needWrite:%v, content:%v) fail: %v",
-			typ, appID, groupIDs, needWrite, content, err)
+		glog.Errorf("get perms(type:%d, app:%d, groups:%v) of %s fail: %v", typ, appID, groupIDs, name, err)
 		return false, utils.NewSystemError("get perm fail")
 	}
-	return has, nil
+	allowed, decisive := evalPerms(perms, needWrite, name)
+	if decisive >= 0 && !allowed {
+		return false, nil
+	}
+	return allowed || (app != nil && strings.HasPrefix(name, app.Name+".")), nil
 }
 
 // AppNode app node
@@ -0,0 +1,228 @@
+package apps
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"net"
+	"time"
+
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// AppCert app cert history table, expire time of the current cert is null,
+// replaced certs are accepted until expire time(grace period)
+type AppCert struct {
+	ID         int64      `json:"id"`
+	AppID      int64      `json:"app_id"`
+	SerialNo   string     `json:"serial_no"`
+	Cert       string     `json:"cert"`
+	NotAfter   time.Time  `json:"not_after"`
+	ExpireTime *time.Time `json:"expire_time"`
+	CreateTime time.Time  `json:"create_time"`
+}
+
+// Valid is cert accepted at t
+func (cert *AppCert) Valid(t time.Time) bool {
+	if cert.ExpireTime != nil && !t.Before(*cert.ExpireTime) {
+		return false
+	}
+	return t.Before(cert.NotAfter)
+}
+
+func newAppCert(appID int64, certPem string) (*AppCert, error) {
+	cert, err := utils.DecodeCertificateFromPem(certPem)
+	if err != nil {
+		return nil, err
+	}
+	return &AppCert{AppID: appID, SerialNo: cert.SerialNumber.String(), Cert: certPem, NotAfter: cert.NotAfter}, nil
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAppCert insert app cert, ignored if exists
+func insertAppCert(tx execer, cert *AppCert) error {
+	_, err := tx.Exec(`insert ignore into app_certs(app_id, serial_no, cert, not_after, expire_time)
+                       values(?, ?, ?, ?, ?)`, cert.AppID, cert.SerialNo, cert.Cert, cert.NotAfter, cert.ExpireTime)
+	return err
+}
+
+// GetAppCertBySerial get app cert by serial no
+func GetAppCertBySerial(db *sql.DB, appID int64, serialNo string) (*AppCert, error) {
+	var cert AppCert
+	if err := dbutil.Query(db, &cert,
+		`select * from app_certs where app_id=? and serial_no=?`, appID, serialNo); err == nil {
+		return &cert, nil
+	} else if err == sql.ErrNoRows {
+		return nil, nil
+	} else {
+		return nil, err
+	}
+}
+
+// ListGraceAppCerts list replaced app certs still accepted at t
+func ListGraceAppCerts(db *sql.DB, t time.Time) ([]AppCert, error) {
+	var certs []AppCert
+	if err := dbutil.Query(db, &certs,
+		`select * from app_certs where expire_time>? and not_after>?`, t, t); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// ListAppCerts list app certs, latest first
+func ListAppCerts(db *sql.DB, appID int64) ([]AppCert, error) {
+	var certs []AppCert
+	if err := dbutil.Query(db, &certs, `select * from app_certs where app_id=? order by id desc`, appID); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// RenewCert issue new cert for app, existing key is used if key is nil(new key is rejected if
+// DisableServerKey), dns names & ips of the current cert are kept if nil;
+// the current cert is accepted in the grace period
+func (ctrl *AppCtrl) RenewCert(app *App, key crypto.Signer, dnsNames []string, ips []net.IP, days int) (crypto.Signer, error) {
+	var err error
+	if key != nil {
+		if ctrl.config.DisableServerKey {
+			return nil, errServerKeyGenDisabled
+		}
+	} else {
+		if app.PrivateKey == "" {
+			return nil, utils.Errorf(utils.EcodeInvalidStatus, "app(%s) has no server-held private key", app.Name)
+		}
+		keyPem, err := ctrl.PrivateKey(app)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = utils.DecodePrivateKeyFromPem(keyPem); err != nil {
+			glog.Errorf("decode app(%s) private key fail: %v", app.Name, err)
+			return nil, utils.NewSystemError("decode private key fail")
+		}
+	}
+	keyPem, err := utils.EncodePrivateKeyToPem(key)
+	if err != nil {
+		glog.Errorf("encode private key to pem fail: %v", err)
+		return nil, utils.NewSystemError("encode private key pem fail")
+	}
+	if err := ctrl.renewCert(app, key.Public(), keyPem, dnsNames, ips, days); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// renewCert issue new cert of pubkey, app's private key is replaced by keyPem(plain)
+func (ctrl *AppCtrl) renewCert(app *App, pubkey crypto.PublicKey, keyPem string,
+	dnsNames []string, ips []net.IP, days int) error {
+	current, err := utils.DecodeCertificateFromPem(app.Cert)
+	if err != nil {
+		glog.Errorf("parse app(%s) cert fail: %v", app.Name, err)
+		return utils.NewSystemError("parse app cert fail")
+	}
+	if dnsNames == nil && ips == nil {
+		dnsNames, ips = current.DNSNames, current.IPAddresses
+	}
+
+	name := pkix.Name{CommonName: app.Name,
+		Organization: []string{ctrl.config.Organization}}
+	certPem, err := ctrl.CertsManager.NewCert(pubkey, name, dnsNames, ips, days)
+	if err != nil {
+		glog.Errorf("generate cert fail: %v", err)
+		return utils.NewSystemError("generate cert fail")
+	}
+	newCert, err := newAppCert(app.ID, string(certPem))
+	if err != nil {
+		glog.Errorf("parse new cert fail: %v", err)
+		return utils.NewSystemError("generate cert fail")
+	}
+
+	storedKey, err := ctrl.encryptKey(keyPem)
+	if err != nil {
+		glog.Errorf("encrypt private key fail: %v", err)
+		return utils.NewSystemError("encrypt private key fail")
+	}
+
+	expireTime := time.Now().Add(ctrl.config.CertGracePeriod)
+	oldCert := &AppCert{AppID: app.ID, SerialNo: current.SerialNumber.String(), Cert: app.Cert,
+		NotAfter: current.NotAfter, ExpireTime: &expireTime}
+	if err := ctrl.replaceAppCert(app, oldCert, newCert, storedKey); err != nil {
+		glog.Errorf("replace app(%s) cert fail: %v", app.Name, err)
+		return utils.NewSystemError("update app cert fail")
+	}
+	app.Cert = newCert.Cert
+	app.PrivateKey = storedKey
+	app.certificate = nil
+	ctrl.permsChanged("renew cert: " + app.Name)
+	ctrl.dumpKeyCert(app, keyPem)
+	return nil
+}
+
+func (ctrl *AppCtrl) replaceAppCert(app *App, oldCert, newCert *AppCert, storedKey string) (rerr error) {
+	tx, err := ctrl.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr != nil {
+			if err := tx.Rollback(); err != nil {
+				glog.Warningf("tx rollback fail: %v", err)
+			}
+		}
+	}()
+
+	// certs issued before history exists are recorded on first renewal
+	if err := insertAppCert(tx, oldCert); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`update app_certs set expire_time=? where app_id=? and expire_time is null`,
+		oldCert.ExpireTime, app.ID); err != nil {
+		return err
+	}
+	if err := insertAppCert(tx, newCert); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`update apps set cert=?, private_key=?, modify_time=now() where id=?`,
+		newCert.Cert, storedKey, app.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyAppCert is cert the current cert of app or a replaced one in grace period,
+// replaced certs are checked by perm snapshot if loaded
+func (ctrl *AppCtrl) VerifyAppCert(app *App, cert *x509.Certificate) (bool, error) {
+	if block, _ := pem.Decode([]byte(app.Cert)); block != nil && bytes.Equal(block.Bytes, cert.Raw) {
+		return true, nil
+	}
+	if snapshot := ctrl.permSnapshot(); snapshot != nil {
+		appCert, ok := snapshot.graceCert(app.ID, cert.SerialNumber.String())
+		return ok && appCert.Valid(time.Now()), nil
+	}
+	appCert, err := GetAppCertBySerial(ctrl.db, app.ID, cert.SerialNumber.String())
+	if err != nil {
+		glog.Errorf("get app(%s) cert(%s) fail: %v", app.Name, cert.SerialNumber, err)
+		return false, utils.NewSystemError("get app cert fail")
+	}
+	return appCert != nil && appCert.Valid(time.Now()), nil
+}
+
+// ListAppCerts list certs issued to app
+func (ctrl *AppCtrl) ListAppCerts(appID int64) ([]AppCert, error) {
+	certs, err := ListAppCerts(ctrl.db, appID)
+	if err != nil {
+		glog.Errorf("list app(%d) certs fail: %v", appID, err)
+		return nil, utils.NewSystemError("list app certs fail")
+	}
+	if certs == nil {
+		certs = make([]AppCert, 0)
+	}
+	return certs, nil
+}
@@ -0,0 +1,166 @@
+package apps
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+var appCertColumns = []string{"id", "app_id", "serial_no", "cert", "not_after", "expire_time", "create_time"}
+
+func TestAppCertValid(t *testing.T) {
+	now := time.Now()
+	before, after := now.Add(-time.Minute), now.Add(time.Minute)
+	cases := []struct {
+		notAfter   time.Time
+		expireTime *time.Time
+		valid      bool
+	}{
+		{after, nil, true},
+		{before, nil, false},
+		{after, &after, true},
+		{after, &before, false},
+		{after, &now, false},
+		{before, &after, false},
+	}
+	for i, c := range cases {
+		cert := AppCert{NotAfter: c.notAfter, ExpireTime: c.expireTime}
+		if cert.Valid(now) != c.valid {
+			t.Errorf("case %d: expect valid %v", i, c.valid)
+		}
+	}
+}
+
+func TestRenewCert(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	app := newTestApp(t, ctrl, 1, "foo")
+	oldPem := app.Cert
+	old, err := utils.DecodeCertificateFromPem(oldPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin().WillReturnError(sqlmock.ErrCancelled)
+	if _, err := ctrl.RenewCert(app, key, nil, nil, 1); errCode(err) != utils.EcodeSystemError || app.Cert != oldPem {
+		t.Fatalf("expect system error & cert unchanged, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert ignore into app_certs`).
+		WithArgs(1, old.SerialNumber.String(), oldPem, old.NotAfter, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`update app_certs set expire_time=\?`).WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert ignore into app_certs`).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(`update apps set cert=\?`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if _, err := ctrl.RenewCert(app, key, nil, nil, 1); err != nil {
+		t.Fatalf("renew cert fail: %v", err)
+	}
+	current, err := utils.DecodeCertificateFromPem(app.Cert)
+	if err != nil || current.SerialNumber.Cmp(old.SerialNumber) == 0 || current.Subject.CommonName != "foo" {
+		t.Fatalf("unexpected renewed cert: %v", err)
+	}
+	if ok, err := ctrl.VerifyAppCert(app, current); err != nil || !ok {
+		t.Errorf("verify current cert fail: %v, %v", ok, err)
+	}
+
+	// replaced cert is checked by db until perm snapshot loaded
+	expire := time.Now().Add(time.Hour)
+	mock.ExpectQuery(`select \* from app_certs where app_id=\? and serial_no=\?`).
+		WithArgs(1, old.SerialNumber.String()).WillReturnRows(sqlmock.NewRows(appCertColumns).
+		AddRow(1, 1, old.SerialNumber.String(), oldPem, old.NotAfter, expire, time.Now()))
+	if ok, err := ctrl.VerifyAppCert(app, old); err != nil || !ok {
+		t.Errorf("verify replaced cert fail: %v, %v", ok, err)
+	}
+	mock.ExpectQuery(`select \* from app_certs`).WillReturnError(sqlmock.ErrCancelled)
+	if _, err := ctrl.VerifyAppCert(app, old); errCode(err) != utils.EcodeSystemError {
+		t.Errorf("expect system error, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestVerifyGraceCert(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	app := newTestApp(t, ctrl, 1, "foo")
+	other := newTestApp(t, ctrl, 2, "bar")
+	replaced, err := utils.DecodeCertificateFromPem(newTestApp(t, ctrl, 1, "foo").Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := utils.DecodeCertificateFromPem(newTestApp(t, ctrl, 1, "foo").Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	expire, past := now.Add(time.Hour), now.Add(-time.Minute)
+	ctrl.permCache.snapshot = newPermSnapshot(nil, nil, nil, nil, []AppCert{
+		{AppID: 1, SerialNo: replaced.SerialNumber.String(), NotAfter: replaced.NotAfter, ExpireTime: &expire},
+		{AppID: 1, SerialNo: expired.SerialNumber.String(), NotAfter: expired.NotAfter, ExpireTime: &past},
+	})
+	for _, c := range []struct {
+		app   *App
+		cert  string
+		valid bool
+	}{
+		{app, "replaced", true},
+		{app, "expired", false},
+		{other, "replaced", false},
+	} {
+		cert := replaced
+		if c.cert == "expired" {
+			cert = expired
+		}
+		if ok, err := ctrl.VerifyAppCert(c.app, cert); err != nil || ok != c.valid {
+			t.Errorf("verify %s cert of %s expect %v, got %v, %v", c.cert, c.app.Name, c.valid, ok, err)
+		}
+	}
+	// no db queries once snapshot loaded
+	checkMockDB(t, mock)
+}
+
+func TestRenewCertSameKey(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.config.DisableServerKey = true
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem, err := utils.EncodePrivateKeyToPem(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApp(t, ctrl, 1, "foo")
+	app.PrivateKey = keyPem
+
+	// existing server-held key is reused, no key generated
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert ignore into app_certs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`update app_certs set expire_time=\?`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert ignore into app_certs`).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(`update apps set cert=\?`).WithArgs(sqlmock.AnyArg(), keyPem, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if _, err := ctrl.RenewCert(app, nil, nil, nil, 1); err != nil {
+		t.Fatalf("renew cert with same key fail: %v", err)
+	}
+	cert, err := utils.DecodeCertificateFromPem(app.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(cert.PublicKey) {
+		t.Errorf("expect cert of the same key")
+	}
+	checkMockDB(t, mock)
+}
@@ -1,6 +1,7 @@
 package apps
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
 	"crypto/x509"
@@ -20,20 +21,30 @@ type SerialGenerator interface {
 	Generate() (*big.Int, error)
 }
 
-// CertsConfig certs config
+// CertsConfig certs config; root rotation is phased:
+// add the new root to trusted roots, switch root cert/key to the new root(or its intermediate),
+// then remove the old root from trusted roots after app certs are renewed
 type CertsConfig struct {
-	RootCert string `default:"rootcert.pem"`
-	RootKey  string `default:"rootkey.pem"`
+	RootCert     string   `default:"rootcert.pem"` // signing ca cert, root or intermediate
+	RootKey      string   `default:"rootkey.pem"`
+	ChainCerts   string   `yaml:"chain_certs"`   // ca certs between signing cert and root, returned with issued certs
+	TrustedRoots []string `yaml:"trusted_roots"` // extra trusted root certs
 }
 
 // CertsCtrl certs ctrl
 type CertsCtrl struct {
 	rootCert        *x509.Certificate
 	rootKey         crypto.Signer
+	chain           []*x509.Certificate
+	trustedRoots    []*x509.Certificate
 	config          *CertsConfig
 	serialGenerator SerialGenerator
 }
 
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
 // NewCertsCtrl new certs ctrl
 func NewCertsCtrl(config *CertsConfig, serialGenerator SerialGenerator) (*CertsCtrl, error) {
 	certBlock, err := utils.ReadPEM(config.RootCert)
@@ -50,43 +61,87 @@ func NewCertsCtrl(config *CertsConfig, serialGenerator SerialGenerator) (*CertsC
 		return nil, err
 	}
 
-	var signer crypto.Signer
-	switch keyBlock.Type {
-	case "RSA PRIVATE KEY":
-		if privKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes); err == nil {
-			signer = privKey
-		} else {
-			return nil, fmt.Errorf("parse root key(rsa) fail: %v", err)
-		}
-	case "EC PRIVATE KEY":
-		if privKey, err := x509.ParseECPrivateKey(keyBlock.Bytes); err == nil {
-			signer = privKey
-		} else {
-			return nil, fmt.Errorf("parse root key(ec) fail: %v", err)
-		}
-	case "PRIVATE KEY":
-		if privKey, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes); err == nil {
-			signer = privKey.(crypto.Signer)
-		} else {
-			return nil, fmt.Errorf("parse root key(pkcs8) fail: %v", err)
-		}
-	default:
-		return nil, fmt.Errorf("unsupported key type: %s", keyBlock.Type)
+	signer, err := utils.ParsePrivateKey(keyBlock)
+	if err != nil {
+		return nil, fmt.Errorf("parse root key fail: %v", err)
 	}
 
 	mgr := &CertsCtrl{rootCert: cert, rootKey: signer,
 		config: config, serialGenerator: serialGenerator}
+	if isSelfSigned(cert) {
+		mgr.trustedRoots = append(mgr.trustedRoots, cert)
+	} else {
+		mgr.chain = append(mgr.chain, cert)
+	}
+	if config.ChainCerts != "" {
+		certs, err := utils.ReadPEMCertificates(config.ChainCerts)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			if isSelfSigned(cert) {
+				mgr.trustedRoots = append(mgr.trustedRoots, cert)
+			} else {
+				mgr.chain = append(mgr.chain, cert)
+			}
+		}
+	}
+	for _, path := range config.TrustedRoots {
+		certs, err := utils.ReadPEMCertificates(path)
+		if err != nil {
+			return nil, err
+		}
+		mgr.trustedRoots = append(mgr.trustedRoots, certs...)
+	}
+	if err := mgr.verifySigner(); err != nil {
+		return nil, err
+	}
 	return mgr, nil
 }
 
-// CertPool cert poll
+// verifySigner verify signing cert chains to a trusted root
+func (mgr *CertsCtrl) verifySigner() error {
+	roots := x509.NewCertPool()
+	for _, cert := range mgr.trustedRoots {
+		roots.AddCert(cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range mgr.chain {
+		intermediates.AddCert(cert)
+	}
+	if _, err := mgr.rootCert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return fmt.Errorf("verify signing cert(%s) fail: %v", mgr.rootCert.Subject.CommonName, err)
+	}
+	return nil
+}
+
+// CertPool cert pool of trusted roots, app certs signed by intermediate must be presented with chain
 func (mgr *CertsCtrl) CertPool() *x509.CertPool {
 	pool := x509.NewCertPool()
-	pool.AddCert(mgr.rootCert)
+	for _, cert := range mgr.trustedRoots {
+		pool.AddCert(cert)
+	}
 	return pool
 }
 
-// NewCert new cert
+// TrustedRoots trusted root certs
+func (mgr *CertsCtrl) TrustedRoots() []*x509.Certificate {
+	return mgr.trustedRoots
+}
+
+// CACerts signing cert, chain & trusted roots
+func (mgr *CertsCtrl) CACerts() []*x509.Certificate {
+	certs := []*x509.Certificate{mgr.rootCert}
+	for _, cert := range append(append([]*x509.Certificate{}, mgr.chain...), mgr.trustedRoots...) {
+		if !cert.Equal(mgr.rootCert) {
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// NewCert new cert, pem of the cert followed by the chain
 func (mgr *CertsCtrl) NewCert(pubkey crypto.PublicKey, subject pkix.Name,
 	dnsNames []string, ips []net.IP, days int) ([]byte, error) {
 	serialNumber, err := mgr.serialGenerator.Generate()
@@ -113,5 +168,26 @@ func (mgr *CertsCtrl) NewCert(pubkey crypto.PublicKey, subject pkix.Name,
 		glog.Errorf("create cert fail: %v", err)
 		return nil, utils.NewSystemError("create cert fail")
 	}
-	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: data}), nil
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: data})
+	for _, cert := range mgr.chain {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return certPem, nil
+}
+
+// NewCRL new der encoded crl signed by root
+func (mgr *CertsCtrl) NewCRL(entries []x509.RevocationListEntry, number *big.Int,
+	thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	template := x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    number,
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                nextUpdate,
+	}
+	data, err := x509.CreateRevocationList(rand.Reader, &template, mgr.rootCert, mgr.rootKey)
+	if err != nil {
+		glog.Errorf("create crl fail: %v", err)
+		return nil, utils.NewSystemError("create crl fail")
+	}
+	return data, nil
 }
@@ -0,0 +1,131 @@
+package apps
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/infrmods/xbus/utils"
+)
+
+type seqSerialGenerator struct {
+	n int64
+}
+
+func (g *seqSerialGenerator) Generate() (*big.Int, error) {
+	g.n++
+	return big.NewInt(g.n), nil
+}
+
+func newTestCA(t *testing.T, dir, name string, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = &template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.WriteCert(filepath.Join(dir, name+"cert.pem"), 0644, der); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.WritePrivateKey(filepath.Join(dir, name+"key.pem"), 0600, key); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestIntermediateAndTrustedRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xbus-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldRoot, oldKey := newTestCA(t, dir, "old", nil, nil)
+	newRoot, newKey := newTestCA(t, dir, "new", nil, nil)
+	newTestCA(t, dir, "int", newRoot, newKey)
+
+	// signing by intermediate requires its root trusted
+	config := CertsConfig{RootCert: filepath.Join(dir, "intcert.pem"), RootKey: filepath.Join(dir, "intkey.pem")}
+	if _, err := NewCertsCtrl(&config, &seqSerialGenerator{}); err == nil {
+		t.Fatalf("intermediate without trusted root accepted")
+	}
+	config.TrustedRoots = []string{filepath.Join(dir, "newcert.pem"), filepath.Join(dir, "oldcert.pem")}
+	mgr, err := NewCertsCtrl(&config, &seqSerialGenerator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := utils.NewPrivateKey("P256", 0)
+	certPem, err := mgr.NewCert(key.Public(), pkix.Name{CommonName: "app"}, nil, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := utils.DecodeCertificateFromPem(string(certPem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain, err := utils.DecodeCertificateFromPem(string(certPem[len(utils.EncodeToPem("CERTIFICATE", cert.Raw)):])); err != nil {
+		t.Fatalf("missing chain: %v", err)
+	} else if chain.Subject.CommonName != "int" {
+		t.Errorf("unexpected chain cert: %s", chain.Subject.CommonName)
+	}
+	if caCerts := mgr.CACerts(); len(caCerts) != 3 || caCerts[0].Subject.CommonName != "int" {
+		t.Errorf("unexpected ca certs: %d", len(caCerts))
+	}
+	app := App{Cert: string(certPem)}
+	if appCert, err := app.Certificate(); err != nil || !appCert.Equal(cert) {
+		t.Errorf("parse app cert fail: %v", err)
+	}
+	// intermediates are not trusted as roots, cert is verified with the chain issued along
+	opts := x509.VerifyOptions{Roots: mgr.CertPool(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	if _, err := cert.Verify(opts); err == nil {
+		t.Errorf("cert without chain verified")
+	}
+	certs, err := utils.DecodeCertificatesFromPem(certPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Intermediates = x509.NewCertPool()
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		t.Errorf("verify new cert fail: %v", err)
+	}
+
+	// certs issued by the old root are still trusted during rotation
+	oldMgr := &CertsCtrl{rootCert: oldRoot, rootKey: oldKey, serialGenerator: &seqSerialGenerator{n: 100}}
+	oldPem, err := oldMgr.NewCert(key.Public(), pkix.Name{CommonName: "app"}, nil, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCert, _ := utils.DecodeCertificateFromPem(string(oldPem))
+	if _, err := oldCert.Verify(opts); err != nil {
+		t.Errorf("verify old cert fail: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package apps
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// checkCSR check csr is signed by its key and issued for app
+func checkCSR(app *App, csr *x509.CertificateRequest) error {
+	if err := csr.CheckSignature(); err != nil {
+		return utils.Errorf(utils.EcodeInvalidParam, "invalid csr signature: %v", err)
+	}
+	if csr.Subject.CommonName != app.Name {
+		return utils.Errorf(utils.EcodeInvalidParam, "csr common name(%s) mismatch app name(%s)",
+			csr.Subject.CommonName, app.Name)
+	}
+	return nil
+}
+
+// NewAppWithCSR new app with cert signed from csr, the private key is held by client only;
+// dns names & ips requested by csr are ignored, the given ones are used
+func (ctrl *AppCtrl) NewAppWithCSR(app *App, csr *x509.CertificateRequest, dnsNames []string, ips []net.IP, days int) error {
+	if err := checkNewApp(app); err != nil {
+		return err
+	}
+	if err := checkCSR(app, csr); err != nil {
+		return err
+	}
+	name := pkix.Name{CommonName: app.Name,
+		Organization: []string{ctrl.config.Organization}}
+	certPem, err := ctrl.CertsManager.NewCert(csr.PublicKey, name, dnsNames, ips, days)
+	if err != nil {
+		glog.Errorf("generate cert fail: %v", err)
+		return utils.NewSystemError("generate cert fail")
+	}
+	app.Cert = string(certPem)
+	app.PrivateKey = ""
+
+	if err := ctrl.insertApp(app); err != nil {
+		return err
+	}
+	ctrl.dumpKeyCert(app, "")
+	return nil
+}
+
+// RenewCertWithCSR issue new cert for app from csr, server-held private key(if any) is dropped;
+// dns names & ips requested by csr are ignored, those of the current cert are kept if nil
+func (ctrl *AppCtrl) RenewCertWithCSR(app *App, csr *x509.CertificateRequest, dnsNames []string, ips []net.IP, days int) error {
+	if err := checkCSR(app, csr); err != nil {
+		return err
+	}
+	return ctrl.renewCert(app, csr.PublicKey, "", dnsNames, ips, days)
+}
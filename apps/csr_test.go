@@ -0,0 +1,126 @@
+package apps
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+func newTestCSR(t *testing.T, name string, dnsNames []string, ips []net.IP) (*x509.CertificateRequest, crypto.Signer) {
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name}, DNSNames: dnsNames, IPAddresses: ips}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr, key
+}
+
+func TestCheckCSR(t *testing.T) {
+	app := &App{Name: "foo"}
+	csr, _ := newTestCSR(t, "foo", nil, nil)
+	if err := checkCSR(app, csr); err != nil {
+		t.Errorf("check csr fail: %v", err)
+	}
+	if err := checkCSR(&App{Name: "bar"}, csr); errCode(err) != utils.EcodeInvalidParam {
+		t.Errorf("expect common name mismatch, got %v", err)
+	}
+	other, _ := newTestCSR(t, "foo", nil, nil)
+	csr.PublicKey = other.PublicKey
+	if err := checkCSR(app, csr); errCode(err) != utils.EcodeInvalidParam {
+		t.Errorf("expect invalid signature, got %v", err)
+	}
+}
+
+func TestNewAppWithCSR(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.config.DisableServerKey = true
+
+	// dns names & ips requested by csr are ignored
+	csr, _ := newTestCSR(t, "foo", []string{"evil.example.com"}, []net.IP{net.ParseIP("10.0.0.1")})
+	mock.ExpectExec(`insert ignore into apps`).WithArgs(utils.StatusOk, "foo", "", "", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`insert ignore into app_certs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	app := App{Status: utils.StatusOk, Name: "foo"}
+	if err := ctrl.NewAppWithCSR(&app, csr, []string{"foo.local"}, nil, 1); err != nil {
+		t.Fatalf("new app with csr fail: %v", err)
+	}
+	cert, err := utils.DecodeCertificateFromPem(app.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "foo.local" || len(cert.IPAddresses) != 0 {
+		t.Errorf("unexpected cert sans: %v, %v", cert.DNSNames, cert.IPAddresses)
+	}
+	if app.ID != 1 || app.PrivateKey != "" || cert.Subject.CommonName != "foo" {
+		t.Errorf("unexpected app: %+v", app)
+	}
+
+	// server-held keys are disabled
+	if _, err := ctrl.NewApp(&App{Name: "bar"}, nil, nil, nil, 1); err != errServerKeyGenDisabled {
+		t.Errorf("expect server key disabled, got %v", err)
+	}
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctrl.RenewCert(&app, key, nil, nil, 1); err != errServerKeyGenDisabled {
+		t.Errorf("expect server key disabled, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestRenewCertWithCSR(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.config.DisableServerKey = true
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem, err := ctrl.CertsManager.NewCert(key.Public(), pkix.Name{CommonName: "foo"}, []string{"foo.local"}, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{ID: 1, Status: utils.StatusOk, Name: "foo", Cert: string(certPem), PrivateKey: "server key"}
+
+	bad, _ := newTestCSR(t, "bar", nil, nil)
+	if err := ctrl.RenewCertWithCSR(app, bad, nil, nil, 1); errCode(err) != utils.EcodeInvalidParam {
+		t.Errorf("expect invalid param, got %v", err)
+	}
+
+	// dns names of the current cert are kept, server-held key is dropped
+	csr, _ := newTestCSR(t, "foo", []string{"evil.example.com"}, nil)
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert ignore into app_certs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`update app_certs set expire_time=\?`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert ignore into app_certs`).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(`update apps set cert=\?`).WithArgs(sqlmock.AnyArg(), "", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := ctrl.RenewCertWithCSR(app, csr, nil, nil, 1); err != nil {
+		t.Fatalf("renew cert with csr fail: %v", err)
+	}
+	cert, err := utils.DecodeCertificateFromPem(app.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "foo.local" || app.PrivateKey != "" {
+		t.Errorf("unexpected renewed cert: %v, key: %q", cert.DNSNames, app.PrivateKey)
+	}
+	checkMockDB(t, mock)
+}
@@ -6,9 +6,11 @@ import (
 	"encoding/pem"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gocomm/dbutil"
+	"github.com/infrmods/xbus/utils"
 )
 
 // App app table
@@ -17,6 +19,7 @@ type App struct {
 	Status      int       `json:"status"`
 	Name        string    `json:"name"`
 	Description string    `json:"description,omitempty"`
+	Env         string    `json:"env,omitempty"`
 	PrivateKey  string    `json:"-"`
 	Cert        string    `json:"cert"`
 	CreateTime  time.Time `json:"create_time"`
@@ -29,7 +32,7 @@ type App struct {
 func (app *App) Certificate() (*x509.Certificate, error) {
 	if app.certificate == nil {
 		block, _ := pem.Decode([]byte(app.Cert))
-		if block == nil || block.Type != "Certificate" {
+		if block == nil || block.Type != "CERTIFICATE" {
 			return nil, fmt.Errorf("invalid pem cert")
 		}
 		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
@@ -54,8 +57,8 @@ func ListApp(db *sql.DB, skip, limit int) ([]App, error) {
 // InsertApp insert app
 func InsertApp(db *sql.DB, app *App) error {
 	id, err := dbutil.Insert(db,
-		`insert ignore into apps(status, name, description, private_key, cert)
-         values(?, ?, ?, ?, ?)`, app.Status, app.Name, app.Description, app.PrivateKey, app.Cert)
+		`insert ignore into apps(status, name, description, env, private_key, cert)
+         values(?, ?, ?, ?, ?, ?)`, app.Status, app.Name, app.Description, app.Env, app.PrivateKey, app.Cert)
 	if err != nil {
 		return err
 	}
@@ -63,6 +66,13 @@ func InsertApp(db *sql.DB, app *App) error {
 	return nil
 }
 
+// UpdateAppStatus update app status, ZeroEffected if not changed
+func UpdateAppStatus(db *sql.DB, appID int64, status int) error {
+	_, err := dbutil.Update(db, `update apps set status=?, modify_time=now() where id=? and status!=?`,
+		status, appID, status)
+	return err
+}
+
 // GetAppList get app list
 func GetAppList(db *sql.DB) (apps []App, err error) {
 	err = dbutil.Query(db, &apps, `select * from apps`)
@@ -85,16 +95,16 @@ func GetAppByName(db *sql.DB, name string) (*App, error) {
 // GetAppGroupByName get app group by name
 func GetAppGroupByName(db *sql.DB, name string) (*App, []int64, error) {
 	row := db.QueryRow(`select apps.id, apps.status, apps.name,
-                               apps.description, apps.cert, apps.create_time, apps.modify_time,
-                               group_concat(groups.id, ",")
+                               apps.description, apps.env, apps.cert, apps.create_time, apps.modify_time,
+                               group_concat(groups.id)
                         from apps
                         left join group_members on group_members.app_id=apps.id
-                        left join `+"`groups`"+` on group_members.group_id=groups.id
+                        left join `+"`groups`"+` on group_members.group_id=groups.id and groups.status=?
 						where apps.name=?
-                        group by apps.id,groups.id`, name)
+                        group by apps.id`, utils.StatusOk, name)
 	var app App
 	var groupIDs dbutil.NumList
-	if err := row.Scan(&app.ID, &app.Status, &app.Name, &app.Description,
+	if err := row.Scan(&app.ID, &app.Status, &app.Name, &app.Description, &app.Env,
 		&app.Cert, &app.CreateTime, &app.ModifyTime, &groupIDs); err == nil {
 		return &app, groupIDs, nil
 	} else if err == sql.ErrNoRows {
@@ -117,8 +127,7 @@ type Group struct {
 // InsertGroup insert group
 func InsertGroup(db *sql.DB, group *Group) error {
 	id, err := dbutil.Insert(db,
-		`insert into groups(status, name, description)
-         values(?, ?, ?)`, group.Status, group.Name, group.Description)
+		"insert ignore into `groups`(status, name, description) values(?, ?, ?)", group.Status, group.Name, group.Description)
 	if err != nil {
 		return err
 	}
@@ -128,7 +137,7 @@ func InsertGroup(db *sql.DB, group *Group) error {
 
 // GetGroupList get group list
 func GetGroupList(db *sql.DB) (groups []Group, err error) {
-	err = dbutil.Query(db, &groups, `select * from groups`)
+	err = dbutil.Query(db, &groups, "select * from `groups` order by id")
 	return
 }
 
@@ -136,7 +145,7 @@ func GetGroupList(db *sql.DB) (groups []Group, err error) {
 func GetGroupByName(db *sql.DB, name string) (*Group, error) {
 	var group Group
 	if err := dbutil.Query(db, &group,
-		`select * from groups where name=?`, name); err == nil {
+		"select * from `groups` where name=?", name); err == nil {
 		return &group, nil
 	} else if err == sql.ErrNoRows {
 		return nil, nil
@@ -153,14 +162,26 @@ type GroupMember struct {
 	CreateTime time.Time
 }
 
-// NewGroupMember new group member
+// NewGroupMember new group member, ZeroEffected if exists
 func NewGroupMember(db *sql.DB, groupID, appID int64) error {
 	_, err := dbutil.Insert(db,
-		`insert into group_members(app_id, group_id)
+		`insert ignore into group_members(app_id, group_id)
          values(?, ?)`, appID, groupID)
 	return err
 }
 
+// DeleteGroupMember delete group member, ZeroEffected if not exists
+func DeleteGroupMember(db *sql.DB, groupID, appID int64) error {
+	_, err := dbutil.Update(db, `delete from group_members where group_id=? and app_id=?`, groupID, appID)
+	return err
+}
+
+// ListGroupMembers list all group members
+func ListGroupMembers(db *sql.DB) (members []GroupMember, err error) {
+	err = dbutil.Query(db, &members, `select * from group_members`)
+	return
+}
+
 // GetGroupMembers get group members
 func GetGroupMembers(db *sql.DB, groupID int64) (apps []App, err error) {
 	if err := dbutil.Query(db, &apps,
@@ -180,6 +201,12 @@ const (
 	PermTypeService = 1
 	// PermTypeApp perm type app
 	PermTypeApp = 2
+	// PermTypeConfigApproval perm type config approval
+	PermTypeConfigApproval = 3
+	// PermTypeAdmin perm type admin
+	PermTypeAdmin = 4
+	// PermTypePermAdmin perm type perm admin, manage perms of content prefix
+	PermTypePermAdmin = 5
 
 	// PermTargetApp perm target app
 	PermTargetApp = 0
@@ -192,13 +219,45 @@ const (
 
 // Perm perm table
 type Perm struct {
-	ID         int64
-	PermType   int
-	TargetType int
-	TargetID   int64
-	CanWrite   bool
-	Content    string
-	CreateTime time.Time
+	ID         int64     `json:"id"`
+	PermType   int       `json:"perm_type"`
+	TargetType int       `json:"target_type"`
+	TargetID   int64     `json:"target_id"`
+	CanWrite   bool      `json:"can_write"`
+	Deny       bool      `json:"deny"`
+	Content    string    `json:"content"`
+	CreateTime time.Time `json:"create_time"`
+}
+
+// IsValidPermType is valid perm type
+func IsValidPermType(typ int) bool {
+	return typ >= PermTypeConfig && typ <= PermTypePermAdmin
+}
+
+// GetPermByID get perm by id
+func GetPermByID(db *sql.DB, id int64) (*Perm, error) {
+	var perm Perm
+	if err := dbutil.Query(db, &perm, `select * from perms where id=?`, id); err == nil {
+		return &perm, nil
+	} else if err == sql.ErrNoRows {
+		return nil, nil
+	} else {
+		return nil, err
+	}
+}
+
+// GetPermByKey get perm by type, target & content
+func GetPermByKey(db *sql.DB, permType, targetType int, targetID int64, content string) (*Perm, error) {
+	var perm Perm
+	if err := dbutil.Query(db, &perm,
+		`select * from perms where perm_type=? and target_type=? and target_id=? and content=?`,
+		permType, targetType, targetID, content); err == nil {
+		return &perm, nil
+	} else if err == sql.ErrNoRows {
+		return nil, nil
+	} else {
+		return nil, err
+	}
 }
 
 // GetPerms get perms
@@ -221,8 +280,8 @@ func GetPerms(db *sql.DB, typ int, targetType *int, targetID *int64,
 		args = append(args, *canWrite)
 	}
 	if prefix != nil {
-		q += ` and content like ?`
-		args = append(args, *prefix+"%")
+		q += ` and content like ? escape '\\'`
+		args = append(args, utils.EscapeLike(*prefix)+"%")
 	}
 
 	var perms []Perm
@@ -233,59 +292,52 @@ func GetPerms(db *sql.DB, typ int, targetType *int, targetID *int64,
 	return perms, nil
 }
 
-// InsertPerm insert perm
-func InsertPerm(db *sql.DB, perm *Perm) error {
-	var query string
-	if perm.CanWrite {
-		query = `insert into perms(perm_type, target_type, target_id, can_write, content)
-                 values(?, ?, ?, ?, ?)
-                 on duplicate key update can_write=true`
-	} else {
-		query = `insert ignore into perms(perm_type, target_type, target_id, can_write, content)
-                 values(?, ?, ?, ?, ?)`
-	}
-	if id, err := dbutil.Insert(db, query, perm.PermType, perm.TargetType, perm.TargetID,
-		perm.CanWrite, perm.Content); err == nil {
-		perm.ID = id
-		return nil
-	} else if err == dbutil.ZeroEffected {
-		return nil
-	} else {
-		return err
-	}
+// ListAllPerms list all perms
+func ListAllPerms(db *sql.DB) (perms []Perm, err error) {
+	err = dbutil.Query(db, &perms, `select * from perms`)
+	return
 }
 
-// HasAnyPrefixPerm has any prefix perm
-func HasAnyPrefixPerm(db *sql.DB, permType int, appID int64, groupIDs []int64, needWrite bool, content string) (bool, error) {
-	var extra string
-	if needWrite {
-		extra = ` and can_write=true`
+// GetTargetPerms get perms of target
+func GetTargetPerms(db *sql.DB, targetType int, targetID int64) ([]Perm, error) {
+	var perms []Perm
+	if err := dbutil.Query(db, &perms, `select * from perms where target_type=? and target_id=? order by id`,
+		targetType, targetID); err != nil {
+		return nil, err
 	}
-	var count int64
+	return perms, nil
+}
+
+// GetAppPerms get perms of type granted to app, its groups & public; public only if appID is PermPublicTargetID
+func GetAppPerms(db *sql.DB, permType int, appID int64, groupIDs []int64) ([]Perm, error) {
+	var perms []Perm
 	var err error
 	if appID == PermPublicTargetID {
-		err = dbutil.Query(db, &count,
-			`select count(*) from perms
-             where target_type=? and target_id=? and
-                   perm_type=? and ? like CONCAT(content, "%")`+extra,
-			PermTargetApp, PermPublicTargetID,
-			permType, content)
+		err = dbutil.Query(db, &perms,
+			`select * from perms where target_type=? and target_id=? and perm_type=?`,
+			PermTargetApp, PermPublicTargetID, permType)
 	} else {
-		err = dbutil.Query(db, &count,
-			`select count(*) from perms
-             where ((target_type=? and target_id in (?)) or
+		groupCond := "false"
+		args := make([]interface{}, 0, len(groupIDs)+5)
+		if len(groupIDs) > 0 {
+			groupCond = "target_type=? and target_id in (" + strings.TrimSuffix(strings.Repeat("?,", len(groupIDs)), ",") + ")"
+			args = append(args, PermTargetGroup)
+			for _, id := range groupIDs {
+				args = append(args, id)
+			}
+		}
+		args = append(args, PermTargetApp, appID, PermPublicTargetID, permType)
+		err = dbutil.Query(db, &perms,
+			`select * from perms
+             where ((`+groupCond+`) or
                     (target_type=? and target_id=?) or
                     target_id=?) and
-                   perm_type=? and ? like CONCAT(content, "%")`+extra,
-			PermTargetGroup, dbutil.NumList(groupIDs),
-			PermTargetApp, appID,
-			PermPublicTargetID,
-			permType, content)
+                   perm_type=?`, args...)
 	}
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return count > 0, nil
+	return perms, nil
 }
 
 // ConfigItem config item table
@@ -0,0 +1,124 @@
+package apps
+
+import (
+	"crypto/x509"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	appCertExpiryDays = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "xbus",
+		Name:      "app_cert_expiry_days",
+		Help:      "Days until the current cert of app expires.",
+	}, []string{"app"})
+	caCertExpiryDays = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "xbus",
+		Name:      "ca_cert_expiry_days",
+		Help:      "Days until the ca cert expires.",
+	}, []string{"subject", "serial_no"})
+)
+
+func init() {
+	prometheus.MustRegister(appCertExpiryDays, caCertExpiryDays)
+}
+
+// CertExpiry cert expiry info, app is empty for ca certs
+type CertExpiry struct {
+	App      string    `json:"app,omitempty"`
+	Subject  string    `json:"subject"`
+	SerialNo string    `json:"serial_no"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft float64   `json:"days_left"`
+}
+
+func newCertExpiry(app string, cert *x509.Certificate, now time.Time) CertExpiry {
+	return CertExpiry{App: app, Subject: cert.Subject.CommonName, SerialNo: cert.SerialNumber.String(),
+		NotAfter: cert.NotAfter, DaysLeft: cert.NotAfter.Sub(now).Hours() / 24}
+}
+
+// certExpiries expiries of ca certs & current certs of ok apps, soonest first
+func (ctrl *AppCtrl) certExpiries(now time.Time) ([]CertExpiry, error) {
+	apps, err := GetAppList(ctrl.db)
+	if err != nil {
+		glog.Errorf("get app list fail: %v", err)
+		return nil, utils.NewSystemError("get app list fail")
+	}
+	expiries := make([]CertExpiry, 0, len(apps))
+	for _, cert := range ctrl.CertsManager.CACerts() {
+		expiries = append(expiries, newCertExpiry("", cert, now))
+	}
+	for i := range apps {
+		app := &apps[i]
+		if app.Status != utils.StatusOk {
+			continue
+		}
+		cert, err := app.Certificate()
+		if err != nil {
+			glog.Warningf("parse app(%s) cert fail: %v", app.Name, err)
+			continue
+		}
+		expiries = append(expiries, newCertExpiry(app.Name, cert, now))
+	}
+	sort.SliceStable(expiries, func(i, j int) bool {
+		return expiries[i].NotAfter.Before(expiries[j].NotAfter)
+	})
+	return expiries, nil
+}
+
+// ListExpiringCerts list certs expiring within days(expired included), soonest first
+func (ctrl *AppCtrl) ListExpiringCerts(days int) ([]CertExpiry, error) {
+	now := time.Now()
+	expiries, err := ctrl.certExpiries(now)
+	if err != nil {
+		return nil, err
+	}
+	deadline := now.Add(time.Duration(days) * 24 * time.Hour)
+	for i, expiry := range expiries {
+		if expiry.NotAfter.After(deadline) {
+			return expiries[:i], nil
+		}
+	}
+	return expiries, nil
+}
+
+// checkCertExpiry update expiry gauges, warn certs expiring within CertExpiryWarnDays
+func (ctrl *AppCtrl) checkCertExpiry() {
+	expiries, err := ctrl.certExpiries(time.Now())
+	if err != nil {
+		return
+	}
+	appCertExpiryDays.Reset()
+	caCertExpiryDays.Reset()
+	for _, expiry := range expiries {
+		if expiry.App == "" {
+			caCertExpiryDays.WithLabelValues(expiry.Subject, expiry.SerialNo).Set(expiry.DaysLeft)
+		} else {
+			appCertExpiryDays.WithLabelValues(expiry.App).Set(expiry.DaysLeft)
+		}
+		if expiry.DaysLeft > float64(ctrl.config.CertExpiryWarnDays) {
+			continue
+		}
+		name := expiry.App
+		if name == "" {
+			name = "ca " + expiry.Subject
+		}
+		if expiry.DaysLeft < 0 {
+			glog.Warningf("cert of %s(serial: %s) expired at %s", name, expiry.SerialNo, expiry.NotAfter)
+		} else {
+			glog.Warningf("cert of %s(serial: %s) expires in %.1f days", name, expiry.SerialNo, expiry.DaysLeft)
+		}
+	}
+}
+
+// RunCertExpiryMonitor check cert expiry on startup and periodically
+func (ctrl *AppCtrl) RunCertExpiryMonitor() {
+	for {
+		ctrl.checkCertExpiry()
+		time.Sleep(ctrl.config.CertExpiryInterval)
+	}
+}
@@ -0,0 +1,121 @@
+package apps
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+const (
+	// PermSourceOwn implicit rule of app's own name prefix
+	PermSourceOwn = "own"
+	// PermSourceApp perm granted to app
+	PermSourceApp = "app"
+	// PermSourceGroup perm granted to group of app
+	PermSourceGroup = "group"
+	// PermSourcePublic perm granted to public
+	PermSourcePublic = "public"
+)
+
+// PermRule candidate rule of perm explanation
+type PermRule struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	PermID   int64  `json:"perm_id,omitempty"`
+	CanWrite bool   `json:"can_write"`
+	Deny     bool   `json:"deny"`
+	Content  string `json:"content"`
+	Matched  bool   `json:"matched"`
+	Decisive bool   `json:"decisive"`
+}
+
+// PermExplanation perm decision with candidate rules
+type PermExplanation struct {
+	App       string     `json:"app"`
+	AppStatus int        `json:"app_status"`
+	PermType  int        `json:"perm_type"`
+	NeedWrite bool       `json:"need_write"`
+	Name      string     `json:"name"`
+	Allowed   bool       `json:"allowed"`
+	Reason    string     `json:"reason"`
+	Rules     []PermRule `json:"rules"`
+}
+
+// ExplainPerm explain perm decision of app(public for anonymous) on name, same as HasPerm;
+// requests of disabled app are rejected before perm check
+func (ctrl *AppCtrl) ExplainPerm(appName string, permType int, needWrite bool, name string) (*PermExplanation, error) {
+	if !IsValidPermType(permType) {
+		return nil, utils.Errorf(utils.EcodeInvalidParam, "invalid perm type: %d", permType)
+	}
+	explanation := &PermExplanation{App: appName, PermType: permType, NeedWrite: needWrite,
+		Name: name, Rules: make([]PermRule, 0)}
+
+	appID, groupIDs := int64(PermPublicTargetID), []int64(nil)
+	if appName != PermPublicTarget {
+		app, ids, err := ctrl.GetAppGroupByName(appName)
+		if err != nil {
+			return nil, err
+		}
+		if app == nil {
+			return nil, utils.Errorf(utils.EcodeNotFound, "no such app: %s", appName)
+		}
+		appID, groupIDs = app.ID, ids
+		explanation.AppStatus = app.Status
+		own := PermRule{Source: PermSourceOwn, Target: app.Name, CanWrite: true, Content: app.Name + "."}
+		own.Matched = strings.HasPrefix(name, own.Content)
+		explanation.Rules = append(explanation.Rules, own)
+	}
+
+	perms, err := ctrl.appPerms(permType, appID, groupIDs)
+	if err != nil {
+		glog.Errorf("get app(%s) perms fail: %v", appName, err)
+		return nil, utils.NewSystemError("get perms fail")
+	}
+	groupNames := make(map[int64]string)
+	if len(groupIDs) > 0 {
+		groups, err := GetGroupList(ctrl.db)
+		if err != nil {
+			glog.Errorf("get groups fail: %v", err)
+			return nil, utils.NewSystemError("get groups fail")
+		}
+		for _, group := range groups {
+			groupNames[group.ID] = group.Name
+		}
+	}
+	offset := len(explanation.Rules)
+	for _, perm := range perms {
+		rule := PermRule{Source: PermSourceApp, Target: appName, PermID: perm.ID,
+			CanWrite: perm.CanWrite, Deny: perm.Deny, Content: perm.Content,
+			Matched: MatchPermContent(perm.Content, name)}
+		if perm.TargetType == PermTargetGroup {
+			rule.Source, rule.Target = PermSourceGroup, groupNames[perm.TargetID]
+			if rule.Target == "" {
+				rule.Target = fmt.Sprintf("<invalid: %d>", perm.TargetID)
+			}
+		} else if perm.TargetID == PermPublicTargetID {
+			rule.Source, rule.Target = PermSourcePublic, PermPublicTarget
+		}
+		explanation.Rules = append(explanation.Rules, rule)
+	}
+
+	switch allowed, decisive := evalPerms(perms, needWrite, name); {
+	case explanation.AppStatus != utils.StatusOk:
+		explanation.Reason = "app is disabled"
+	case appID == PermPublicTargetID && needWrite:
+		explanation.Reason = "anonymous write is not permitted"
+	case decisive >= 0 && !allowed:
+		explanation.Reason = "denied by rule"
+		explanation.Rules[offset+decisive].Decisive = true
+	case offset > 0 && explanation.Rules[0].Matched:
+		explanation.Allowed, explanation.Reason = true, "own name prefix"
+		explanation.Rules[0].Decisive = true
+	case decisive < 0:
+		explanation.Reason = "no matching rule"
+	default:
+		explanation.Allowed, explanation.Reason = true, "allowed by rule"
+		explanation.Rules[offset+decisive].Decisive = true
+	}
+	return explanation, nil
+}
@@ -0,0 +1,85 @@
+package apps
+
+import (
+	"testing"
+
+	"github.com/infrmods/xbus/utils"
+)
+
+func TestExplainPerm(t *testing.T) {
+	ctrl := &AppCtrl{}
+	ctrl.permCache.snapshot = newPermSnapshot([]App{{ID: 1, Name: "foo"}, {ID: 2, Status: utils.StatusDisabled, Name: "bar"}}, nil, nil, []Perm{
+		{ID: 1, PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: PermPublicTargetID, Content: "pub."},
+		{ID: 2, PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: 1, CanWrite: true, Content: "bar."},
+		{ID: 3, PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: 1, Deny: true, Content: "bar.secret."},
+		{ID: 4, PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: 1, Deny: true, Content: "foo.secret."},
+	}, nil)
+
+	cases := []struct {
+		app, name string
+		needWrite bool
+		allowed   bool
+		decisive  string
+	}{
+		{"foo", "foo.x", true, true, PermSourceOwn},
+		{"foo", "foo.secret.x", false, false, PermSourceApp},
+		{"foo", "bar.x", true, true, PermSourceApp},
+		{"foo", "bar.secret.x", false, false, PermSourceApp},
+		{"foo", "pub.x", false, true, PermSourcePublic},
+		{"foo", "baz.x", false, false, ""},
+		{PermPublicTarget, "pub.x", false, true, PermSourcePublic},
+		{PermPublicTarget, "pub.x", true, false, ""},
+		{"bar", "bar.x", false, false, ""},
+		{"bar", "pub.x", false, false, ""},
+	}
+	for _, c := range cases {
+		explanation, err := ctrl.ExplainPerm(c.app, PermTypeConfig, c.needWrite, c.name)
+		if err != nil {
+			t.Fatalf("explain fail: %v", err)
+		}
+		if explanation.Allowed != c.allowed || (c.app == "bar") != (explanation.Reason == "app is disabled") {
+			t.Errorf("%s on %s(write: %v) should be %v", c.app, c.name, c.needWrite, c.allowed)
+		}
+		decisive := ""
+		for _, rule := range explanation.Rules {
+			if rule.Decisive {
+				decisive = rule.Source
+			}
+		}
+		if decisive != c.decisive {
+			t.Errorf("decisive rule of %s on %s should be %q: %+v", c.app, c.name, c.decisive, explanation.Rules)
+		}
+	}
+}
+
+func TestHasPerm(t *testing.T) {
+	ctrl := &AppCtrl{}
+	ctrl.permCache.snapshot = newPermSnapshot(nil, nil, nil, []Perm{
+		{ID: 1, PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: PermPublicTargetID, Content: "pub."},
+		{ID: 2, PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: 1, Deny: true, Content: "foo.secret."},
+	}, nil)
+	foo := &App{ID: 1, Name: "foo"}
+
+	cases := []struct {
+		app       *App
+		name      string
+		needWrite bool
+		allowed   bool
+	}{
+		{foo, "foo.x", true, true},
+		{foo, "foo.secret.x", false, false},
+		{foo, "pub.x", false, true},
+		{foo, "bar.x", false, false},
+		{nil, "pub.x", false, true},
+		{nil, "pub.x", true, false},
+	}
+	for _, c := range cases {
+		ok, err := ctrl.HasPerm(PermTypeConfig, c.app, nil, c.needWrite, c.name)
+		if err != nil {
+			t.Fatalf("has perm fail: %v", err)
+		}
+		if ok != c.allowed {
+			t.Errorf("%+v on %s(write: %v) should be %v", c.app, c.name, c.needWrite, c.allowed)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package apps
+
+import (
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// ListGroups list groups
+func (ctrl *AppCtrl) ListGroups() ([]Group, error) {
+	groups, err := GetGroupList(ctrl.db)
+	if err != nil {
+		glog.Errorf("list groups fail: %v", err)
+		return nil, utils.NewSystemError("list groups fail")
+	}
+	if groups == nil {
+		groups = make([]Group, 0)
+	}
+	return groups, nil
+}
+
+// GetGroupPerms get perms granted to group
+func (ctrl *AppCtrl) GetGroupPerms(groupID int64) ([]Perm, error) {
+	perms, err := GetTargetPerms(ctrl.db, PermTargetGroup, groupID)
+	if err != nil {
+		glog.Errorf("get group(%d) perms fail: %v", groupID, err)
+		return nil, utils.NewSystemError("get group perms fail")
+	}
+	if perms == nil {
+		perms = make([]Perm, 0)
+	}
+	return perms, nil
+}
+
+// RemoveGroupMember remove group member
+func (ctrl *AppCtrl) RemoveGroupMember(groupID, appID int64) error {
+	if err := DeleteGroupMember(ctrl.db, groupID, appID); err != nil {
+		if err == dbutil.ZeroEffected {
+			return utils.NewError(utils.EcodeNotFound, "not a member")
+		}
+		glog.Errorf("remove group member(group: %d, app: %d) fail: %v", groupID, appID, err)
+		return utils.NewSystemError("remove member fail")
+	}
+	ctrl.permsChanged("remove group member")
+	return nil
+}
+
+// DeleteGroup delete group with its members & perms, perm revocations are recorded in audit
+func (ctrl *AppCtrl) DeleteGroup(group *Group, operator string) error {
+	if err := ctrl.deleteGroup(group, operator); err != nil {
+		glog.Errorf("delete group(%s) fail: %v", group.Name, err)
+		return utils.NewSystemError("delete group fail")
+	}
+	ctrl.permsChanged("delete group: " + group.Name)
+	return nil
+}
+
+func (ctrl *AppCtrl) deleteGroup(group *Group, operator string) (rerr error) {
+	perms, err := GetTargetPerms(ctrl.db, PermTargetGroup, group.ID)
+	if err != nil {
+		return err
+	}
+	tx, err := ctrl.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr != nil {
+			if err := tx.Rollback(); err != nil {
+				glog.Warningf("tx rollback fail: %v", err)
+			}
+		}
+	}()
+
+	for i := range perms {
+		if _, err := tx.Exec(`delete from perms where id=?`, perms[i].ID); err != nil {
+			return err
+		}
+		if err := insertPermAudit(tx, PermActionRevoke, &perms[i], operator); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`delete from group_members where group_id=?`, group.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from `groups` where id=?", group.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
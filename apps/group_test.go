@@ -0,0 +1,115 @@
+package apps
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+var permColumns = []string{"id", "perm_type", "target_type", "target_id", "can_write", "deny", "content", "create_time"}
+
+func TestGroupMembers(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+
+	if err := ctrl.NewGroup(&Group{Name: "a b"}); errCode(err) != utils.EcodeInvalidName {
+		t.Errorf("expect invalid name, got %v", err)
+	}
+	mock.ExpectExec("insert ignore into `groups`").WithArgs(utils.StatusOk, "ops", "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := ctrl.NewGroup(&Group{Status: utils.StatusOk, Name: "ops"}); errCode(err) != utils.EcodeNameDuplicated {
+		t.Errorf("expect name duplicated, got %v", err)
+	}
+
+	mock.ExpectExec(`insert ignore into group_members`).WithArgs(int64(1), int64(10)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := ctrl.AddGroupMember(10, 1); err != nil {
+		t.Errorf("add group member fail: %v", err)
+	}
+	if resp, err := ctrl.etcdClient.Get(context.Background(), ctrl.permsKey()); err != nil || len(resp.Kvs) != 1 {
+		t.Errorf("perms change not notified: %v", err)
+	}
+	mock.ExpectExec(`insert ignore into group_members`).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := ctrl.AddGroupMember(10, 1); errCode(err) != utils.EcodeNameDuplicated {
+		t.Errorf("expect member exists, got %v", err)
+	}
+
+	mock.ExpectExec(`delete from group_members where group_id=\? and app_id=\?`).WithArgs(int64(10), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := ctrl.RemoveGroupMember(10, 1); err != nil {
+		t.Errorf("remove group member fail: %v", err)
+	}
+	mock.ExpectExec(`delete from group_members`).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := ctrl.RemoveGroupMember(10, 1); errCode(err) != utils.EcodeNotFound {
+		t.Errorf("expect not a member, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestDeleteGroup(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	now := time.Now()
+
+	// perms of group are revoked with audits
+	mock.ExpectQuery(`select \* from perms where target_type=\? and target_id=\?`).
+		WithArgs(PermTargetGroup, int64(10)).WillReturnRows(sqlmock.NewRows(permColumns).
+		AddRow(5, PermTypeConfig, PermTargetGroup, 10, true, false, "db.", now).
+		AddRow(6, PermTypeService, PermTargetGroup, 10, false, true, "svc.", now))
+	mock.ExpectBegin()
+	for _, id := range []int64{5, 6} {
+		mock.ExpectExec(`delete from perms where id=\?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`insert into perm_audits`).WithArgs(PermActionRevoke, id, sqlmock.AnyArg(),
+			PermTargetGroup, int64(10), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "admin").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec(`delete from group_members where group_id=\?`).WithArgs(int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("delete from `groups` where id=\\?").WithArgs(int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := ctrl.DeleteGroup(&Group{ID: 10, Name: "ops"}, "admin"); err != nil {
+		t.Errorf("delete group fail: %v", err)
+	}
+
+	// nothing deleted on failure
+	mock.ExpectQuery(`select \* from perms where target_type=\? and target_id=\?`).
+		WillReturnRows(sqlmock.NewRows(permColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(`delete from group_members where group_id=\?`).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+	if err := ctrl.DeleteGroup(&Group{ID: 10, Name: "ops"}, "admin"); errCode(err) != utils.EcodeSystemError {
+		t.Errorf("expect system error, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestGetAppGroupByName(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	now := time.Now()
+
+	// app of multi groups
+	mock.ExpectQuery(`select apps.id`).WithArgs(utils.StatusOk, "foo").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "status", "name", "description", "env", "cert", "create_time",
+			"modify_time", "group_ids"}).AddRow(1, utils.StatusOk, "foo", "", "", "", now, now, "10,11"))
+	app, groupIDs, err := ctrl.GetAppGroupByName("foo")
+	if err != nil || app == nil || app.ID != 1 {
+		t.Fatalf("get app group fail: %+v, %v", app, err)
+	}
+	if len(groupIDs) != 2 || groupIDs[0] != 10 || groupIDs[1] != 11 {
+		t.Errorf("unexpected groups: %v", groupIDs)
+	}
+
+	// from perm snapshot once loaded
+	ctrl.permCache.snapshot = newPermSnapshot([]App{{ID: 1, Name: "foo"}},
+		[]Group{{ID: 10, Status: utils.StatusOk}, {ID: 11, Status: utils.StatusOk}},
+		[]GroupMember{{AppID: 1, GroupID: 10}, {AppID: 1, GroupID: 11}}, nil, nil)
+	if app, groupIDs, err := ctrl.GetAppGroupByName("foo"); err != nil || app == nil || len(groupIDs) != 2 {
+		t.Errorf("get app group from snapshot fail: %+v, %v, %v", app, groupIDs, err)
+	}
+	checkMockDB(t, mock)
+}
@@ -36,3 +36,7 @@ func (ctrl *AppCtrl) parseHoldNodeKey(key string) string {
 	}
 	return ""
 }
+
+func (ctrl *AppCtrl) appKeyPrefix(app string) string {
+	return fmt.Sprintf("%s/%s/", ctrl.config.KeyPrefix, app)
+}
@@ -0,0 +1,195 @@
+package apps
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// encrypted key format: enc:v1:{master key id}:{base64(nonce+ciphertext)}
+const encryptedKeyPrefix = "enc:v1:"
+
+// KeyCipher private key cipher(aes-256-gcm) with master key
+type KeyCipher struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewKeyCipher new key cipher, master key should be 32 bytes
+func NewKeyCipher(masterKey []byte) (*KeyCipher, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("invalid master key size: %d, should be 32", len(masterKey))
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(masterKey)
+	return &KeyCipher{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// LoadKeyCipher load key cipher from base64 encoded master key, or file contains it;
+// nil if neither is set
+func LoadKeyCipher(masterKey, masterKeyFile string) (*KeyCipher, error) {
+	if masterKey != "" && masterKeyFile != "" {
+		return nil, fmt.Errorf("both master key and master key file are set")
+	}
+	if masterKeyFile != "" {
+		data, err := ioutil.ReadFile(masterKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read master key file fail: %v", err)
+		}
+		masterKey = strings.TrimSpace(string(data))
+	}
+	if masterKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %v", err)
+	}
+	return NewKeyCipher(key)
+}
+
+// ID master key id
+func (c *KeyCipher) ID() string {
+	return c.id
+}
+
+// Encrypt encrypt pem key
+func (c *KeyCipher) Encrypt(keyPem string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data := c.aead.Seal(nonce, nonce, []byte(keyPem), []byte(c.id))
+	return encryptedKeyPrefix + c.id + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt decrypt encrypted key
+func (c *KeyCipher) Decrypt(encrypted string) (string, error) {
+	id, payload, ok := parseEncryptedKey(encrypted)
+	if !ok {
+		return "", fmt.Errorf("invalid encrypted key")
+	}
+	if id != c.id {
+		return "", fmt.Errorf("key is encrypted by another master key: %s", id)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted key: %v", err)
+	}
+	if len(data) < c.aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted key: too short")
+	}
+	nonce := data[:c.aead.NonceSize()]
+	plain, err := c.aead.Open(nil, nonce, data[c.aead.NonceSize():], []byte(c.id))
+	if err != nil {
+		return "", fmt.Errorf("decrypt key fail: %v", err)
+	}
+	return string(plain), nil
+}
+
+// IsEncryptedKey is stored private key encrypted
+func IsEncryptedKey(data string) bool {
+	return strings.HasPrefix(data, encryptedKeyPrefix)
+}
+
+func parseEncryptedKey(data string) (id, payload string, ok bool) {
+	if !IsEncryptedKey(data) {
+		return "", "", false
+	}
+	parts := strings.SplitN(data[len(encryptedKeyPrefix):], ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// encryptKey encrypt pem key for storing, kept plain if no master key
+func (ctrl *AppCtrl) encryptKey(keyPem string) (string, error) {
+	if ctrl.keyCipher == nil || keyPem == "" {
+		return keyPem, nil
+	}
+	return ctrl.keyCipher.Encrypt(keyPem)
+}
+
+// PrivateKey get decrypted pem private key of app, empty if not held by server
+func (ctrl *AppCtrl) PrivateKey(app *App) (string, error) {
+	if !IsEncryptedKey(app.PrivateKey) {
+		return app.PrivateKey, nil
+	}
+	if ctrl.keyCipher == nil {
+		return "", utils.Errorf(utils.EcodeSystemError, "master key is not configured")
+	}
+	keyPem, err := ctrl.keyCipher.Decrypt(app.PrivateKey)
+	if err != nil {
+		glog.Errorf("decrypt app(%s) private key fail: %v", app.Name, err)
+		return "", utils.NewSystemError("decrypt private key fail")
+	}
+	return keyPem, nil
+}
+
+// EncryptPrivateKeys (re)encrypt stored private keys with the current master key,
+// keys encrypted by oldCipher are rotated; returns count of updated apps
+func (ctrl *AppCtrl) EncryptPrivateKeys(oldCipher *KeyCipher) (int, error) {
+	if ctrl.keyCipher == nil {
+		return 0, fmt.Errorf("master key is not configured")
+	}
+	apps, err := GetAppList(ctrl.db)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, app := range apps {
+		if app.PrivateKey == "" {
+			continue
+		}
+		keyPem := app.PrivateKey
+		if id, _, ok := parseEncryptedKey(app.PrivateKey); ok {
+			if id == ctrl.keyCipher.ID() {
+				continue
+			}
+			if oldCipher == nil || id != oldCipher.ID() {
+				return count, fmt.Errorf("app(%s) key is encrypted by unknown master key: %s", app.Name, id)
+			}
+			if keyPem, err = oldCipher.Decrypt(app.PrivateKey); err != nil {
+				return count, fmt.Errorf("decrypt app(%s) key fail: %v", app.Name, err)
+			}
+		}
+		encrypted, err := ctrl.keyCipher.Encrypt(keyPem)
+		if err != nil {
+			return count, fmt.Errorf("encrypt app(%s) key fail: %v", app.Name, err)
+		}
+		if err := updateAppPrivateKey(ctrl.db, app.ID, app.PrivateKey, encrypted); err != nil {
+			if err == dbutil.ZeroEffected {
+				glog.Warningf("app(%s) key changed during encrypting, skipped", app.Name)
+				continue
+			}
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func updateAppPrivateKey(db *sql.DB, appID int64, old, new string) error {
+	_, err := dbutil.Update(db, `update apps set private_key=? where id=? and private_key=?`, new, appID, old)
+	return err
+}
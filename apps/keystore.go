@@ -0,0 +1,48 @@
+package apps
+
+import (
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+const (
+	// KeyStorePKCS12 pkcs12 keystore format
+	KeyStorePKCS12 = "pkcs12"
+	// KeyStoreJKS java keystore format
+	KeyStoreJKS = "jks"
+)
+
+// KeyStore bundle app's server-held key & cert chain with trusted roots in pkcs12 or jks
+func (ctrl *AppCtrl) KeyStore(app *App, format, password string) ([]byte, error) {
+	encode := utils.EncodePKCS12
+	switch format {
+	case KeyStorePKCS12:
+	case KeyStoreJKS:
+		encode = utils.EncodeJKS
+	default:
+		return nil, utils.Errorf(utils.EcodeInvalidParam, "invalid keystore format: %s", format)
+	}
+	if app.PrivateKey == "" {
+		return nil, utils.Errorf(utils.EcodeInvalidStatus, "app(%s) has no server-held private key", app.Name)
+	}
+	keyPem, err := ctrl.PrivateKey(app)
+	if err != nil {
+		return nil, err
+	}
+	key, err := utils.DecodePrivateKeyFromPem(keyPem)
+	if err != nil {
+		glog.Errorf("decode app(%s) private key fail: %v", app.Name, err)
+		return nil, utils.NewSystemError("decode private key fail")
+	}
+	certs, err := utils.DecodeCertificatesFromPem([]byte(app.Cert))
+	if err != nil {
+		glog.Errorf("parse app(%s) cert fail: %v", app.Name, err)
+		return nil, utils.NewSystemError("parse app cert fail")
+	}
+	data, err := encode(key, certs, ctrl.CertsManager.TrustedRoots(), app.Name, password)
+	if err != nil {
+		glog.Errorf("encode app(%s) keystore(%s) fail: %v", app.Name, format, err)
+		return nil, utils.NewSystemError("encode keystore fail")
+	}
+	return data, nil
+}
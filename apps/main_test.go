@@ -0,0 +1,100 @@
+package apps
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+	"github.com/infrmods/xbus/utils/etcdtest"
+)
+
+var testEtcd *etcdtest.Server
+
+func TestMain(m *testing.M) {
+	server, err := etcdtest.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start embedded etcd fail: %v\n", err)
+		os.Exit(1)
+	}
+	testEtcd = server
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// newTestCertsCtrl certs ctrl of in-memory self-signed root
+func newTestCertsCtrl(t *testing.T) *CertsCtrl {
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CertsCtrl{rootCert: root, rootKey: key, trustedRoots: []*x509.Certificate{root},
+		serialGenerator: &seqSerialGenerator{n: 100}}
+}
+
+// newTestCtrl new app ctrl with key prefix of test name
+func newTestCtrl(t *testing.T, db *sql.DB) *AppCtrl {
+	config := Config{KeyPrefix: "/" + strings.Replace(t.Name(), "/", "_", -1),
+		CertGracePeriod: time.Hour, CRLValidity: time.Hour, RequestTimeout: time.Second}
+	return &AppCtrl{config: &config, db: db, CertsManager: newTestCertsCtrl(t), etcdClient: testEtcd.Client}
+}
+
+// newTestApp new app with cert issued by ctrl
+func newTestApp(t *testing.T, ctrl *AppCtrl, id int64, name string) *App {
+	key, err := utils.NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem, err := ctrl.CertsManager.NewCert(key.Public(), pkix.Name{CommonName: name}, nil, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &App{ID: id, Status: utils.StatusOk, Name: name, Cert: string(certPem)}
+}
+
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("new sqlmock fail: %v", err)
+	}
+	return db, mock
+}
+
+func checkMockDB(t *testing.T, mock sqlmock.Sqlmock) {
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
+
+func errCode(err error) string {
+	if e, ok := err.(*utils.Error); ok {
+		return e.Code
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package apps
+
+import (
+	"strings"
+)
+
+// MatchPermContent match name with perm content; content with '*' is a glob pattern
+// of the whole name, '*' matches any chars except '.' and '**' matches any chars;
+// otherwise content is a prefix of name
+func MatchPermContent(content, name string) bool {
+	if !strings.Contains(content, "*") {
+		return strings.HasPrefix(name, content)
+	}
+	return matchGlob(content, name)
+}
+
+func matchGlob(pattern, name string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] != '*' {
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+			continue
+		}
+
+		deep := strings.HasPrefix(pattern, "**")
+		pattern = strings.TrimLeft(pattern, "*")
+		for i := 0; i <= len(name); i++ {
+			if matchGlob(pattern, name[i:]) {
+				return true
+			}
+			if i < len(name) && name[i] == '.' && !deep {
+				return false
+			}
+		}
+		return false
+	}
+	return len(name) == 0
+}
+
+// EvalPerms evaluate perms matched with name, denies take precedence over allows:
+// denied if any deny perm matches(deny with write denies writing only),
+// otherwise allowed if any allow perm matches
+func EvalPerms(perms []Perm, needWrite bool, name string) bool {
+	allowed, _ := evalPerms(perms, needWrite, name)
+	return allowed
+}
+
+// evalPerms evaluate perms with index of the deciding perm, -1 if none matches
+func evalPerms(perms []Perm, needWrite bool, name string) (bool, int) {
+	decisive := -1
+	for i := range perms {
+		perm := &perms[i]
+		if !MatchPermContent(perm.Content, name) {
+			continue
+		}
+		if perm.Deny {
+			if !perm.CanWrite || needWrite {
+				return false, i
+			}
+		} else if (perm.CanWrite || !needWrite) && decisive < 0 {
+			decisive = i
+		}
+	}
+	return decisive >= 0, decisive
+}
+
+// CoverPermContent check every name matched by content is matched by cover too,
+// i.e. content is the same or a longer literal prefix, or a glob no wider than cover
+func CoverPermContent(cover, content string) bool {
+	return coverGlob(permGlob(cover), permGlob(content))
+}
+
+// permGlob convert perm content to glob, prefix content equals to glob of prefix + '**'
+func permGlob(content string) string {
+	if !strings.Contains(content, "*") {
+		return content + "**"
+	}
+	return content
+}
+
+// globToken split the first token of glob: '*', '**' or a single char
+func globToken(pattern string) (string, string) {
+	if pattern == "" {
+		return "", ""
+	}
+	if pattern[0] != '*' {
+		return pattern[:1], pattern[1:]
+	}
+	rest := strings.TrimLeft(pattern, "*")
+	if len(pattern)-len(rest) > 1 {
+		return "**", rest
+	}
+	return "*", rest
+}
+
+func isGlobStar(tok string) bool {
+	return tok != "" && tok[0] == '*'
+}
+
+// starConsumes check whether star token could match the char token
+func starConsumes(star, tok string) bool {
+	return tok != "" && !isGlobStar(tok) && (star == "**" || tok != ".")
+}
+
+func coverGlob(cover, glob string) bool {
+	if cover == "" {
+		return glob == ""
+	}
+	tok, rest := globToken(cover)
+	if !isGlobStar(tok) {
+		gtok, grest := globToken(glob)
+		return tok == gtok && coverGlob(rest, grest)
+	}
+	for {
+		if coverGlob(rest, glob) {
+			return true
+		}
+		gtok, grest := globToken(glob)
+		if gtok == "" || (tok == "*" && (gtok == "**" || gtok == ".")) {
+			return false
+		}
+		glob = grest
+	}
+}
+
+// overlapGlob check whether any name is matched by both globs
+func overlapGlob(a, b string) bool {
+	if a == "" && b == "" {
+		return true
+	}
+	atok, arest := globToken(a)
+	btok, brest := globToken(b)
+	if isGlobStar(atok) && (overlapGlob(arest, b) || starConsumes(atok, btok) && overlapGlob(a, brest)) {
+		return true
+	}
+	if isGlobStar(btok) && (overlapGlob(a, brest) || starConsumes(btok, atok) && overlapGlob(arest, b)) {
+		return true
+	}
+	return atok != "" && !isGlobStar(atok) && atok == btok && overlapGlob(arest, brest)
+}
+
+// evalGrantPerms evaluate perm admin perms on granting(or revoking) content:
+// denied if any deny perm overlaps content, otherwise allowed if any allow perm with write covers content
+func evalGrantPerms(perms []Perm, content string) bool {
+	allowed := false
+	for i := range perms {
+		perm := &perms[i]
+		if perm.Deny {
+			if overlapGlob(permGlob(perm.Content), permGlob(content)) {
+				return false
+			}
+		} else if perm.CanWrite && CoverPermContent(perm.Content, content) {
+			allowed = true
+		}
+	}
+	return allowed
+}
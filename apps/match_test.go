@@ -0,0 +1,118 @@
+package apps
+
+import "testing"
+
+func TestMatchPermContent(t *testing.T) {
+	cases := []struct {
+		content, name string
+		match         bool
+	}{
+		{"", "foo.bar", true},
+		{"foo.", "foo.bar", true},
+		{"foo.", "foobar", false},
+		{"foo_", "foo.bar", false},
+		{"foo.*.read", "foo.bar.read", true},
+		{"foo.*.read", "foo.bar.baz.read", false},
+		{"foo.*.read", "foo.bar.read.x", false},
+		{"foo.**.read", "foo.bar.baz.read", true},
+		{"foo.**", "foo.bar.baz", true},
+		{"*.read", "bar.read", true},
+		{"*.read", "read", false},
+		{"foo*", "foobar", true},
+		{"foo*", "foo.bar", false},
+	}
+	for _, c := range cases {
+		if MatchPermContent(c.content, c.name) != c.match {
+			t.Errorf("match(%q, %q) should be %v", c.content, c.name, c.match)
+		}
+	}
+}
+
+func TestEvalPerms(t *testing.T) {
+	perms := []Perm{
+		{CanWrite: true, Content: "foo."},
+		{Deny: true, Content: "foo.secret."},
+		{Deny: true, CanWrite: true, Content: "foo.*.ro"},
+		{Content: "bar."},
+	}
+	cases := []struct {
+		name      string
+		needWrite bool
+		allowed   bool
+	}{
+		{"foo.x", true, true},
+		{"foo.secret.x", false, false},
+		{"foo.x.ro", false, true},
+		{"foo.x.ro", true, false},
+		{"bar.x", false, true},
+		{"bar.x", true, false},
+		{"baz.x", false, false},
+	}
+	for _, c := range cases {
+		if EvalPerms(perms, c.needWrite, c.name) != c.allowed {
+			t.Errorf("eval(%q, %v) should be %v", c.name, c.needWrite, c.allowed)
+		}
+	}
+}
+
+func TestCoverPermContent(t *testing.T) {
+	cases := []struct {
+		cover, content string
+		covered        bool
+	}{
+		{"", "foo.", true},
+		{"", "**", true},
+		{"foo.", "foo.", true},
+		{"foo.", "foo.bar", true},
+		{"foo.", "fo", false},
+		{"foo.", "foo.**", true},
+		{"foo.", "foo.*.read", true},
+		{"foo.", "*.read", false},
+		{"foo.*", "foo.*", true},
+		{"foo.*", "foo.bar*", true},
+		{"foo.*", "foo.**", false},
+		{"foo.*", "foo.*.bar", false},
+		{"foo.*", "foo.bar", false},
+		{"foo.**", "foo.bar", true},
+		{"foo.**", "foo.*.read", true},
+		{"foo.**", "foo*", false},
+		{"foo.*.read", "foo.bar.read", false},
+		{"foo.*.read", "foo.b*.read", true},
+		{"foo.*.read", "foo.**.read", false},
+	}
+	for _, c := range cases {
+		if CoverPermContent(c.cover, c.content) != c.covered {
+			t.Errorf("cover(%q, %q) should be %v", c.cover, c.content, c.covered)
+		}
+	}
+}
+
+func TestEvalGrantPerms(t *testing.T) {
+	perms := []Perm{
+		{CanWrite: true, Content: "foo."},
+		{Deny: true, Content: "foo.secret."},
+		{CanWrite: true, Content: "bar.*"},
+		{Content: "baz."},
+	}
+	cases := []struct {
+		content string
+		allowed bool
+	}{
+		{"foo.x", true},
+		{"foo.x*.y", true},
+		{"foo.s*", true},
+		{"foo.secret.x", false},
+		{"foo.", false},
+		{"foo.**", false},
+		{"foo.*.x", false},
+		{"bar.*", true},
+		{"bar.**", false},
+		{"bar.x", false},
+		{"baz.x", false},
+	}
+	for _, c := range cases {
+		if evalGrantPerms(perms, c.content) != c.allowed {
+			t.Errorf("evalGrant(%q) should be %v", c.content, c.allowed)
+		}
+	}
+}
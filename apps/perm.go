@@ -0,0 +1,231 @@
+package apps
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+const (
+	// PermActionGrant perm audit action grant
+	PermActionGrant = "grant"
+	// PermActionRevoke perm audit action revoke
+	PermActionRevoke = "revoke"
+
+	// PermPublicTarget name of public target
+	PermPublicTarget = "public"
+)
+
+var errPermConflict = errors.New("conflicting perm exists")
+
+func permKind(deny bool) string {
+	if deny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// PermAudit perm audit table
+type PermAudit struct {
+	ID         int64     `json:"id"`
+	Action     string    `json:"action"`
+	PermID     int64     `json:"perm_id"`
+	PermType   int       `json:"perm_type"`
+	TargetType int       `json:"target_type"`
+	TargetID   int64     `json:"target_id"`
+	CanWrite   bool      `json:"can_write"`
+	Deny       bool      `json:"deny"`
+	Content    string    `json:"content"`
+	Operator   string    `json:"operator"`
+	CreateTime time.Time `json:"create_time"`
+}
+
+func insertPermAudit(tx execer, action string, perm *Perm, operator string) error {
+	_, err := tx.Exec(`insert into perm_audits(action, perm_id, perm_type, target_type, target_id, can_write, deny, content, operator)
+                       values(?, ?, ?, ?, ?, ?, ?, ?, ?)`, action, perm.ID, perm.PermType, perm.TargetType, perm.TargetID,
+		perm.CanWrite, perm.Deny, perm.Content, operator)
+	return err
+}
+
+// ListPermAudits list perm audits of content prefix, latest first
+func ListPermAudits(db *sql.DB, prefix string, skip, limit int) ([]PermAudit, error) {
+	var audits []PermAudit
+	if err := dbutil.Query(db, &audits,
+		`select * from perm_audits where content like ? escape '\\' order by id desc limit ?,?`,
+		utils.EscapeLike(prefix)+"%", skip, limit); err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+// PermTarget get perm target id of app/group name, app name public is the public target
+func (ctrl *AppCtrl) PermTarget(targetType int, name string) (int64, error) {
+	switch targetType {
+	case PermTargetApp:
+		if name == PermPublicTarget {
+			return PermPublicTargetID, nil
+		}
+		app, err := ctrl.GetAppByName(name)
+		if err != nil {
+			return 0, err
+		}
+		if app == nil {
+			return 0, utils.Errorf(utils.EcodeNotFound, "no such app: %s", name)
+		}
+		return app.ID, nil
+	case PermTargetGroup:
+		group, err := ctrl.GetGroupByName(name)
+		if err != nil {
+			return 0, err
+		}
+		if group == nil {
+			return 0, utils.Errorf(utils.EcodeNotFound, "no such group: %s", name)
+		}
+		return group.ID, nil
+	}
+	return 0, utils.Errorf(utils.EcodeInvalidParam, "invalid target type: %d", targetType)
+}
+
+// GetPermByID get perm by id
+func (ctrl *AppCtrl) GetPermByID(id int64) (*Perm, error) {
+	perm, err := GetPermByID(ctrl.db, id)
+	if err != nil {
+		glog.Errorf("get perm(%d) fail: %v", id, err)
+		return nil, utils.NewSystemError("get perm fail")
+	}
+	return perm, nil
+}
+
+// GetPermByKey get perm by type, target & content
+func (ctrl *AppCtrl) GetPermByKey(permType, targetType int, targetID int64, content string) (*Perm, error) {
+	perm, err := GetPermByKey(ctrl.db, permType, targetType, targetID, content)
+	if err != nil {
+		glog.Errorf("get perm(%d, %d:%d, %s) fail: %v", permType, targetType, targetID, content, err)
+		return nil, utils.NewSystemError("get perm fail")
+	}
+	return perm, nil
+}
+
+// GrantPerm grant allow/deny perm recorded in audit,
+// write of existing allow(deny) perm is only upgraded(downgraded)
+func (ctrl *AppCtrl) GrantPerm(perm *Perm, operator string) error {
+	if !IsValidPermType(perm.PermType) {
+		return utils.Errorf(utils.EcodeInvalidParam, "invalid perm type: %d", perm.PermType)
+	}
+	if err := ctrl.grantPerm(perm, operator); err != nil {
+		if err == errPermConflict {
+			return utils.Errorf(utils.EcodeNameDuplicated, "conflicting %s perm exists: %s", permKind(!perm.Deny), perm.Content)
+		}
+		glog.Errorf("grant perm(%d, %d:%d, %s) fail: %v", perm.PermType, perm.TargetType, perm.TargetID, perm.Content, err)
+		return utils.NewSystemError("grant perm fail")
+	}
+	ctrl.permsChanged("grant: " + perm.Content)
+	return nil
+}
+
+func (ctrl *AppCtrl) grantPerm(perm *Perm, operator string) (rerr error) {
+	tx, err := ctrl.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr != nil {
+			if err := tx.Rollback(); err != nil {
+				glog.Warningf("tx rollback fail: %v", err)
+			}
+		}
+	}()
+
+	var existing Perm
+	row := tx.QueryRow(`select id, can_write, deny, create_time from perms
+                        where perm_type=? and target_type=? and target_id=? and content=? for update`,
+		perm.PermType, perm.TargetType, perm.TargetID, perm.Content)
+	if err := row.Scan(&existing.ID, &existing.CanWrite, &existing.Deny, &existing.CreateTime); err == sql.ErrNoRows {
+		rst, err := tx.Exec(`insert into perms(perm_type, target_type, target_id, can_write, deny, content)
+                             values(?, ?, ?, ?, ?, ?)`,
+			perm.PermType, perm.TargetType, perm.TargetID, perm.CanWrite, perm.Deny, perm.Content)
+		if err != nil {
+			return err
+		}
+		if perm.ID, err = rst.LastInsertId(); err != nil {
+			return err
+		}
+		perm.CreateTime = time.Now()
+	} else if err != nil {
+		return err
+	} else if existing.Deny != perm.Deny {
+		return errPermConflict
+	} else {
+		perm.ID, perm.CreateTime = existing.ID, existing.CreateTime
+		// allow perm is widened by write, deny perm is widened by no write
+		if existing.CanWrite == perm.CanWrite || perm.CanWrite == perm.Deny {
+			perm.CanWrite = existing.CanWrite
+			return tx.Rollback()
+		}
+		if _, err := tx.Exec(`update perms set can_write=? where id=?`, perm.CanWrite, perm.ID); err != nil {
+			return err
+		}
+	}
+	if err := insertPermAudit(tx, PermActionGrant, perm, operator); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokePerm revoke perm recorded in audit
+func (ctrl *AppCtrl) RevokePerm(perm *Perm, operator string) error {
+	if err := ctrl.revokePerm(perm, operator); err != nil {
+		if err == dbutil.ZeroEffected {
+			return utils.Errorf(utils.EcodeNotFound, "perm revoked already: %d", perm.ID)
+		}
+		glog.Errorf("revoke perm(%d) fail: %v", perm.ID, err)
+		return utils.NewSystemError("revoke perm fail")
+	}
+	ctrl.permsChanged("revoke: " + perm.Content)
+	return nil
+}
+
+func (ctrl *AppCtrl) revokePerm(perm *Perm, operator string) (rerr error) {
+	tx, err := ctrl.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr != nil {
+			if err := tx.Rollback(); err != nil {
+				glog.Warningf("tx rollback fail: %v", err)
+			}
+		}
+	}()
+
+	rst, err := tx.Exec(`delete from perms where id=?`, perm.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := rst.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return dbutil.ZeroEffected
+	}
+	if err := insertPermAudit(tx, PermActionRevoke, perm, operator); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListPermAudits list perm audits of content prefix
+func (ctrl *AppCtrl) ListPermAudits(prefix string, skip, limit int) ([]PermAudit, error) {
+	audits, err := ListPermAudits(ctrl.db, prefix, skip, limit)
+	if err != nil {
+		glog.Errorf("list perm audits fail: %v", err)
+		return nil, utils.NewSystemError("list perm audits fail")
+	}
+	if audits == nil {
+		audits = make([]PermAudit, 0)
+	}
+	return audits, nil
+}
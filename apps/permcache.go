@@ -0,0 +1,166 @@
+package apps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+type permKey struct {
+	permType   int
+	targetType int
+	targetID   int64
+}
+
+// permSnapshot in-memory apps, group members, perms & replaced certs in grace period for permission checks
+type permSnapshot struct {
+	apps       map[string]*App
+	appGroups  map[int64][]int64
+	perms      map[permKey][]Perm
+	graceCerts map[int64]map[string]AppCert
+}
+
+func newPermSnapshot(apps []App, groups []Group, members []GroupMember, perms []Perm, graceCerts []AppCert) *permSnapshot {
+	snapshot := &permSnapshot{
+		apps:       make(map[string]*App, len(apps)),
+		appGroups:  make(map[int64][]int64),
+		perms:      make(map[permKey][]Perm),
+		graceCerts: make(map[int64]map[string]AppCert)}
+	for i := range apps {
+		app := &apps[i]
+		app.PrivateKey = ""
+		snapshot.apps[app.Name] = app
+	}
+	okGroups := make(map[int64]bool, len(groups))
+	for _, group := range groups {
+		if group.Status == utils.StatusOk {
+			okGroups[group.ID] = true
+		}
+	}
+	for _, member := range members {
+		if okGroups[member.GroupID] {
+			snapshot.appGroups[member.AppID] = append(snapshot.appGroups[member.AppID], member.GroupID)
+		}
+	}
+	for _, perm := range perms {
+		key := permKey{perm.PermType, perm.TargetType, perm.TargetID}
+		snapshot.perms[key] = append(snapshot.perms[key], perm)
+	}
+	for _, cert := range graceCerts {
+		if snapshot.graceCerts[cert.AppID] == nil {
+			snapshot.graceCerts[cert.AppID] = make(map[string]AppCert)
+		}
+		cert.Cert = ""
+		snapshot.graceCerts[cert.AppID][cert.SerialNo] = cert
+	}
+	return snapshot
+}
+
+// graceCert get replaced cert of app in grace period
+func (snapshot *permSnapshot) graceCert(appID int64, serialNo string) (AppCert, bool) {
+	cert, ok := snapshot.graceCerts[appID][serialNo]
+	return cert, ok
+}
+
+// appGroup get copy of app & its group ids, nil if not found
+func (snapshot *permSnapshot) appGroup(name string) (*App, []int64) {
+	cached := snapshot.apps[name]
+	if cached == nil {
+		return nil, nil
+	}
+	app := *cached
+	return &app, snapshot.appGroups[app.ID]
+}
+
+// appPerms perms of type granted to app, its groups & public, same as GetAppPerms
+func (snapshot *permSnapshot) appPerms(permType int, appID int64, groupIDs []int64) []Perm {
+	perms := snapshot.perms[permKey{permType, PermTargetApp, PermPublicTargetID}]
+	if appID == PermPublicTargetID {
+		return perms
+	}
+	perms = append(perms[:len(perms):len(perms)], snapshot.perms[permKey{permType, PermTargetApp, appID}]...)
+	for _, groupID := range groupIDs {
+		perms = append(perms, snapshot.perms[permKey{permType, PermTargetGroup, groupID}]...)
+	}
+	return perms
+}
+
+// permCache perm snapshot, nil until loaded by RunPermWatcher
+type permCache struct {
+	sync.RWMutex
+	snapshot *permSnapshot
+}
+
+func (ctrl *AppCtrl) permsKey() string {
+	return ctrl.config.KeyPrefix + "-perms"
+}
+
+func (ctrl *AppCtrl) permSnapshot() *permSnapshot {
+	ctrl.permCache.RLock()
+	defer ctrl.permCache.RUnlock()
+	return ctrl.permCache.snapshot
+}
+
+// appPerms perms of type granted to app, its groups & public, from perm snapshot if loaded
+func (ctrl *AppCtrl) appPerms(permType int, appID int64, groupIDs []int64) ([]Perm, error) {
+	if snapshot := ctrl.permSnapshot(); snapshot != nil {
+		return snapshot.appPerms(permType, appID, groupIDs), nil
+	}
+	return GetAppPerms(ctrl.db, permType, appID, groupIDs)
+}
+
+// reloadPerms reload perm snapshot, the previous one is kept on failure
+func (ctrl *AppCtrl) reloadPerms() error {
+	apps, err := GetAppList(ctrl.db)
+	if err != nil {
+		return err
+	}
+	groups, err := GetGroupList(ctrl.db)
+	if err != nil {
+		return err
+	}
+	members, err := ListGroupMembers(ctrl.db)
+	if err != nil {
+		return err
+	}
+	perms, err := ListAllPerms(ctrl.db)
+	if err != nil {
+		return err
+	}
+	certs, err := ListGraceAppCerts(ctrl.db, time.Now())
+	if err != nil {
+		return err
+	}
+	snapshot := newPermSnapshot(apps, groups, members, perms, certs)
+
+	ctrl.permCache.Lock()
+	defer ctrl.permCache.Unlock()
+	ctrl.permCache.snapshot = snapshot
+	return nil
+}
+
+// permsChanged reload local perm snapshot & notify others, missed ones are covered by periodical reload
+func (ctrl *AppCtrl) permsChanged(reason string) {
+	if ctrl.permSnapshot() != nil {
+		if err := ctrl.reloadPerms(); err != nil {
+			glog.Warningf("reload perms fail: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ctrl.config.RequestTimeout)
+	defer cancel()
+	if _, err := ctrl.etcdClient.Put(ctx, ctrl.permsKey(), reason); err != nil {
+		glog.Warningf("notify perms change(%s) fail: %v", reason, err)
+	}
+}
+
+// RunPermWatcher load perm snapshot, then reload on changes & periodically;
+// permission checks query db directly until loaded
+func (ctrl *AppCtrl) RunPermWatcher() {
+	if err := ctrl.reloadPerms(); err != nil {
+		glog.Errorf("load perms fail: %v", err)
+	}
+	utils.RunReloader(ctrl.etcdClient, "perms", ctrl.permsKey(), ctrl.config.PermRefreshInterval, ctrl.reloadPerms)
+}
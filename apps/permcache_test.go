@@ -0,0 +1,55 @@
+package apps
+
+import (
+	"context"
+	"testing"
+
+	"github.com/infrmods/xbus/utils"
+)
+
+func TestPermSnapshot(t *testing.T) {
+	snapshot := newPermSnapshot(
+		[]App{{ID: 1, Name: "foo", PrivateKey: "key"}, {ID: 2, Name: "bar"}},
+		[]Group{{ID: 10, Status: utils.StatusOk}, {ID: 11, Status: utils.StatusDeleted}},
+		[]GroupMember{{AppID: 1, GroupID: 10}, {AppID: 1, GroupID: 11}},
+		[]Perm{
+			{PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: PermPublicTargetID, Content: "public."},
+			{PermType: PermTypeConfig, TargetType: PermTargetApp, TargetID: 1, Content: "app."},
+			{PermType: PermTypeConfig, TargetType: PermTargetGroup, TargetID: 10, Content: "group."},
+			{PermType: PermTypeConfig, TargetType: PermTargetGroup, TargetID: 11, Content: "deleted."},
+			{PermType: PermTypeService, TargetType: PermTargetApp, TargetID: 1, Content: "service."},
+		}, nil)
+
+	app, groupIDs := snapshot.appGroup("foo")
+	if app == nil || app.ID != 1 || app.PrivateKey != "" {
+		t.Fatalf("unexpected app: %#v", app)
+	}
+	if len(groupIDs) != 1 || groupIDs[0] != 10 {
+		t.Fatalf("unexpected groups: %v", groupIDs)
+	}
+	if app, _ := snapshot.appGroup("baz"); app != nil {
+		t.Fatalf("unexpected app: %#v", app)
+	}
+
+	for name, allowed := range map[string]bool{
+		"public.x": true, "app.x": true, "group.x": true, "deleted.x": false, "service.x": false} {
+		if EvalPerms(snapshot.appPerms(PermTypeConfig, 1, groupIDs), false, name) != allowed {
+			t.Errorf("app perm of %s should be %v", name, allowed)
+		}
+	}
+	if perms := snapshot.appPerms(PermTypeConfig, PermPublicTargetID, nil); len(perms) != 1 {
+		t.Errorf("unexpected public perms: %v", perms)
+	}
+}
+
+func TestPermsChanged(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	ctrl.permsChanged("grant perm")
+	resp, err := ctrl.etcdClient.Get(context.Background(), ctrl.permsKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "grant perm" {
+		t.Fatalf("unexpected perms key: %v", resp.Kvs)
+	}
+}
@@ -0,0 +1,148 @@
+package apps
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// RevokedCert revoked cert table
+type RevokedCert struct {
+	ID         int64     `json:"id"`
+	SerialNo   string    `json:"serial_no"`
+	AppID      int64     `json:"app_id"`
+	Reason     string    `json:"reason"`
+	RevokeTime time.Time `json:"revoke_time"`
+}
+
+// InsertRevokedCert insert revoked cert, ZeroEffected if revoked already
+func InsertRevokedCert(db *sql.DB, cert *RevokedCert) error {
+	id, err := dbutil.Insert(db,
+		`insert ignore into revoked_certs(serial_no, app_id, reason) values(?, ?, ?)`,
+		cert.SerialNo, cert.AppID, cert.Reason)
+	if err != nil {
+		return err
+	}
+	cert.ID = id
+	return nil
+}
+
+// ListRevokedCerts list revoked certs
+func ListRevokedCerts(db *sql.DB) ([]RevokedCert, error) {
+	var certs []RevokedCert
+	if err := dbutil.Query(db, &certs, `select * from revoked_certs order by id`); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// revocationList cached revoked serials & crl
+type revocationList struct {
+	sync.RWMutex
+	certs     []RevokedCert
+	serials   map[string]bool
+	crl       []byte
+	crlUpdate time.Time
+}
+
+func (ctrl *AppCtrl) revokedKey() string {
+	return ctrl.config.KeyPrefix + "-revoked"
+}
+
+func (ctrl *AppCtrl) reloadRevoked() error {
+	certs, err := ListRevokedCerts(ctrl.db)
+	if err != nil {
+		return err
+	}
+	serials := make(map[string]bool, len(certs))
+	for _, cert := range certs {
+		serials[cert.SerialNo] = true
+	}
+
+	ctrl.revoked.Lock()
+	defer ctrl.revoked.Unlock()
+	if len(certs) != len(ctrl.revoked.certs) {
+		ctrl.revoked.crl = nil
+	}
+	ctrl.revoked.certs = certs
+	ctrl.revoked.serials = serials
+	return nil
+}
+
+// IsCertRevoked is cert revoked
+func (ctrl *AppCtrl) IsCertRevoked(cert *x509.Certificate) bool {
+	ctrl.revoked.RLock()
+	defer ctrl.revoked.RUnlock()
+	return ctrl.revoked.serials[cert.SerialNumber.String()]
+}
+
+// RevokeCert revoke cert of app by serial no
+func (ctrl *AppCtrl) RevokeCert(ctx context.Context, app *App, serialNo, reason string) error {
+	if current, err := utils.DecodeCertificateFromPem(app.Cert); err != nil || current.SerialNumber.String() != serialNo {
+		cert, err := GetAppCertBySerial(ctrl.db, app.ID, serialNo)
+		if err != nil {
+			glog.Errorf("get app(%s) cert(%s) fail: %v", app.Name, serialNo, err)
+			return utils.NewSystemError("get app cert fail")
+		}
+		if cert == nil {
+			return utils.Errorf(utils.EcodeNotFound, "no such cert of app(%s): %s", app.Name, serialNo)
+		}
+	}
+
+	revoked := RevokedCert{SerialNo: serialNo, AppID: app.ID, Reason: reason}
+	if err := InsertRevokedCert(ctrl.db, &revoked); err != nil {
+		if err == dbutil.ZeroEffected {
+			return utils.Errorf(utils.EcodeInvalidStatus, "cert revoked already: %s", serialNo)
+		}
+		glog.Errorf("insert revoked cert(%s) fail: %v", serialNo, err)
+		return utils.NewSystemError("revoke cert fail")
+	}
+	if err := ctrl.reloadRevoked(); err != nil {
+		glog.Warningf("reload revoked certs fail: %v", err)
+	}
+	if _, err := ctrl.etcdClient.Put(ctx, ctrl.revokedKey(), serialNo); err != nil {
+		return utils.CleanErr(err, "notify revocation fail", "put revoked key fail: %v", err)
+	}
+	return nil
+}
+
+// RunRevocationWatcher reload revoked certs on changes, and periodically in case of missed notifications
+func (ctrl *AppCtrl) RunRevocationWatcher() {
+	utils.RunReloader(ctrl.etcdClient, "revoked certs", ctrl.revokedKey(), ctrl.config.RevokedRefreshInterval, ctrl.reloadRevoked)
+}
+
+// CRL get der encoded crl signed by root, regenerated on revocation or half of validity
+func (ctrl *AppCtrl) CRL() ([]byte, error) {
+	now := time.Now()
+	ctrl.revoked.RLock()
+	crl, crlUpdate := ctrl.revoked.crl, ctrl.revoked.crlUpdate
+	ctrl.revoked.RUnlock()
+	if crl != nil && now.Before(crlUpdate.Add(ctrl.config.CRLValidity/2)) {
+		return crl, nil
+	}
+
+	ctrl.revoked.Lock()
+	defer ctrl.revoked.Unlock()
+	entries := make([]x509.RevocationListEntry, 0, len(ctrl.revoked.certs))
+	for _, cert := range ctrl.revoked.certs {
+		serial, ok := new(big.Int).SetString(cert.SerialNo, 10)
+		if !ok {
+			glog.Warningf("invalid revoked serial: %s", cert.SerialNo)
+			continue
+		}
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: cert.RevokeTime})
+	}
+	crl, err := ctrl.CertsManager.NewCRL(entries, big.NewInt(now.Unix()), now, now.Add(ctrl.config.CRLValidity))
+	if err != nil {
+		return nil, err
+	}
+	ctrl.revoked.crl, ctrl.revoked.crlUpdate = crl, now
+	return crl, nil
+}
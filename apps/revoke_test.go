@@ -0,0 +1,99 @@
+package apps
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+var revokedColumns = []string{"id", "serial_no", "app_id", "reason", "revoke_time"}
+
+func TestRevokeCert(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	app := newTestApp(t, ctrl, 1, "foo")
+	cert, err := app.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := cert.SerialNumber.String()
+	now := time.Now()
+
+	// current cert of app, no cert lookup
+	mock.ExpectExec(`insert ignore into revoked_certs`).WithArgs(serial, int64(1), "leaked").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`select \* from revoked_certs`).WillReturnRows(
+		sqlmock.NewRows(revokedColumns).AddRow(1, serial, 1, "leaked", now))
+	if err := ctrl.RevokeCert(context.Background(), app, serial, "leaked"); err != nil {
+		t.Fatalf("revoke cert fail: %v", err)
+	}
+	if !ctrl.IsCertRevoked(cert) {
+		t.Errorf("cert should be revoked")
+	}
+	if resp, err := ctrl.etcdClient.Get(context.Background(), ctrl.revokedKey()); err != nil ||
+		len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != serial {
+		t.Errorf("revocation not notified: %v", err)
+	}
+
+	mock.ExpectExec(`insert ignore into revoked_certs`).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := ctrl.RevokeCert(context.Background(), app, serial, "leaked"); errCode(err) != utils.EcodeInvalidStatus {
+		t.Errorf("expect revoked already, got %v", err)
+	}
+
+	// other certs must be certs of app
+	mock.ExpectQuery(`select \* from app_certs where app_id=\? and serial_no=\?`).WithArgs(int64(1), "12345").
+		WillReturnError(sqlmock.ErrCancelled)
+	if err := ctrl.RevokeCert(context.Background(), app, "12345", ""); errCode(err) != utils.EcodeSystemError {
+		t.Errorf("expect system error, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestCRL(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	now := time.Now()
+
+	mock.ExpectQuery(`select \* from revoked_certs`).WillReturnRows(
+		sqlmock.NewRows(revokedColumns).AddRow(1, "101", 1, "", now).AddRow(2, "invalid", 1, "", now))
+	if err := ctrl.reloadRevoked(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ctrl.CRL()
+	if err != nil {
+		t.Fatalf("new crl fail: %v", err)
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		t.Fatalf("parse crl fail: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(ctrl.CertsManager.rootCert); err != nil {
+		t.Errorf("check crl signature fail: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.String() != "101" {
+		t.Errorf("unexpected crl entries: %v", crl.RevokedCertificateEntries)
+	}
+	if !crl.NextUpdate.After(now.Add(ctrl.config.CRLValidity - time.Minute)) {
+		t.Errorf("unexpected next update: %v", crl.NextUpdate)
+	}
+
+	// cached until revoked certs changed
+	if cached, _ := ctrl.CRL(); string(cached) != string(data) {
+		t.Errorf("crl should be cached")
+	}
+	mock.ExpectQuery(`select \* from revoked_certs`).WillReturnRows(
+		sqlmock.NewRows(revokedColumns).AddRow(1, "101", 1, "", now).AddRow(2, "invalid", 1, "", now).
+			AddRow(3, "102", 1, "", now))
+	if err := ctrl.reloadRevoked(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ctrl.CRL()
+	if crl, err := x509.ParseRevocationList(data); err != nil || len(crl.RevokedCertificateEntries) != 2 {
+		t.Errorf("crl not regenerated: %v", err)
+	}
+	checkMockDB(t, mock)
+}
@@ -0,0 +1,68 @@
+package apps
+
+import (
+	"context"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+	"google.golang.org/grpc/codes"
+)
+
+func (ctrl *AppCtrl) setAppStatus(app *App, status int, statusName string) error {
+	if err := UpdateAppStatus(ctrl.db, app.ID, status); err != nil {
+		if err == dbutil.ZeroEffected {
+			return utils.Errorf(utils.EcodeInvalidStatus, "app(%s) is %s already", app.Name, statusName)
+		}
+		glog.Errorf("update app(%s) status fail: %v", app.Name, err)
+		return utils.NewSystemError("update app status fail")
+	}
+	app.Status = status
+	ctrl.permsChanged("app status: " + app.Name)
+	return nil
+}
+
+// EnableApp enable disabled app
+func (ctrl *AppCtrl) EnableApp(app *App) error {
+	return ctrl.setAppStatus(app, utils.StatusOk, "enabled")
+}
+
+// DisableApp disable app, requests of app are rejected;
+// leases of its online app nodes are revoked if revokeLeases,
+// and its app nodes are removed if unplugNodes
+func (ctrl *AppCtrl) DisableApp(ctx context.Context, app *App, revokeLeases, unplugNodes bool) error {
+	if err := ctrl.setAppStatus(app, utils.StatusDisabled, "disabled"); err != nil {
+		return err
+	}
+	if !revokeLeases && !unplugNodes {
+		return nil
+	}
+
+	prefix := ctrl.appKeyPrefix(app.Name)
+	if revokeLeases {
+		resp, err := ctrl.etcdClient.Get(ctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			return utils.CleanErr(err, "get app nodes fail", "get app(%s) nodes fail: %v", app.Name, err)
+		}
+		revoked := make(map[int64]bool)
+		for _, kv := range resp.Kvs {
+			if kv.Lease == 0 || revoked[kv.Lease] || ctrl.parseOnlineNodeKey(string(kv.Key)) == "" {
+				continue
+			}
+			if _, err := ctrl.etcdClient.Revoke(ctx, clientv3.LeaseID(kv.Lease)); err != nil {
+				if code, err := utils.CleanErrWithCode(err, "revoke lease fail",
+					"revoke app(%s) lease(%d) fail: %v", app.Name, kv.Lease, err); code != codes.NotFound {
+					return err
+				}
+			}
+			revoked[kv.Lease] = true
+		}
+	}
+	if unplugNodes {
+		if _, err := ctrl.etcdClient.Delete(ctx, prefix, clientv3.WithPrefix()); err != nil {
+			return utils.CleanErr(err, "remove app nodes fail", "remove app(%s) nodes fail: %v", app.Name, err)
+		}
+	}
+	return nil
+}
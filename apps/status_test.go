@@ -0,0 +1,121 @@
+package apps
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/infrmods/xbus/utils"
+)
+
+// plugTestNodes plug online app nodes with a lease each, returns the leases
+func plugTestNodes(t *testing.T, ctrl *AppCtrl, app string, keys ...string) []clientv3.LeaseID {
+	ctx := context.Background()
+	leases := make([]clientv3.LeaseID, 0, len(keys))
+	for _, key := range keys {
+		lease, err := ctrl.etcdClient.Grant(ctx, 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ctrl.PlugAppNode(ctx, app, &AppNode{Key: key, Config: "{}"}, lease.ID); err != nil {
+			t.Fatalf("plug app node fail: %v", err)
+		}
+		leases = append(leases, lease.ID)
+	}
+	return leases
+}
+
+func expectAppStatus(mock sqlmock.Sqlmock, status int, effected int64) {
+	mock.ExpectExec(`update apps set status=\?`).WithArgs(status, 1, status).
+		WillReturnResult(sqlmock.NewResult(0, effected))
+}
+
+func TestEnableApp(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	app := &App{ID: 1, Status: utils.StatusDisabled, Name: "foo"}
+
+	expectAppStatus(mock, utils.StatusOk, 1)
+	if err := ctrl.EnableApp(app); err != nil || app.Status != utils.StatusOk {
+		t.Fatalf("enable app fail: %v", err)
+	}
+	if resp, err := ctrl.etcdClient.Get(context.Background(), ctrl.permsKey()); err != nil || len(resp.Kvs) != 1 {
+		t.Errorf("perms change not notified: %v", err)
+	}
+	expectAppStatus(mock, utils.StatusOk, 0)
+	if err := ctrl.EnableApp(app); errCode(err) != utils.EcodeInvalidStatus {
+		t.Errorf("expect invalid status, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestDisableApp(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctx := context.Background()
+	countNodes := func(app string) int {
+		resp, err := ctrl.etcdClient.Get(ctx, ctrl.appKeyPrefix(app), clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(resp.Count)
+	}
+	leaseAlive := func(lease clientv3.LeaseID) bool {
+		resp, err := ctrl.etcdClient.TimeToLive(ctx, lease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.TTL > 0
+	}
+
+	// app nodes are kept by default
+	plugTestNodes(t, ctrl, "foo", "node1")
+	app := &App{ID: 1, Status: utils.StatusOk, Name: "foo"}
+	expectAppStatus(mock, utils.StatusDisabled, 1)
+	if err := ctrl.DisableApp(ctx, app, false, false); err != nil || app.Status != utils.StatusDisabled {
+		t.Fatalf("disable app fail: %v", err)
+	}
+	if n := countNodes("foo"); n != 2 {
+		t.Errorf("expect app nodes kept, got %d keys", n)
+	}
+	expectAppStatus(mock, utils.StatusDisabled, 0)
+	if err := ctrl.DisableApp(ctx, app, true, true); errCode(err) != utils.EcodeInvalidStatus {
+		t.Errorf("expect invalid status, got %v", err)
+	}
+
+	// leases of online nodes are revoked, hold keys are kept
+	leases := plugTestNodes(t, ctrl, "bar", "node1", "node2")
+	other := plugTestNodes(t, ctrl, "barx", "node1")
+	app = &App{ID: 1, Status: utils.StatusOk, Name: "bar"}
+	expectAppStatus(mock, utils.StatusDisabled, 1)
+	if err := ctrl.DisableApp(ctx, app, true, false); err != nil {
+		t.Fatalf("disable app fail: %v", err)
+	}
+	for _, lease := range leases {
+		if leaseAlive(lease) {
+			t.Errorf("lease %d of app not revoked", lease)
+		}
+	}
+	if n := countNodes("bar"); n != 2 {
+		t.Errorf("expect hold keys kept, got %d keys", n)
+	}
+	if !leaseAlive(other[0]) {
+		t.Errorf("lease of other app revoked")
+	}
+
+	// app nodes are removed
+	plugTestNodes(t, ctrl, "baz", "node1")
+	app = &App{ID: 1, Status: utils.StatusOk, Name: "baz"}
+	expectAppStatus(mock, utils.StatusDisabled, 1)
+	if err := ctrl.DisableApp(ctx, app, false, true); err != nil {
+		t.Fatalf("disable app fail: %v", err)
+	}
+	if n := countNodes("baz"); n != 0 {
+		t.Errorf("expect app nodes removed, got %d keys", n)
+	}
+	if n := countNodes("barx"); n != 2 {
+		t.Errorf("expect nodes of other app kept, got %d keys", n)
+	}
+	checkMockDB(t, mock)
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/gocomm/config"
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+	"github.com/infrmods/xbus/configs"
+	"github.com/infrmods/xbus/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// AgentTemplate agent template, rendered to dest when any of its configs changes
+type AgentTemplate struct {
+	Source   string   // template file path
+	Template string   // inline template, used if source is empty
+	Dest     string   // output file path
+	Perms    string   // output file mode, 0644 if empty
+	Configs  []string // configs used by template
+	Command  string   // reload command, run by sh -c
+	Signal   string   // signal sent to process of pid_file: HUP, USR1, USR2, TERM, INT
+	PidFile  string   `yaml:"pid_file"`
+	Timeout  time.Duration
+	template *template.Template
+	mode     os.FileMode
+}
+
+// AgentConfig agent config
+type AgentConfig struct {
+	Endpoint      string        `default:"https://127.0.0.1:4433"`
+	CertFile      string        `default:"appcert.pem" yaml:"cert_file"`
+	KeyFile       string        `default:"appkey.pem" yaml:"key_file"`
+	CAFile        string        `yaml:"ca_file"`
+	Env           string        // config env, app's env if empty
+	Node          string        // app node, hostname if empty
+	WatchTimeout  time.Duration `default:"60s" yaml:"watch_timeout"`
+	RetryInterval time.Duration `default:"5s" yaml:"retry_interval"`
+	Templates     []*AgentTemplate
+}
+
+// AgentCmd agent cmd
+type AgentCmd struct {
+	once bool
+}
+
+// Name cmd name
+func (cmd *AgentCmd) Name() string {
+	return "agent"
+}
+
+// Synopsis cmd synopsis
+func (cmd *AgentCmd) Synopsis() string {
+	return "render configs to files and reload on changes"
+}
+
+// Usage cmd usage
+func (cmd *AgentCmd) Usage() string {
+	return "agent [OPTIONS] agent.yaml\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *AgentCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&cmd.once, "once", false, "render once and exit")
+}
+
+// Execute cmd execute
+func (cmd *AgentCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		glog.Errorf("missing agent config file")
+		return subcommands.ExitUsageError
+	}
+	var cfg AgentConfig
+	if err := config.LoadFromFileF(f.Arg(0), &cfg, yaml.Unmarshal); err != nil {
+		glog.Errorf("load agent config fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	agent, err := NewAgent(&cfg)
+	if err != nil {
+		glog.Errorf("create agent fail: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		cancel()
+	}()
+	if err := agent.Run(ctx, cmd.once); err != nil && err != context.Canceled {
+		glog.Errorf("agent fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// Agent config file agent
+type Agent struct {
+	config *AgentConfig
+	client *http.Client
+	names  []string
+
+	values   map[string]string
+	revision int64
+}
+
+// NewAgent new agent
+func NewAgent(cfg *AgentConfig) (*Agent, error) {
+	if len(cfg.Templates) == 0 {
+		return nil, fmt.Errorf("no templates")
+	}
+	nameSet := make(map[string]bool)
+	for _, tmpl := range cfg.Templates {
+		if err := tmpl.prepare(); err != nil {
+			return nil, err
+		}
+		for _, name := range tmpl.Configs {
+			nameSet[name] = true
+		}
+	}
+	names := make([]string, 0, len(nameSet))
+	for name := range nameSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no configs")
+	}
+
+	if cfg.Node == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("get hostname fail: %v", err)
+		}
+		cfg.Node = hostname
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		Timeout:   cfg.WatchTimeout + 10*time.Second,
+	}
+	return &Agent{config: cfg, client: client, names: names}, nil
+}
+
+func (cfg *AgentConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := new(tls.Config)
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load app key/cert fail: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		data, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file fail: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("invalid ca file: %s", cfg.CAFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+func (tmpl *AgentTemplate) prepare() error {
+	if tmpl.Dest == "" {
+		return fmt.Errorf("missing template dest")
+	}
+	text := tmpl.Template
+	if tmpl.Source != "" {
+		data, err := ioutil.ReadFile(tmpl.Source)
+		if err != nil {
+			return fmt.Errorf("read template(%s) fail: %v", tmpl.Source, err)
+		}
+		text = string(data)
+	}
+	t, err := template.New(tmpl.Dest).Funcs(agentFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("parse template(%s) fail: %v", tmpl.Dest, err)
+	}
+	tmpl.template = t
+
+	tmpl.mode = 0644
+	if tmpl.Perms != "" {
+		mode, err := strconv.ParseUint(tmpl.Perms, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid perms(%s) of %s", tmpl.Perms, tmpl.Dest)
+		}
+		tmpl.mode = os.FileMode(mode)
+	}
+	if tmpl.Signal != "" {
+		if _, err := parseAgentSignal(tmpl.Signal); err != nil {
+			return err
+		}
+		if tmpl.PidFile == "" {
+			return fmt.Errorf("missing pid_file of %s", tmpl.Dest)
+		}
+	}
+	if tmpl.Timeout <= 0 {
+		tmpl.Timeout = 30 * time.Second
+	}
+	return nil
+}
+
+// agentTemplateData template data, configs are also accessible by config func
+type agentTemplateData struct {
+	Configs  map[string]string
+	Revision int64
+}
+
+var agentFuncs = template.FuncMap{
+	"parseJSON": func(s string) (interface{}, error) {
+		var v interface{}
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err
+	},
+	"parseYAML": func(s string) (interface{}, error) {
+		var v interface{}
+		err := yaml.Unmarshal([]byte(s), &v)
+		return v, err
+	},
+	// placeholders, bound to agent values on render
+	"config":    func(name string) (string, error) { return "", nil },
+	"hasConfig": func(name string) bool { return false },
+}
+
+// render render template with values
+func (tmpl *AgentTemplate) render(values map[string]string, revision int64) ([]byte, error) {
+	t, err := tmpl.template.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{
+		"config": func(name string) (string, error) {
+			if v, ok := values[name]; ok {
+				return v, nil
+			}
+			return "", fmt.Errorf("config not found: %s", name)
+		},
+		"hasConfig": func(name string) bool {
+			_, ok := values[name]
+			return ok
+		},
+	})
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, agentTemplateData{Configs: values, Revision: revision}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic write file by renaming a temp file in the same dir,
+// returns false if content is not changed
+func writeFileAtomic(path string, mode os.FileMode, data []byte) (bool, error) {
+	if old, err := ioutil.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm() == mode.Perm() {
+			return false, nil
+		}
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return false, err
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	return true, nil
+}
+
+func (tmpl *AgentTemplate) reload() error {
+	if tmpl.Command != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), tmpl.Timeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "sh", "-c", tmpl.Command).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("run command(%s) fail: %v, output: %s", tmpl.Command, err, out)
+		}
+	}
+	if tmpl.Signal != "" {
+		data, err := ioutil.ReadFile(tmpl.PidFile)
+		if err != nil {
+			return fmt.Errorf("read pid file fail: %v", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return fmt.Errorf("invalid pid file(%s): %v", tmpl.PidFile, err)
+		}
+		sig, err := parseAgentSignal(tmpl.Signal)
+		if err != nil {
+			return err
+		}
+		if err := signalProcess(pid, sig); err != nil {
+			return fmt.Errorf("send %s to %d fail: %v", tmpl.Signal, pid, err)
+		}
+	}
+	return nil
+}
+
+// Run fetch configs & render templates, then watch changes until ctx done
+func (agent *Agent) Run(ctx context.Context, once bool) error {
+	for {
+		if err := agent.fetch(ctx); err == nil {
+			break
+		} else if once {
+			return err
+		} else {
+			glog.Errorf("fetch configs fail: %v", err)
+		}
+		if err := agent.sleep(ctx); err != nil {
+			return err
+		}
+	}
+	agent.renderAll(agent.config.Templates)
+	if once {
+		return nil
+	}
+
+	for {
+		changes, err := agent.watch(ctx)
+		if err != nil {
+			if e, ok := err.(*utils.Error); ok && e.Code == utils.EcodeDeadlineExceeded {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			glog.Errorf("watch configs fail: %v", err)
+			if err := agent.sleep(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		agent.renderAll(agent.apply(changes))
+	}
+}
+
+func (agent *Agent) sleep(ctx context.Context) error {
+	select {
+	case <-time.After(agent.config.RetryInterval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (agent *Agent) renderAll(tmpls []*AgentTemplate) {
+	for _, tmpl := range tmpls {
+		data, err := tmpl.render(agent.values, agent.revision)
+		if err != nil {
+			glog.Errorf("render %s fail: %v", tmpl.Dest, err)
+			continue
+		}
+		changed, err := writeFileAtomic(tmpl.Dest, tmpl.mode, data)
+		if err != nil {
+			glog.Errorf("write %s fail: %v", tmpl.Dest, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		glog.Infof("%s updated(revision: %d)", tmpl.Dest, agent.revision)
+		if err := tmpl.reload(); err != nil {
+			glog.Errorf("reload %s fail: %v", tmpl.Dest, err)
+		}
+	}
+}
+
+// apply apply changes, returns templates affected
+func (agent *Agent) apply(changes *configs.ConfigChanges) []*AgentTemplate {
+	changed := make(map[string]bool)
+	if changes.Snapshot {
+		for name := range agent.values {
+			changed[name] = true
+		}
+		agent.values = make(map[string]string)
+	}
+	for _, cfg := range changes.Configs {
+		if old, ok := agent.values[cfg.Name]; !ok || old != cfg.Value || changes.Snapshot {
+			changed[cfg.Name] = true
+		}
+		agent.values[cfg.Name] = cfg.Value
+	}
+	for _, name := range changes.Deleted {
+		if _, ok := agent.values[name]; ok {
+			changed[name] = true
+			delete(agent.values, name)
+		}
+	}
+	if changes.Revision > agent.revision {
+		agent.revision = changes.Revision
+	}
+
+	var tmpls []*AgentTemplate
+	for _, tmpl := range agent.config.Templates {
+		for _, name := range tmpl.Configs {
+			if changed[name] {
+				tmpls = append(tmpls, tmpl)
+				break
+			}
+		}
+	}
+	return tmpls
+}
+
+// fetch get configs one by one, missing configs are skipped;
+// revision is the earliest one so no change is missed by watch
+func (agent *Agent) fetch(ctx context.Context) error {
+	values := make(map[string]string, len(agent.names))
+	var revision int64
+	for _, name := range agent.names {
+		var result struct {
+			Config   *configs.ConfigItem `json:"config"`
+			Revision int64               `json:"revision"`
+		}
+		if err := agent.get(ctx, "/api/configs/"+url.PathEscape(name), nil, &result); err != nil {
+			if e, ok := err.(*utils.Error); ok && e.Code == utils.EcodeNotFound {
+				glog.Warningf("config not found: %s", name)
+				continue
+			}
+			return err
+		}
+		values[name] = result.Config.Value
+		if revision == 0 || result.Revision < revision {
+			revision = result.Revision
+		}
+	}
+	agent.values = values
+	agent.revision = revision
+	return nil
+}
+
+func (agent *Agent) watch(ctx context.Context) (*configs.ConfigChanges, error) {
+	keys, _ := json.Marshal(agent.names)
+	params := url.Values{"keys": []string{string(keys)}, "watch": []string{"true"},
+		"revision": []string{strconv.FormatInt(agent.revision+1, 10)},
+		"timeout":  []string{strconv.FormatInt(int64(agent.config.WatchTimeout/time.Second), 10)}}
+	var changes configs.ConfigChanges
+	if err := agent.get(ctx, "/api/configs", params, &changes); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
+func (agent *Agent) get(ctx context.Context, path string, params url.Values, result interface{}) error {
+	u := strings.TrimRight(agent.config.Endpoint, "/") + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if agent.config.Env != "" {
+		req.Header.Set("env", agent.config.Env)
+	}
+	req.Header.Set("node", agent.config.Node)
+	resp, err := agent.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		Ok     bool            `json:"ok"`
+		Result json.RawMessage `json:"result"`
+		Error  *utils.Error    `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("decode response(status: %d) fail: %v", resp.StatusCode, err)
+	}
+	if !r.Ok {
+		if r.Error == nil {
+			return fmt.Errorf("request fail, status: %d", resp.StatusCode)
+		}
+		return r.Error
+	}
+	return json.Unmarshal(r.Result, result)
+}
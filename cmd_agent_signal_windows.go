@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// parseAgentSignal signals are not supported on windows, use command instead
+func parseAgentSignal(name string) (syscall.Signal, error) {
+	return 0, fmt.Errorf("signal(%s) is not supported on windows", name)
+}
+
+func signalProcess(pid int, sig syscall.Signal) error {
+	return fmt.Errorf("signal is not supported on windows")
+}
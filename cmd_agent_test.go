@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/infrmods/xbus/configs"
+)
+
+func TestAgentRender(t *testing.T) {
+	root, err := ioutil.TempDir("", "xbus-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dbTmpl := &AgentTemplate{Dest: filepath.Join(root, "db.conf"), Configs: []string{"db.host", "db.opts"},
+		Template: `host={{config "db.host"}}{{with parseJSON (config "db.opts")}} pool={{.pool}}{{end}}`}
+	logTmpl := &AgentTemplate{Dest: filepath.Join(root, "log.conf"), Configs: []string{"log.level"},
+		Template: `level={{if hasConfig "log.level"}}{{config "log.level"}}{{else}}info{{end}}`}
+	agent := &Agent{config: &AgentConfig{Templates: []*AgentTemplate{dbTmpl, logTmpl}},
+		values: map[string]string{"db.host": "a", "db.opts": `{"pool": 10}`}}
+	for _, tmpl := range agent.config.Templates {
+		if err := tmpl.prepare(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	agent.renderAll(agent.config.Templates)
+	assertFile := func(path, expected string) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, data)
+		}
+	}
+	assertFile(dbTmpl.Dest, "host=a pool=10")
+	assertFile(logTmpl.Dest, "level=info")
+
+	tmpls := agent.apply(&configs.ConfigChanges{Configs: []*configs.ConfigItem{{Name: "db.host", Value: "b"}},
+		Deleted: []string{"db.opts"}, Revision: 10})
+	if len(tmpls) != 1 || tmpls[0] != dbTmpl {
+		t.Fatalf("unexpected affected templates: %v", tmpls)
+	}
+	agent.renderAll(tmpls)
+	// render fails on missing config, the old file is kept
+	assertFile(dbTmpl.Dest, "host=a pool=10")
+
+	if changed, err := writeFileAtomic(logTmpl.Dest, 0644, []byte("level=info")); err != nil {
+		t.Fatal(err)
+	} else if changed {
+		t.Errorf("unchanged content rewritten")
+	}
+}
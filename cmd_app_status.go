@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+)
+
+// AppStatusCmd disable/enable app cmd
+type AppStatusCmd struct {
+	disable      bool
+	revokeLeases bool
+	unplugNodes  bool
+}
+
+// Name cmd name
+func (cmd *AppStatusCmd) Name() string {
+	if cmd.disable {
+		return "disable-app"
+	}
+	return "enable-app"
+}
+
+// Synopsis cmd synopsis
+func (cmd *AppStatusCmd) Synopsis() string {
+	if cmd.disable {
+		return "disable app, its requests are rejected"
+	}
+	return "enable disabled app"
+}
+
+// Usage cmd usage
+func (cmd *AppStatusCmd) Usage() string {
+	return cmd.Name() + " [OPTIONS] app\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *AppStatusCmd) SetFlags(f *flag.FlagSet) {
+	if cmd.disable {
+		f.BoolVar(&cmd.revokeLeases, "revoke-leases", false, "revoke leases of online app nodes")
+		f.BoolVar(&cmd.unplugNodes, "unplug-nodes", false, "remove app nodes")
+	}
+}
+
+// Execute cmd execute
+func (cmd *AppStatusCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	name := f.Arg(0)
+	app, err := appCtrl.GetAppByName(name)
+	if err != nil {
+		glog.Errorf("get app(%s) fail: %v", name, err)
+		return subcommands.ExitFailure
+	}
+	if app == nil {
+		glog.Errorf("no such app: %s", name)
+		return subcommands.ExitFailure
+	}
+	if cmd.disable {
+		err = appCtrl.DisableApp(ctx, app, cmd.revokeLeases, cmd.unplugNodes)
+	} else {
+		err = appCtrl.EnableApp(app)
+	}
+	if err != nil {
+		glog.Errorf("%s(%s) fail: %v", cmd.Name(), name, err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+	"github.com/infrmods/xbus/configs"
+)
+
+// ConfigCmd config cmd
+type ConfigCmd struct {
+}
+
+// Name cmd name
+func (cmd *ConfigCmd) Name() string {
+	return "config"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ConfigCmd) Synopsis() string {
+	return "config tools(export/import/freeze/unused)"
+}
+
+// Usage cmd usage
+func (cmd *ConfigCmd) Usage() string {
+	return "config export|import|freeze|freezes|unfreeze|unused [OPTIONS] ...\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ConfigCmd) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute cmd execute
+func (cmd *ConfigCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, "config")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&ConfigExportCmd{}, "")
+	cdr.Register(&ConfigImportCmd{}, "")
+	cdr.Register(&ConfigFreezeCmd{}, "")
+	cdr.Register(&ConfigListFreezeCmd{}, "")
+	cdr.Register(&ConfigUnfreezeCmd{}, "")
+	cdr.Register(&ConfigUnusedCmd{}, "")
+	return cdr.Execute(ctx, v...)
+}
+
+// ConfigExportCmd config export cmd
+type ConfigExportCmd struct {
+	env    string
+	prefix string
+}
+
+// Name cmd name
+func (cmd *ConfigExportCmd) Name() string {
+	return "export"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ConfigExportCmd) Synopsis() string {
+	return "export configs to directory"
+}
+
+// Usage cmd usage
+func (cmd *ConfigExportCmd) Usage() string {
+	return "export [OPTIONS] dir\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ConfigExportCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.env, "env", "", "env layer, base layer if empty")
+	f.StringVar(&cmd.prefix, "prefix", "", "config name prefix")
+}
+
+// Execute cmd execute
+func (cmd *ConfigExportCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	root := f.Arg(0)
+
+	x := NewXBus()
+	ctrl := x.NewConfigCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	cfgs, err := ctrl.ListLayer(ctx, cmd.env, cmd.prefix)
+	if err != nil {
+		glog.Errorf("list configs fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	names := make(map[string]bool)
+	for _, cfg := range cfgs {
+		names[cfg.Name] = true
+	}
+	for _, cfg := range cfgs {
+		path := configPath(root, cfg.Name, names)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			glog.Errorf("create dir of %s fail: %v", path, err)
+			return subcommands.ExitFailure
+		}
+		if err := ioutil.WriteFile(path, []byte(cfg.Value), 0644); err != nil {
+			glog.Errorf("write config(%s) fail: %v", cfg.Name, err)
+			return subcommands.ExitFailure
+		}
+	}
+	fmt.Printf("exported %d configs\n", len(cfgs))
+	return subcommands.ExitSuccess
+}
+
+// ConfigImportCmd config import cmd
+type ConfigImportCmd struct {
+	env      string
+	prefix   string
+	tag      string
+	format   string
+	remark   string
+	dryRun   bool
+	prune    bool
+	override bool
+}
+
+// Name cmd name
+func (cmd *ConfigImportCmd) Name() string {
+	return "import"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ConfigImportCmd) Synopsis() string {
+	return "import configs from directory"
+}
+
+// Usage cmd usage
+func (cmd *ConfigImportCmd) Usage() string {
+	return "import [OPTIONS] dir\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ConfigImportCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.env, "env", "", "env layer, base layer if empty")
+	f.StringVar(&cmd.prefix, "prefix", "", "only import configs with name prefix")
+	f.StringVar(&cmd.tag, "tag", "", "config tag")
+	f.StringVar(&cmd.format, "format", "", "config format(json/yaml/properties/toml), keep unchanged if empty")
+	f.StringVar(&cmd.remark, "remark", "", "change remark")
+	f.BoolVar(&cmd.dryRun, "dry-run", false, "show diff only")
+	f.BoolVar(&cmd.prune, "prune", false, "delete configs missing in dir")
+	f.BoolVar(&cmd.override, "override", false, "override freeze windows")
+}
+
+// Execute cmd execute
+func (cmd *ConfigImportCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	values, err := readConfigDir(f.Arg(0))
+	if err != nil {
+		glog.Errorf("read config dir fail: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	x := NewXBus()
+	ctrl := x.NewConfigCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	cfgs, err := ctrl.ListLayer(ctx, cmd.env, cmd.prefix)
+	if err != nil {
+		glog.Errorf("list configs fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	current := make(map[string]*configs.ConfigItem)
+	for _, cfg := range cfgs {
+		current[cfg.Name] = cfg
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if strings.HasPrefix(name, cmd.prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var puts, deletes []string
+	for _, name := range names {
+		if cfg := current[name]; cfg == nil {
+			fmt.Printf("+ %s\n", name)
+			printDiff("", values[name])
+		} else if cfg.Value != values[name] {
+			fmt.Printf("~ %s\n", name)
+			printDiff(cfg.Value, values[name])
+		} else {
+			continue
+		}
+		puts = append(puts, name)
+	}
+	if cmd.prune {
+		for _, cfg := range cfgs {
+			if _, ok := values[cfg.Name]; !ok {
+				fmt.Printf("- %s\n", cfg.Name)
+				deletes = append(deletes, cfg.Name)
+			}
+		}
+	}
+	// validate all before any change, so import is not stopped half-applied
+	invalid := false
+	for _, name := range puts {
+		if err := configs.CheckConfig(cmd.format, name, values[name]); err != nil {
+			glog.Errorf("invalid config(%s): %v", name, err)
+			invalid = true
+		}
+	}
+	if invalid {
+		return subcommands.ExitFailure
+	}
+	var protected int
+	for _, name := range append(append([]string{}, puts...), deletes...) {
+		if ctrl.IsProtected(name) {
+			fmt.Printf("! %s is protected, change needs approval\n", name)
+			protected++
+		}
+	}
+	if cmd.dryRun {
+		fmt.Printf("%d to put, %d to delete, %d need approval\n", len(puts), len(deletes), protected)
+		return subcommands.ExitSuccess
+	}
+
+	var putCount, deleteCount int
+	for _, name := range puts {
+		var version int64
+		if cfg := current[name]; cfg != nil {
+			version = cfg.Version
+		}
+		if ctrl.IsProtected(name) {
+			change := configs.ConfigChange{Op: configs.ChangeOpPut, Tag: cmd.tag, Format: cmd.format, Name: name,
+				Env: cmd.env, Value: values[name], Version: version, Remark: cmd.remark}
+			if err := ctrl.NewChange(ctx, &change); err != nil {
+				glog.Errorf("new config(%s) change fail: %v", name, err)
+				return subcommands.ExitFailure
+			}
+			continue
+		}
+		if _, err := ctrl.Put(ctx, cmd.tag, cmd.format, cmd.env, name, 0, cmd.remark, values[name], version, cmd.override); err != nil {
+			glog.Errorf("put config(%s) fail: %v", name, err)
+			return subcommands.ExitFailure
+		}
+		putCount++
+	}
+	for _, name := range deletes {
+		if ctrl.IsProtected(name) {
+			change := configs.ConfigChange{Op: configs.ChangeOpDelete, Name: name, Env: cmd.env,
+				Version: current[name].Version, Remark: cmd.remark}
+			if err := ctrl.NewChange(ctx, &change); err != nil {
+				glog.Errorf("new config(%s) change fail: %v", name, err)
+				return subcommands.ExitFailure
+			}
+			continue
+		}
+		if err := ctrl.Delete(ctx, cmd.env, name, 0, cmd.remark, cmd.override); err != nil {
+			glog.Errorf("delete config(%s) fail: %v", name, err)
+			return subcommands.ExitFailure
+		}
+		deleteCount++
+	}
+	fmt.Printf("%d put, %d deleted, %d pending approval\n", putCount, deleteCount, protected)
+	return subcommands.ExitSuccess
+}
+
+// configPath map config name to file path, dots as path separators;
+// if a parent name is also a config, the rest is kept in the file name
+func configPath(root, name string, names map[string]bool) string {
+	parts := strings.Split(name, ".")
+	for i := 1; i < len(parts); i++ {
+		if names[strings.Join(parts[:i], ".")] {
+			return filepath.Join(root, filepath.Join(parts[:i-1]...), strings.Join(parts[i-1:], "."))
+		}
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// readConfigDir read config values from dir, reverse of configPath
+func readConfigDir(root string) (map[string]string, error) {
+	values := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := strings.Join(strings.Split(filepath.ToSlash(rel), "/"), ".")
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("duplicate config name: %s(%s)", name, path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		values[name] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// printDiff print line diff of old and new value
+func printDiff(oldValue, newValue string) {
+	for _, line := range diffLines(splitLines(oldValue), splitLines(newValue)) {
+		fmt.Printf("    %s\n", line)
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines line diff based on longest common subsequence
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	return lines
+}
+
+// ConfigFreezeCmd config freeze cmd
+type ConfigFreezeCmd struct {
+	start  string
+	end    string
+	reason string
+}
+
+// Name cmd name
+func (cmd *ConfigFreezeCmd) Name() string {
+	return "freeze"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ConfigFreezeCmd) Synopsis() string {
+	return "add config freeze window"
+}
+
+// Usage cmd usage
+func (cmd *ConfigFreezeCmd) Usage() string {
+	return "freeze [OPTIONS] prefix\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ConfigFreezeCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.start, "start", "", "start time(2006-01-02 15:04), now if empty")
+	f.StringVar(&cmd.end, "end", "", "end time(2006-01-02 15:04)")
+	f.StringVar(&cmd.reason, "reason", "", "freeze reason")
+}
+
+const freezeTimeLayout = "2006-01-02 15:04"
+
+// Execute cmd execute
+func (cmd *ConfigFreezeCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 || cmd.end == "" {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	freeze := configs.ConfigFreeze{Prefix: f.Arg(0), Reason: cmd.reason, StartTime: time.Now()}
+	var err error
+	if cmd.start != "" {
+		if freeze.StartTime, err = time.ParseInLocation(freezeTimeLayout, cmd.start, time.Local); err != nil {
+			glog.Errorf("invalid start time: %v", err)
+			return subcommands.ExitUsageError
+		}
+	}
+	if freeze.EndTime, err = time.ParseInLocation(freezeTimeLayout, cmd.end, time.Local); err != nil {
+		glog.Errorf("invalid end time: %v", err)
+		return subcommands.ExitUsageError
+	}
+
+	x := NewXBus()
+	ctrl := x.NewConfigCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	if err := ctrl.AddFreeze(&freeze); err != nil {
+		glog.Errorf("add freeze fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	fmt.Printf("freeze %d added\n", freeze.ID)
+	return subcommands.ExitSuccess
+}
+
+// ConfigListFreezeCmd config list freeze cmd
+type ConfigListFreezeCmd struct {
+}
+
+// Name cmd name
+func (cmd *ConfigListFreezeCmd) Name() string {
+	return "freezes"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ConfigListFreezeCmd) Synopsis() string {
+	return "list current and upcoming config freeze windows"
+}
+
+// Usage cmd usage
+func (cmd *ConfigListFreezeCmd) Usage() string {
+	return "freezes\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ConfigListFreezeCmd) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute cmd execute
+func (cmd *ConfigListFreezeCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	x := NewXBus()
+	ctrl := x.NewConfigCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	freezes, err := ctrl.ListFreezes()
+	if err != nil {
+		glog.Errorf("list freezes fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "id\tprefix\tstart_time\tend_time\treason\n")
+	for _, freeze := range freezes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", freeze.ID, freeze.Prefix,
+			freeze.StartTime.Format(freezeTimeLayout), freeze.EndTime.Format(freezeTimeLayout), freeze.Reason)
+	}
+	w.Flush()
+	return subcommands.ExitSuccess
+}
+
+// ConfigUnfreezeCmd config unfreeze cmd
+type ConfigUnfreezeCmd struct {
+}
+
+// Name cmd name
+func (cmd *ConfigUnfreezeCmd) Name() string {
+	return "unfreeze"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ConfigUnfreezeCmd) Synopsis() string {
+	return "delete config freeze window"
+}
+
+// Usage cmd usage
+func (cmd *ConfigUnfreezeCmd) Usage() string {
+	return "unfreeze id\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ConfigUnfreezeCmd) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute cmd execute
+func (cmd *ConfigUnfreezeCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	id, err := strconv.ParseInt(f.Arg(0), 10, 64)
+	if err != nil {
+		glog.Errorf("invalid freeze id: %s", f.Arg(0))
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	ctrl := x.NewConfigCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	if err := ctrl.DeleteFreeze(id); err != nil {
+		glog.Errorf("delete freeze fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// ConfigUnusedCmd config unused cmd
+type ConfigUnusedCmd struct {
+	typ     string
+	days    int
+	prefix  string
+	archive bool
+	remark  string
+}
+
+// Name cmd name
+func (cmd *ConfigUnusedCmd) Name() string {
+	return "unused"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ConfigUnusedCmd) Synopsis() string {
+	return "report(and archive) unused configs"
+}
+
+// Usage cmd usage
+func (cmd *ConfigUnusedCmd) Usage() string {
+	return "unused [OPTIONS]\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ConfigUnusedCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.typ, "type", configs.UnusedUnread, "unread: no reads in days, orphaned: read only by removed apps")
+	f.IntVar(&cmd.days, "days", 90, "days without reads")
+	f.StringVar(&cmd.prefix, "prefix", "", "config name prefix")
+	f.BoolVar(&cmd.archive, "archive", false, "archive(soft delete) reported configs")
+	f.StringVar(&cmd.remark, "remark", "archive unused config", "archive remark")
+}
+
+// Execute cmd execute
+func (cmd *ConfigUnusedCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	x := NewXBus()
+	ctrl := x.NewConfigCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "name\tenv\tmodify_time\tlast_read_time\n")
+	const pageSize = 500
+	var total, archived int
+	for skip := 0; ; {
+		items, err := ctrl.ListUnused(cmd.typ, cmd.days, cmd.prefix, skip, pageSize)
+		if err != nil {
+			glog.Errorf("list unused configs fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		for _, item := range items {
+			lastRead := "-"
+			if item.LastReadTime != nil {
+				lastRead = item.LastReadTime.Format(freezeTimeLayout)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Name, item.Env, item.ModifyTime.Format(freezeTimeLayout), lastRead)
+			if cmd.archive {
+				if err := ctrl.Archive(ctx, cmd.typ, cmd.days, item.Env, item.Name, 0, cmd.remark); err != nil {
+					glog.Errorf("archive config(%s@%s) fail: %v", item.Name, item.Env, err)
+					return subcommands.ExitFailure
+				}
+				archived++
+			}
+		}
+		total += len(items)
+		if len(items) < pageSize {
+			break
+		}
+		if !cmd.archive {
+			// archived configs leave the list, otherwise move to next page
+			skip += len(items)
+		}
+	}
+	w.Flush()
+	fmt.Printf("%d unused configs, %d archived\n", total, archived)
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigPathRoundTrip(t *testing.T) {
+	values := map[string]string{
+		"a":        "1",
+		"a.b":      "2",
+		"a.b.c":    "3",
+		"db.host":  "localhost",
+		"db.port":  "3306",
+		"x.y.z.pb": "4",
+	}
+	names := make(map[string]bool)
+	for name := range values {
+		names[name] = true
+	}
+
+	root, err := ioutil.TempDir("", "xbus-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, value := range values {
+		path := configPath(root, name, names)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read, err := readConfigDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, values) {
+		t.Errorf("round trip mismatch: %v", read)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	lines := diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	expected := []string{" a", "-b", "+x", " c", "+d"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("unexpected diff: %v", lines)
+	}
+}
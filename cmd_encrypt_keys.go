@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+	"github.com/infrmods/xbus/apps"
+)
+
+// EncryptKeysCmd encrypt keys cmd
+type EncryptKeysCmd struct {
+	OldMasterKeyFile string
+}
+
+// Name cmd name
+func (cmd *EncryptKeysCmd) Name() string {
+	return "encrypt-keys"
+}
+
+// Synopsis cmd synopsis
+func (cmd *EncryptKeysCmd) Synopsis() string {
+	return "encrypt(or rotate master key of) apps' private keys in db"
+}
+
+// Usage cmd usage
+func (cmd *EncryptKeysCmd) Usage() string {
+	return "encrypt-keys [OPTIONS]\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *EncryptKeysCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.OldMasterKeyFile, "old-master-key-file", "", "file contains the old master key, for rotation")
+}
+
+// Execute cmd execute
+func (cmd *EncryptKeysCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	var oldCipher *apps.KeyCipher
+	if cmd.OldMasterKeyFile != "" {
+		var err error
+		if oldCipher, err = apps.LoadKeyCipher("", cmd.OldMasterKeyFile); err != nil {
+			glog.Errorf("load old master key fail: %v", err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	count, err := appCtrl.EncryptPrivateKeys(oldCipher)
+	fmt.Printf("%d private keys encrypted\n", count)
+	if err != nil {
+		glog.Errorf("encrypt private keys fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+)
+
+// ExpiringCertsCmd expiring certs cmd
+type ExpiringCertsCmd struct {
+	Days int
+}
+
+// Name cmd name
+func (cmd *ExpiringCertsCmd) Name() string {
+	return "expiring-certs"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ExpiringCertsCmd) Synopsis() string {
+	return "list ca & app certs expiring within days"
+}
+
+// Usage cmd usage
+func (cmd *ExpiringCertsCmd) Usage() string {
+	return "expiring-certs [OPTIONS]\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ExpiringCertsCmd) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&cmd.Days, "days", 30, "expiring within days")
+}
+
+// Execute cmd execute
+func (cmd *ExpiringCertsCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	certs, err := appCtrl.ListExpiringCerts(cmd.Days)
+	if err != nil {
+		glog.Errorf("list expiring certs fail: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "app\tsubject\tserial_no\tnot_after\tdays_left\n")
+	for _, cert := range certs {
+		app := cert.App
+		if app == "" {
+			app = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.1f\n", app, cert.Subject, cert.SerialNo,
+			cert.NotAfter.Format(time.RFC3339), cert.DaysLeft)
+	}
+	w.Flush()
+	return subcommands.ExitSuccess
+}
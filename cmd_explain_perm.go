@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+)
+
+// ExplainPermCmd explain perm cmd
+type ExplainPermCmd struct {
+	permTypeFlags
+	canWrite bool
+}
+
+// Name cmd name
+func (cmd *ExplainPermCmd) Name() string {
+	return "explain-perm"
+}
+
+// Synopsis cmd synopsis
+func (cmd *ExplainPermCmd) Synopsis() string {
+	return "explain perm decision of app on name"
+}
+
+// Usage cmd usage
+func (cmd *ExplainPermCmd) Usage() string {
+	return "explain-perm [OPTIONS] app(public for anonymous) name\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *ExplainPermCmd) SetFlags(f *flag.FlagSet) {
+	cmd.permTypeFlags.setFlags(f)
+	f.BoolVar(&cmd.canWrite, "write", false, "need write")
+}
+
+// Execute cmd execute
+func (cmd *ExplainPermCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	args := f.Args()
+	if len(args) != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	explanation, err := appCtrl.ExplainPerm(args[0], cmd.permType(), cmd.canWrite, args[1])
+	if err != nil {
+		fmt.Println(err)
+		return subcommands.ExitFailure
+	}
+
+	decision := "denied"
+	if explanation.Allowed {
+		decision = "allowed"
+	}
+	fmt.Printf("%s: %s\n", decision, explanation.Reason)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  \tsource\ttarget\tid\twrite\tdeny\tcontent\tmatched\n")
+	for _, rule := range explanation.Rules {
+		mark := ""
+		if rule.Decisive {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%v\t%v\t%s\t%v\n", mark, rule.Source, rule.Target,
+			rule.PermID, rule.CanWrite, rule.Deny, rule.Content, rule.Matched)
+	}
+	w.Flush()
+	return subcommands.ExitSuccess
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"flag"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -24,6 +26,9 @@ type GenRootCmd struct {
 
 	CertFile string
 	KeyFile  string
+
+	CACert string
+	CAKey  string
 }
 
 // Name cmd name
@@ -33,7 +38,7 @@ func (cmd *GenRootCmd) Name() string {
 
 // Synopsis cmd synopsis
 func (cmd *GenRootCmd) Synopsis() string {
-	return "generate root cert/key"
+	return "generate root(or intermediate) cert/key"
 }
 
 // Usage cmd usage
@@ -50,6 +55,8 @@ func (cmd *GenRootCmd) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&cmd.Days, "days", 10*365, "cert valid for days")
 	f.StringVar(&cmd.CertFile, "cert-out", "rootcert.pem", "cert output file")
 	f.StringVar(&cmd.KeyFile, "key-out", "rootkey.pem", "key output file")
+	f.StringVar(&cmd.CACert, "ca-cert", "", "generate intermediate signed by this ca cert")
+	f.StringVar(&cmd.CAKey, "ca-key", "", "key of ca cert")
 }
 
 // Execute cmd execute
@@ -78,8 +85,29 @@ func (cmd *GenRootCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interfac
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 	}
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template,
-		privKey.Public(), privKey)
+	parent, parentKey := &template, privKey
+	if cmd.CACert != "" {
+		if parent, parentKey, err = cmd.loadCA(); err != nil {
+			glog.Errorf("load ca fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		cnSet := false
+		f.Visit(func(fl *flag.Flag) { cnSet = cnSet || fl.Name == "cn" })
+		if !cnSet {
+			template.Subject.CommonName = "XBus Intermediate CA"
+		}
+		// intermediates only sign app certs
+		template.MaxPathLenZero = true
+		if template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+			glog.Errorf("generate serial fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		if template.NotAfter.After(parent.NotAfter) {
+			template.NotAfter = parent.NotAfter
+		}
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, parent,
+		privKey.Public(), parentKey)
 	if err != nil {
 		glog.Errorf("create cert fail: %v", err)
 		return subcommands.ExitFailure
@@ -97,3 +125,25 @@ func (cmd *GenRootCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interfac
 
 	return subcommands.ExitSuccess
 }
+
+func (cmd *GenRootCmd) loadCA() (*x509.Certificate, crypto.Signer, error) {
+	if cmd.CAKey == "" {
+		return nil, nil, fmt.Errorf("missing ca key")
+	}
+	cert, err := utils.ReadPEMCertificate(cmd.CACert)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cert.IsCA {
+		return nil, nil, fmt.Errorf("not a ca cert: %s", cmd.CACert)
+	}
+	block, err := utils.ReadPEM(cmd.CAKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := utils.ParsePrivateKey(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
@@ -10,14 +10,78 @@ import (
 	"github.com/infrmods/xbus/apps"
 )
 
+// permOperator operator of perm changes by cli
+const permOperator = "cli"
+
+// permTypeFlags perm type flags
+type permTypeFlags struct {
+	isConfigs   bool
+	isServices  bool
+	isApps      bool
+	isApproval  bool
+	isAdmin     bool
+	isPermAdmin bool
+}
+
+func (flags *permTypeFlags) setFlags(f *flag.FlagSet) {
+	f.BoolVar(&flags.isConfigs, "configs", false, "config perms")
+	f.BoolVar(&flags.isServices, "services", false, "services perms")
+	f.BoolVar(&flags.isApps, "apps", false, "app perms")
+	f.BoolVar(&flags.isApproval, "config-approvals", false, "config approval perms")
+	f.BoolVar(&flags.isAdmin, "admin", false, "admin perms")
+	f.BoolVar(&flags.isPermAdmin, "perm-admin", false, "perm admin perms")
+}
+
+// permType perm type of flags, config perms by default
+func (flags *permTypeFlags) permType() int {
+	if flags.isApps {
+		return apps.PermTypeApp
+	} else if flags.isApproval {
+		return apps.PermTypeConfigApproval
+	} else if flags.isAdmin {
+		return apps.PermTypeAdmin
+	} else if flags.isPermAdmin {
+		return apps.PermTypePermAdmin
+	} else if flags.isServices {
+		return apps.PermTypeService
+	}
+	return apps.PermTypeConfig
+}
+
+// permFlags perm flags shared by grant & revoke
+type permFlags struct {
+	permTypeFlags
+	isApp   bool
+	isGroup bool
+}
+
+func (flags *permFlags) setFlags(f *flag.FlagSet) {
+	flags.permTypeFlags.setFlags(f)
+	f.BoolVar(&flags.isApp, "app", false, "target is app")
+	f.BoolVar(&flags.isGroup, "group", false, "target is group")
+}
+
+// perm perm of flags with target & content args
+func (flags *permFlags) perm(appCtrl *apps.AppCtrl, target, content string) (*apps.Perm, error) {
+	perm := apps.Perm{PermType: flags.permType(), Content: content}
+	if flags.isGroup {
+		perm.TargetType = apps.PermTargetGroup
+	} else {
+		perm.TargetType = apps.PermTargetApp
+	}
+	targetID, err := appCtrl.PermTarget(perm.TargetType, target)
+	if err != nil {
+		return nil, err
+	}
+	perm.TargetID = targetID
+	return &perm, nil
+}
+
 // GrantCmd grant cmd
 type GrantCmd struct {
-	isConfigs  bool
-	isServices bool
-	isApps     bool
-	isApp      bool
-	isGroup    bool
-	canWrite   bool
+	permFlags
+	canWrite bool
+	deny     bool
 }
 
 // Name cmd name
@@ -32,72 +96,92 @@ func (cmd *GrantCmd) Synopsis() string {
 
 // Usage cmd usage
 func (cmd *GrantCmd) Usage() string {
-	return "grant [OPTIONS] target content\n"
+	return "grant [OPTIONS] target content\n  content: prefix, or glob pattern(* matches any chars except '.', ** matches any chars)\n"
 }
 
 // SetFlags cmd set flags
 func (cmd *GrantCmd) SetFlags(f *flag.FlagSet) {
-	f.BoolVar(&cmd.isConfigs, "configs", false, "list config perms")
-	f.BoolVar(&cmd.isServices, "services", false, "list services perms")
-	f.BoolVar(&cmd.isApps, "apps", false, "list app perms")
-	f.BoolVar(&cmd.isApp, "app", false, "target is app")
-	f.BoolVar(&cmd.isGroup, "group", false, "target is group")
+	cmd.setFlags(f)
 	f.BoolVar(&cmd.canWrite, "write", false, "need write")
+	f.BoolVar(&cmd.deny, "deny", false, "deny perm(with -write denies writing only)")
 }
 
 // Execute cmd execute
 func (cmd *GrantCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
-	x := NewXBus()
-	db := x.NewDB()
 	args := f.Args()
 	if len(args) != 2 {
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
 
-	perm := apps.Perm{}
-	if cmd.isApps {
-		perm.PermType = apps.PermTypeApp
-	} else if cmd.isServices {
-		perm.PermType = apps.PermTypeService
-	} else {
-		perm.PermType = apps.PermTypeConfig
-	}
-	if cmd.isGroup {
-		perm.TargetType = apps.PermTargetGroup
-		if group, err := apps.GetGroupByName(db, args[0]); err == nil {
-			if group == nil {
-				fmt.Printf("no such group: %s\n", args[0])
-				return subcommands.ExitFailure
-			}
-			perm.TargetID = group.ID
-		} else {
-			glog.Errorf("get group(%v) fail: %v", args[0], err)
-			return subcommands.ExitFailure
-		}
-	} else {
-		perm.TargetType = apps.PermTargetApp
-		if args[0] == "public" {
-			perm.TargetID = apps.PermPublicTargetID
-		} else {
-			if app, err := apps.GetAppByName(db, args[0]); err == nil {
-				if app == nil {
-					fmt.Printf("no such app: %s\n", args[0])
-					return subcommands.ExitFailure
-				}
-				perm.TargetID = app.ID
-			} else {
-				glog.Errorf("get app(%v), fail: %v", args[0], err)
-				return subcommands.ExitFailure
-			}
-		}
+	perm, err := cmd.perm(appCtrl, args[0], args[1])
+	if err != nil {
+		fmt.Println(err)
+		return subcommands.ExitFailure
 	}
 	perm.CanWrite = cmd.canWrite
-	perm.Content = args[1]
-
-	if err := apps.InsertPerm(db, &perm); err != nil {
+	perm.Deny = cmd.deny
+	if err := appCtrl.GrantPerm(perm, permOperator); err != nil {
 		glog.Errorf("new perm fail: %v", err)
 		return subcommands.ExitFailure
 	}
 	return subcommands.ExitSuccess
 }
+
+// RevokeCmd revoke cmd
+type RevokeCmd struct {
+	permFlags
+}
+
+// Name cmd name
+func (cmd *RevokeCmd) Name() string {
+	return "revoke"
+}
+
+// Synopsis cmd synopsis
+func (cmd *RevokeCmd) Synopsis() string {
+	return "revoke permission"
+}
+
+// Usage cmd usage
+func (cmd *RevokeCmd) Usage() string {
+	return "revoke [OPTIONS] target content\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *RevokeCmd) SetFlags(f *flag.FlagSet) {
+	cmd.setFlags(f)
+}
+
+// Execute cmd execute
+func (cmd *RevokeCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	args := f.Args()
+	if len(args) != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+
+	key, err := cmd.perm(appCtrl, args[0], args[1])
+	if err != nil {
+		fmt.Println(err)
+		return subcommands.ExitFailure
+	}
+	perm, err := appCtrl.GetPermByKey(key.PermType, key.TargetType, key.TargetID, key.Content)
+	if err != nil {
+		glog.Errorf("get perm fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	if perm == nil {
+		fmt.Printf("no such perm: %s %s\n", args[0], args[1])
+		return subcommands.ExitFailure
+	}
+	if err := appCtrl.RevokePerm(perm, permOperator); err != nil {
+		glog.Errorf("revoke perm fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
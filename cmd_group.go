@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/utils"
+)
+
+// GroupCmd group cmd
+type GroupCmd struct {
+}
+
+// Name cmd name
+func (cmd *GroupCmd) Name() string {
+	return "group"
+}
+
+// Synopsis cmd synopsis
+func (cmd *GroupCmd) Synopsis() string {
+	return "group tools(new/info/delete/add-member/remove-member)"
+}
+
+// Usage cmd usage
+func (cmd *GroupCmd) Usage() string {
+	return "group new|info|delete|add-member|remove-member [OPTIONS] ...\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *GroupCmd) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute cmd execute
+func (cmd *GroupCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	cdr := subcommands.NewCommander(f, "group")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(&GroupNewCmd{}, "")
+	cdr.Register(&GroupInfoCmd{}, "")
+	cdr.Register(&GroupDeleteCmd{}, "")
+	cdr.Register(&GroupMemberCmd{add: true}, "")
+	cdr.Register(&GroupMemberCmd{}, "")
+	return cdr.Execute(ctx, v...)
+}
+
+// getGroup get group by name, nil if failed
+func getGroup(appCtrl *apps.AppCtrl, name string) *apps.Group {
+	group, err := appCtrl.GetGroupByName(name)
+	if err != nil {
+		glog.Errorf("get group fail: %v", err)
+		return nil
+	}
+	if group == nil {
+		glog.Errorf("no such group: %s", name)
+	}
+	return group
+}
+
+// GroupNewCmd group new cmd
+type GroupNewCmd struct {
+	description string
+}
+
+// Name cmd name
+func (cmd *GroupNewCmd) Name() string {
+	return "new"
+}
+
+// Synopsis cmd synopsis
+func (cmd *GroupNewCmd) Synopsis() string {
+	return "create group"
+}
+
+// Usage cmd usage
+func (cmd *GroupNewCmd) Usage() string {
+	return "new [OPTIONS] name\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *GroupNewCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.description, "description", "", "description")
+}
+
+// Execute cmd execute
+func (cmd *GroupNewCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	group := apps.Group{Status: utils.StatusOk, Name: f.Arg(0), Description: cmd.description}
+	if err := appCtrl.NewGroup(&group); err != nil {
+		glog.Errorf("create group fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// GroupInfoCmd group info cmd
+type GroupInfoCmd struct {
+}
+
+// Name cmd name
+func (cmd *GroupInfoCmd) Name() string {
+	return "info"
+}
+
+// Synopsis cmd synopsis
+func (cmd *GroupInfoCmd) Synopsis() string {
+	return "describe group with members & perms"
+}
+
+// Usage cmd usage
+func (cmd *GroupInfoCmd) Usage() string {
+	return "info name\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *GroupInfoCmd) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute cmd execute
+func (cmd *GroupInfoCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	group := getGroup(appCtrl, f.Arg(0))
+	if group == nil {
+		return subcommands.ExitFailure
+	}
+	members, err := appCtrl.GetGroupMembers(group.ID)
+	if err != nil {
+		glog.Errorf("get members fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	perms, err := appCtrl.GetGroupPerms(group.ID)
+	if err != nil {
+		glog.Errorf("get perms fail: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Printf("name: %s\ndescription: %s\ncreate time: %s\n\nmembers:\n",
+		group.Name, group.Description, group.CreateTime.Format(timeFmt))
+	for _, app := range members {
+		fmt.Printf("  %s\n", app.Name)
+	}
+	fmt.Printf("\nperms:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  id\ttype\twrite\tdeny\tcontent\n")
+	for _, perm := range perms {
+		fmt.Fprintf(w, "  %d\t%d\t%v\t%v\t%s\n", perm.ID, perm.PermType, perm.CanWrite, perm.Deny, perm.Content)
+	}
+	w.Flush()
+	return subcommands.ExitSuccess
+}
+
+// GroupDeleteCmd group delete cmd
+type GroupDeleteCmd struct {
+}
+
+// Name cmd name
+func (cmd *GroupDeleteCmd) Name() string {
+	return "delete"
+}
+
+// Synopsis cmd synopsis
+func (cmd *GroupDeleteCmd) Synopsis() string {
+	return "delete group with its members & perms"
+}
+
+// Usage cmd usage
+func (cmd *GroupDeleteCmd) Usage() string {
+	return "delete name\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *GroupDeleteCmd) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute cmd execute
+func (cmd *GroupDeleteCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	group := getGroup(appCtrl, f.Arg(0))
+	if group == nil {
+		return subcommands.ExitFailure
+	}
+	if err := appCtrl.DeleteGroup(group, permOperator); err != nil {
+		glog.Errorf("delete group fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// GroupMemberCmd group add/remove member cmd
+type GroupMemberCmd struct {
+	add bool
+}
+
+// Name cmd name
+func (cmd *GroupMemberCmd) Name() string {
+	if cmd.add {
+		return "add-member"
+	}
+	return "remove-member"
+}
+
+// Synopsis cmd synopsis
+func (cmd *GroupMemberCmd) Synopsis() string {
+	if cmd.add {
+		return "add apps to group"
+	}
+	return "remove apps from group"
+}
+
+// Usage cmd usage
+func (cmd *GroupMemberCmd) Usage() string {
+	return cmd.Name() + " group app...\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *GroupMemberCmd) SetFlags(f *flag.FlagSet) {
+}
+
+// Execute cmd execute
+func (cmd *GroupMemberCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() < 2 {
+		fmt.Print(cmd.Usage())
+		return subcommands.ExitUsageError
+	}
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	group := getGroup(appCtrl, f.Arg(0))
+	if group == nil {
+		return subcommands.ExitFailure
+	}
+	status := subcommands.ExitSuccess
+	for _, name := range f.Args()[1:] {
+		app, err := appCtrl.GetAppByName(name)
+		if err != nil {
+			glog.Errorf("get app(%s) fail: %v", name, err)
+			return subcommands.ExitFailure
+		}
+		if app == nil {
+			glog.Errorf("no such app: %s", name)
+			status = subcommands.ExitFailure
+			continue
+		}
+		if cmd.add {
+			err = appCtrl.AddGroupMember(group.ID, app.ID)
+		} else {
+			err = appCtrl.RemoveGroupMember(group.ID, app.ID)
+		}
+		if err != nil {
+			glog.Errorf("%s %s fail: %v", cmd.Name(), name, err)
+			status = subcommands.ExitFailure
+		}
+	}
+	return status
+}
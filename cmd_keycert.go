@@ -12,6 +12,8 @@ import (
 
 // KeyCertCmd key cert cmd
 type KeyCertCmd struct {
+	Format   string
+	Password string
 }
 
 // Name cmd name
@@ -31,8 +33,12 @@ func (cmd *KeyCertCmd) Usage() string {
 
 // SetFlags cmd set flags
 func (cmd *KeyCertCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.Format, "format", "pem", "output format: pem, pkcs12 or jks")
+	f.StringVar(&cmd.Password, "password", "", "keystore password(pkcs12/jks)")
 }
 
+var keyStoreExts = map[string]string{apps.KeyStorePKCS12: ".p12", apps.KeyStoreJKS: ".jks"}
+
 // Execute cmd execute
 func (cmd *KeyCertCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
 	x := NewXBus()
@@ -44,11 +50,45 @@ func (cmd *KeyCertCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interfac
 		glog.Errorf("get app fail: %v", err)
 		return subcommands.ExitFailure
 	}
+	if app == nil {
+		glog.Errorf("no such app: %s", appName)
+		return subcommands.ExitFailure
+	}
+	if cmd.Format != "pem" {
+		ext, ok := keyStoreExts[cmd.Format]
+		if !ok {
+			glog.Errorf("invalid format: %s", cmd.Format)
+			return subcommands.ExitUsageError
+		}
+		if cmd.Password == "" {
+			glog.Errorf("password is required for %s", cmd.Format)
+			return subcommands.ExitUsageError
+		}
+		data, err := x.NewAppCtrl(db, x.Config.Etcd.NewEtcdClient()).KeyStore(app, cmd.Format, cmd.Password)
+		if err != nil {
+			glog.Errorf("generate keystore fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		if err := utils.WriteFile(appName+ext, 0600, data); err != nil {
+			glog.Errorf("write keystore fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
 	if err := utils.WriteFile(appName+"cert.pem", 0644, []byte(app.Cert)); err != nil {
 		glog.Errorf("write cert fail: %v", err)
 		return subcommands.ExitFailure
 	}
-	if err := utils.WriteFile(appName+"key.pem", 0600, []byte(app.PrivateKey)); err != nil {
+	if app.PrivateKey == "" {
+		glog.Warningf("app(%s) has no server-held private key, only cert is written", appName)
+		return subcommands.ExitSuccess
+	}
+	keyPem, err := x.NewAppCtrl(db, x.Config.Etcd.NewEtcdClient()).PrivateKey(app)
+	if err != nil {
+		glog.Errorf("decrypt key fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	if err := utils.WriteFile(appName+"key.pem", 0600, []byte(keyPem)); err != nil {
 		glog.Errorf("write key fail: %v", err)
 		return subcommands.ExitFailure
 	}
@@ -17,6 +17,9 @@ type ListPermCmd struct {
 	isConfigs  bool
 	isServices bool
 	isApps     bool
+	isApproval bool
+	isAdmin    bool
+	isPerm     bool
 	appName    string
 	groupName  string
 	canWrite   bool
@@ -43,6 +46,9 @@ func (cmd *ListPermCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&cmd.isConfigs, "configs", false, "list config perms")
 	f.BoolVar(&cmd.isServices, "services", false, "list services perms")
 	f.BoolVar(&cmd.isApps, "apps", false, "list app perms")
+	f.BoolVar(&cmd.isApproval, "config-approvals", false, "list config approval perms")
+	f.BoolVar(&cmd.isAdmin, "admin", false, "list admin perms")
+	f.BoolVar(&cmd.isPerm, "perm-admin", false, "list perm admin perms")
 	f.StringVar(&cmd.appName, "app", "", "app name")
 	f.StringVar(&cmd.groupName, "group", "", "group name")
 	f.BoolVar(&cmd.canWrite, "write", false, "need write")
@@ -85,6 +91,12 @@ func (cmd *ListPermCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interfa
 		typ = apps.PermTypeService
 	} else if cmd.isApps {
 		typ = apps.PermTypeApp
+	} else if cmd.isApproval {
+		typ = apps.PermTypeConfigApproval
+	} else if cmd.isAdmin {
+		typ = apps.PermTypeAdmin
+	} else if cmd.isPerm {
+		typ = apps.PermTypePermAdmin
 	} else {
 		typ = apps.PermTypeConfig
 	}
@@ -103,7 +115,7 @@ func (cmd *ListPermCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interfa
 	})
 	if perms, err := appCtrl.GetPerms(typ, appName, groupName, canWrite, prefix); err == nil {
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintf(w, "id\ttype\ttarget_type\ttarget\twrite\tcontent\tcreate_time\n")
+		fmt.Fprintf(w, "id\ttype\ttarget_type\ttarget\twrite\tdeny\tcontent\tcreate_time\n")
 		for _, perm := range perms {
 			typeName := "unknown"
 			targetTypeName := "unknown"
@@ -115,6 +127,12 @@ func (cmd *ListPermCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interfa
 				typeName = "service"
 			case apps.PermTypeApp:
 				typeName = "app"
+			case apps.PermTypeConfigApproval:
+				typeName = "config-approval"
+			case apps.PermTypeAdmin:
+				typeName = "admin"
+			case apps.PermTypePermAdmin:
+				typeName = "perm-admin"
 			}
 			switch perm.TargetType {
 			case apps.PermTargetApp:
@@ -139,9 +157,9 @@ func (cmd *ListPermCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interfa
 					target = fmt.Sprintf("%s[%d]", group.Name, group.ID)
 				}
 			}
-			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
 				perm.ID, typeName, targetTypeName, target,
-				perm.CanWrite, perm.Content, perm.CreateTime.Format(timeFmt))
+				perm.CanWrite, perm.Deny, perm.Content, perm.CreateTime.Format(timeFmt))
 		}
 		w.Flush()
 	} else {
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"io/ioutil"
 	"net"
 	"strings"
 
@@ -15,11 +16,13 @@ import (
 // NewAppCmd new app cmd
 type NewAppCmd struct {
 	Description string
+	Env         string
 	DNSNames    string
 	IPAddresses string
 	RSABits     int
 	EcdsaCruve  string
 	Days        int
+	CSRFile     string
 
 	CertFile string
 	KeyFile  string
@@ -43,11 +46,13 @@ func (cmd *NewAppCmd) Usage() string {
 // SetFlags cmd set flags
 func (cmd *NewAppCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.Description, "desc", "", "app description")
+	f.StringVar(&cmd.Env, "env", "", "app's config env, empty for base configs")
 	f.StringVar(&cmd.DNSNames, "dns", "", "DNSNames, sparated by comma")
 	f.StringVar(&cmd.IPAddresses, "ip", "", "IPAddresses, sparated by comma")
 	f.IntVar(&cmd.RSABits, "rsa-bits", 2048, "RSA key size in bits")
 	f.StringVar(&cmd.EcdsaCruve, "ecdsa-curve", "", "ECDSA curve(P224/P256/P384/P521), empty if use RSA")
 	f.IntVar(&cmd.Days, "days", 365*8, "cert valid for N days")
+	f.StringVar(&cmd.CSRFile, "csr", "", "sign cert from csr(pem), private key is not generated nor stored; dns names & ips of csr are ignored")
 
 	f.StringVar(&cmd.CertFile, "cert-out", "", "cert output path, default: {name}cert.pem")
 	f.StringVar(&cmd.KeyFile, "key-out", "", "key output path, default: {name}key.pem")
@@ -66,6 +71,10 @@ func (cmd *NewAppCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface
 	if cmd.KeyFile == "" {
 		cmd.KeyFile = appName + "key.pem"
 	}
+	var dnsNames []string
+	if cmd.DNSNames != "" {
+		dnsNames = strings.Split(cmd.DNSNames, ",")
+	}
 	var ips []net.IP
 	if cmd.IPAddresses != "" {
 		ipStrs := strings.Split(cmd.IPAddresses, ",")
@@ -80,17 +89,38 @@ func (cmd *NewAppCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface
 		}
 	}
 
+	x := NewXBus()
+	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
+	app := apps.App{Status: utils.StatusOk, Name: appName,
+		Description: cmd.Description, Env: cmd.Env}
+	if cmd.CSRFile != "" {
+		data, err := ioutil.ReadFile(cmd.CSRFile)
+		if err != nil {
+			glog.Errorf("read csr fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		csr, err := utils.DecodeCSRFromPem(string(data))
+		if err != nil {
+			glog.Errorf("decode csr fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		if err := appCtrl.NewAppWithCSR(&app, csr, dnsNames, ips, cmd.Days); err != nil {
+			glog.Errorf("create app fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		if err := utils.WriteFile(cmd.CertFile, 0644, []byte(app.Cert)); err != nil {
+			glog.Errorf("write cert fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
+
 	privKey, err := utils.NewPrivateKey(cmd.EcdsaCruve, cmd.RSABits)
 	if err != nil {
 		glog.Errorf("generate private key fail: %v", err)
 		return subcommands.ExitFailure
 	}
-
-	x := NewXBus()
-	appCtrl := x.NewAppCtrl(x.NewDB(), x.Config.Etcd.NewEtcdClient())
-	app := apps.App{Status: utils.StatusOk, Name: appName,
-		Description: cmd.Description}
-	if _, err := appCtrl.NewApp(&app, privKey, strings.Split(cmd.DNSNames, ","), ips, cmd.Days); err != nil {
+	if _, err := appCtrl.NewApp(&app, privKey, dnsNames, ips, cmd.Days); err != nil {
 		glog.Errorf("create app fail: %v", err)
 		return subcommands.ExitFailure
 	}
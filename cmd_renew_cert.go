@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"flag"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+	"github.com/infrmods/xbus/apps"
+	"github.com/infrmods/xbus/utils"
+)
+
+// RenewCertCmd renew cert cmd
+type RenewCertCmd struct {
+	NewKey      bool
+	DNSNames    string
+	IPAddresses string
+	RSABits     int
+	EcdsaCruve  string
+	Days        int
+	CSRFile     string
+
+	CertFile string
+	KeyFile  string
+}
+
+// Name cmd name
+func (cmd *RenewCertCmd) Name() string {
+	return "renew-cert"
+}
+
+// Synopsis cmd synopsis
+func (cmd *RenewCertCmd) Synopsis() string {
+	return "renew app's cert"
+}
+
+// Usage cmd usage
+func (cmd *RenewCertCmd) Usage() string {
+	return "renew-cert [OPTIONS] name\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *RenewCertCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&cmd.NewKey, "new-key", false, "generate new key instead of reusing the current one")
+	f.StringVar(&cmd.DNSNames, "dns", "", "DNSNames, sparated by comma, default: same as the current cert")
+	f.StringVar(&cmd.IPAddresses, "ip", "", "IPAddresses, sparated by comma, default: same as the current cert")
+	f.IntVar(&cmd.RSABits, "rsa-bits", 2048, "RSA key size in bits")
+	f.StringVar(&cmd.EcdsaCruve, "ecdsa-curve", "", "ECDSA curve(P224/P256/P384/P521), empty if use RSA")
+	f.IntVar(&cmd.Days, "days", 365*8, "cert valid for N days")
+	f.StringVar(&cmd.CSRFile, "csr", "", "sign cert from csr(pem), server-held private key is dropped; dns names & ips of csr are ignored")
+
+	f.StringVar(&cmd.CertFile, "cert-out", "", "cert output path, default: {name}cert.pem")
+	f.StringVar(&cmd.KeyFile, "key-out", "", "key output path, default: {name}key.pem")
+}
+
+// Execute cmd execute
+func (cmd *RenewCertCmd) Execute(_ context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	appName := f.Arg(0)
+	if cmd.CertFile == "" {
+		cmd.CertFile = appName + "cert.pem"
+	}
+	if cmd.KeyFile == "" {
+		cmd.KeyFile = appName + "key.pem"
+	}
+	var dnsNames []string
+	if cmd.DNSNames != "" {
+		dnsNames = strings.Split(cmd.DNSNames, ",")
+	}
+	var ips []net.IP
+	if cmd.IPAddresses != "" {
+		ipStrs := strings.Split(cmd.IPAddresses, ",")
+		ips = make([]net.IP, 0, len(ipStrs))
+		for _, ipStr := range ipStrs {
+			ip := net.ParseIP(ipStr)
+			if ip == nil {
+				glog.Errorf("invalid ip: %s", ipStr)
+				return subcommands.ExitUsageError
+			}
+			ips = append(ips, ip)
+		}
+	}
+
+	var privKey crypto.Signer
+	if cmd.NewKey {
+		var err error
+		if privKey, err = utils.NewPrivateKey(cmd.EcdsaCruve, cmd.RSABits); err != nil {
+			glog.Errorf("generate private key fail: %v", err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	x := NewXBus()
+	db := x.NewDB()
+	app, err := apps.GetAppByName(db, appName)
+	if err != nil {
+		glog.Errorf("get app fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	if app == nil {
+		glog.Errorf("no such app: %s", appName)
+		return subcommands.ExitFailure
+	}
+	appCtrl := x.NewAppCtrl(db, x.Config.Etcd.NewEtcdClient())
+	if cmd.CSRFile != "" {
+		data, err := ioutil.ReadFile(cmd.CSRFile)
+		if err != nil {
+			glog.Errorf("read csr fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		csr, err := utils.DecodeCSRFromPem(string(data))
+		if err != nil {
+			glog.Errorf("decode csr fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		if err := appCtrl.RenewCertWithCSR(app, csr, dnsNames, ips, cmd.Days); err != nil {
+			glog.Errorf("renew cert fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		if err := utils.WriteFile(cmd.CertFile, 0644, []byte(app.Cert)); err != nil {
+			glog.Errorf("write cert fail: %v", err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
+	if privKey, err = appCtrl.RenewCert(app, privKey, dnsNames, ips, cmd.Days); err != nil {
+		glog.Errorf("renew cert fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	if err := utils.WriteFile(cmd.CertFile, 0644, []byte(app.Cert)); err != nil {
+		glog.Errorf("write cert fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	if err := utils.WritePrivateKey(cmd.KeyFile, 0600, privKey); err != nil {
+		glog.Errorf("write key fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/golang/glog"
+	"github.com/google/subcommands"
+	"github.com/infrmods/xbus/apps"
+)
+
+// RevokeCertCmd revoke cert cmd
+type RevokeCertCmd struct {
+	Reason string
+}
+
+// Name cmd name
+func (cmd *RevokeCertCmd) Name() string {
+	return "revoke-cert"
+}
+
+// Synopsis cmd synopsis
+func (cmd *RevokeCertCmd) Synopsis() string {
+	return "revoke app's cert by serial number"
+}
+
+// Usage cmd usage
+func (cmd *RevokeCertCmd) Usage() string {
+	return "revoke-cert [OPTIONS] app serial\n"
+}
+
+// SetFlags cmd set flags
+func (cmd *RevokeCertCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.Reason, "reason", "", "revoke reason")
+}
+
+// Execute cmd execute
+func (cmd *RevokeCertCmd) Execute(ctx context.Context, f *flag.FlagSet, v ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	appName, serial := f.Arg(0), f.Arg(1)
+
+	x := NewXBus()
+	db := x.NewDB()
+	app, err := apps.GetAppByName(db, appName)
+	if err != nil {
+		glog.Errorf("get app fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	if app == nil {
+		glog.Errorf("no such app: %s", appName)
+		return subcommands.ExitFailure
+	}
+	appCtrl := x.NewAppCtrl(db, x.Config.Etcd.NewEtcdClient())
+	if err := appCtrl.RevokeCert(ctx, app, serial, cmd.Reason); err != nil {
+		glog.Errorf("revoke cert fail: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/subcommands"
 	"github.com/infrmods/xbus/api"
-	"github.com/infrmods/xbus/configs"
 	"github.com/infrmods/xbus/services"
 )
 
@@ -41,17 +40,21 @@ func (cmd *RunCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 	x := NewXBus()
 	db := x.NewDB()
 	etcdClient := x.Config.Etcd.NewEtcdClient()
-	configEtcdClient := etcdClient
 	services, err := services.NewServiceCtrl(&x.Config.Services, db, etcdClient)
 	if err != nil {
 		glog.Errorf("create service fail: %v", err)
 		os.Exit(-1)
 	}
-	if x.Config.Configs.Etcd != nil {
-		configEtcdClient = x.Config.Configs.Etcd.NewEtcdClient()
-	}
-	configs := configs.NewConfigCtrl(&x.Config.Configs, db, configEtcdClient)
-	apiServer := api.NewServer(&x.Config.API, etcdClient, services, configs, x.NewAppCtrl(db, etcdClient))
+	configs := x.NewConfigCtrl(db, etcdClient)
+	go configs.RunHealthCheck()
+	go configs.RunWebhookDispatcher()
+	go configs.RunFreezeWatcher()
+	go configs.RunStateSweeper()
+	apps := x.NewAppCtrl(db, etcdClient)
+	go apps.RunRevocationWatcher()
+	go apps.RunPermWatcher()
+	go apps.RunCertExpiryMonitor()
+	apiServer := api.NewServer(&x.Config.API, etcdClient, services, configs, apps)
 	if err := apiServer.Run(); err != nil {
 		glog.Errorf("start api_sersver fail: %v", err)
 		os.Exit(-1)
@@ -0,0 +1,241 @@
+package configs
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+const (
+	// ChangeStatusPending change status pending
+	ChangeStatusPending = 0
+	// ChangeStatusApproved change status approved
+	ChangeStatusApproved = 1
+	// ChangeStatusRejected change status rejected
+	ChangeStatusRejected = 2
+
+	// ChangeOpPut change op put
+	ChangeOpPut = "put"
+	// ChangeOpDelete change op delete
+	ChangeOpDelete = "delete"
+)
+
+// ConfigChange config change request table
+type ConfigChange struct {
+	ID         int64     `json:"id"`
+	Status     int       `json:"status"`
+	Op         string    `json:"op"`
+	Tag        string    `json:"tag"`
+	Format     string    `json:"format"`
+	Name       string    `json:"name"`
+	Env        string    `json:"env"`
+	Value      string    `json:"value,omitempty"`
+	Version    int64     `json:"version"`
+	Remark     string    `json:"remark"`
+	AppID      int64     `json:"app_id"`
+	ApproverID int64     `json:"approver_id"`
+	CreateTime time.Time `json:"create_time"`
+	ModifyTime time.Time `json:"modify_time"`
+}
+
+// InsertConfigChange insert config change
+func InsertConfigChange(db *sql.DB, change *ConfigChange) error {
+	id, err := dbutil.Insert(db,
+		`insert into config_changes(status, op, tag, format, name, env, value, version, remark, app_id)
+         values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, change.Status, change.Op, change.Tag, change.Format, change.Name,
+		change.Env, change.Value, change.Version, change.Remark, change.AppID)
+	if err != nil {
+		return err
+	}
+	change.ID = id
+	return nil
+}
+
+// GetConfigChange get config change
+func GetConfigChange(db *sql.DB, id int64) (*ConfigChange, error) {
+	var change ConfigChange
+	if err := dbutil.Query(db, &change, `select * from config_changes where id=?`, id); err == nil {
+		return &change, nil
+	} else if err == sql.ErrNoRows {
+		return nil, nil
+	} else {
+		return nil, err
+	}
+}
+
+// ListConfigChanges list config changes
+func ListConfigChanges(db *sql.DB, status *int, prefix string, skip, limit int) ([]ConfigChange, error) {
+	args := make([]interface{}, 0, 4)
+	q := `select * from config_changes where 1=1`
+	if status != nil {
+		q += ` and status=?`
+		args = append(args, *status)
+	}
+	if prefix != "" {
+		q += ` and name like ? escape '\\'`
+		args = append(args, utils.EscapeLike(prefix)+"%")
+	}
+	q += ` order by id desc limit ?,?`
+	args = append(args, skip, limit)
+
+	var changes []ConfigChange
+	if err := dbutil.Query(db, &changes, q, args...); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// UpdateConfigChangeStatus update config change status
+func UpdateConfigChangeStatus(db *sql.DB, id int64, fromStatus, toStatus int, approverID int64) error {
+	_, err := dbutil.Update(db, `update config_changes set status=?, approver_id=?, modify_time=now()
+                                 where id=? and status=?`, toStatus, approverID, id, fromStatus)
+	return err
+}
+
+// IsProtected is config protected, changes of protected configs need approval
+func (ctrl *ConfigCtrl) IsProtected(name string) bool {
+	for _, prefix := range ctrl.config.ProtectedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewChange new pending config change
+func (ctrl *ConfigCtrl) NewChange(ctx context.Context, change *ConfigChange) error {
+	if err := checkName(change.Name); err != nil {
+		return err
+	}
+	if err := checkEnv(change.Env); err != nil {
+		return err
+	}
+	switch change.Op {
+	case ChangeOpPut:
+		if err := checkValueFormat(change.Format, change.Value); err != nil {
+			return err
+		}
+	case ChangeOpDelete:
+		change.Value = ""
+		change.Format = ""
+	default:
+		return utils.Errorf(utils.EcodeInvalidParam, "invalid op: %s", change.Op)
+	}
+	if change.Version < 0 {
+		key := ctrl.layerKey(change.Env, change.Name)
+		resp, err := ctrl.etcdClient.Get(ctx, key)
+		if err != nil {
+			return utils.CleanErr(err, "", "get config key(%s) fail: %v", key, err)
+		}
+		change.Version = 0
+		if len(resp.Kvs) > 0 {
+			change.Version = resp.Kvs[0].Version
+		}
+	}
+
+	change.Status = ChangeStatusPending
+	if err := InsertConfigChange(ctrl.db, change); err != nil {
+		glog.Errorf("insert config change(%s) fail: %v", change.Name, err)
+		return utils.NewSystemError("create config change fail")
+	}
+	return nil
+}
+
+// GetChange get config change
+func (ctrl *ConfigCtrl) GetChange(id int64) (*ConfigChange, error) {
+	change, err := GetConfigChange(ctrl.db, id)
+	if err != nil {
+		glog.Errorf("get config change(%d) fail: %v", id, err)
+		return nil, utils.NewSystemError("get config change fail")
+	}
+	if change == nil {
+		return nil, utils.Errorf(utils.EcodeNotFound, "no such change: %d", id)
+	}
+	return change, nil
+}
+
+// ListChanges list config changes
+func (ctrl *ConfigCtrl) ListChanges(status *int, prefix string, skip, limit int) ([]ConfigChange, error) {
+	changes, err := ListConfigChanges(ctrl.db, status, prefix, skip, limit)
+	if err != nil {
+		glog.Errorf("list config changes fail: %v", err)
+		return nil, utils.NewSystemError("list config changes fail")
+	}
+	if changes == nil {
+		changes = make([]ConfigChange, 0)
+	}
+	return changes, nil
+}
+
+func (ctrl *ConfigCtrl) checkApprover(change *ConfigChange, approverID int64) error {
+	if change.Status != ChangeStatusPending {
+		return utils.Errorf(utils.EcodeInvalidStatus, "change(%d) is not pending", change.ID)
+	}
+	if approverID <= 0 || approverID == change.AppID {
+		return utils.NewNotPermittedError("change can't be approved by requester", []string{change.Name})
+	}
+	return nil
+}
+
+// ApproveChange approve and apply config change, with version check
+func (ctrl *ConfigCtrl) ApproveChange(ctx context.Context, id, approverID int64) (*ConfigChange, int64, error) {
+	change, err := ctrl.GetChange(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := ctrl.checkApprover(change, approverID); err != nil {
+		return nil, 0, err
+	}
+	if err := UpdateConfigChangeStatus(ctrl.db, id, ChangeStatusPending, ChangeStatusApproved, approverID); err != nil {
+		if err == dbutil.ZeroEffected {
+			return nil, 0, utils.Errorf(utils.EcodeInvalidStatus, "change(%d) is not pending", id)
+		}
+		glog.Errorf("update config change(%d) status fail: %v", id, err)
+		return nil, 0, utils.NewSystemError("update config change fail")
+	}
+
+	var rev int64
+	h := ConfigHistory{Tag: change.Tag, Env: change.Env, Name: change.Name, AppID: change.AppID,
+		ApproverID: approverID, Remark: change.Remark, Value: change.Value}
+	switch change.Op {
+	case ChangeOpPut:
+		rev, err = ctrl.put(ctx, change.Format, &h, change.Version, false)
+	case ChangeOpDelete:
+		err = ctrl.delete(ctx, &h, change.Version, false)
+	}
+	if err != nil {
+		if e := UpdateConfigChangeStatus(ctrl.db, id, ChangeStatusApproved, ChangeStatusPending, 0); e != nil {
+			glog.Errorf("rollback config change(%d) status fail: %v", id, e)
+		}
+		return nil, 0, err
+	}
+	change.Status = ChangeStatusApproved
+	change.ApproverID = approverID
+	return change, rev, nil
+}
+
+// RejectChange reject config change
+func (ctrl *ConfigCtrl) RejectChange(id, approverID int64) (*ConfigChange, error) {
+	change, err := ctrl.GetChange(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctrl.checkApprover(change, approverID); err != nil {
+		return nil, err
+	}
+	if err := UpdateConfigChangeStatus(ctrl.db, id, ChangeStatusPending, ChangeStatusRejected, approverID); err != nil {
+		if err == dbutil.ZeroEffected {
+			return nil, utils.Errorf(utils.EcodeInvalidStatus, "change(%d) is not pending", id)
+		}
+		glog.Errorf("update config change(%d) status fail: %v", id, err)
+		return nil, utils.NewSystemError("update config change fail")
+	}
+	change.Status = ChangeStatusRejected
+	change.ApproverID = approverID
+	return change, nil
+}
@@ -0,0 +1,142 @@
+package configs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+var changeColumns = []string{"id", "status", "op", "tag", "format", "name", "env", "value",
+	"version", "remark", "app_id", "approver_id", "create_time", "modify_time"}
+
+func expectGetChange(mock sqlmock.Sqlmock, change *ConfigChange) {
+	now := time.Now()
+	mock.ExpectQuery(`select \* from config_changes where id=\?`).WithArgs(change.ID).WillReturnRows(
+		sqlmock.NewRows(changeColumns).AddRow(change.ID, change.Status, change.Op, change.Tag, change.Format,
+			change.Name, change.Env, change.Value, change.Version, change.Remark, change.AppID, change.ApproverID, now, now))
+}
+
+func TestNewChange(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	putLayers(t, ctrl, map[string]string{"db.host@prod": "a"})
+	putLayers(t, ctrl, map[string]string{"db.host@prod": "b"})
+
+	mock.ExpectExec(`insert into config_changes`).WithArgs(ChangeStatusPending, ChangeOpPut, "", "",
+		"db.host", "prod", "c", 2, "", 3).WillReturnResult(sqlmock.NewResult(5, 1))
+	change := ConfigChange{Op: ChangeOpPut, Name: "db.host", Env: "prod", Value: "c", Version: -1, AppID: 3}
+	if err := ctrl.NewChange(context.Background(), &change); err != nil {
+		t.Fatalf("new change fail: %v", err)
+	}
+	if change.ID != 5 || change.Version != 2 || change.Status != ChangeStatusPending {
+		t.Errorf("unexpected change: %+v", change)
+	}
+
+	for _, c := range []ConfigChange{{Op: "patch", Name: "db.host"}, {Op: ChangeOpPut, Name: "db.host", Format: FormatJSON, Value: "{"}} {
+		if err := ctrl.NewChange(context.Background(), &c); err == nil {
+			t.Errorf("expect invalid change error: %+v", c)
+		}
+	}
+	checkMockDB(t, mock)
+}
+
+func TestApproveChange(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.freezes.freezes = []ConfigFreeze{}
+	putLayers(t, ctrl, map[string]string{"db.host": "a"})
+	change := ConfigChange{ID: 7, Status: ChangeStatusPending, Op: ChangeOpPut, Name: "db.host",
+		Value: "b", Version: 1, Remark: "move", AppID: 3}
+
+	// requester can't approve
+	expectGetChange(mock, &change)
+	if _, _, err := ctrl.ApproveChange(context.Background(), 7, 3); errCode(err) != utils.EcodeNotPermitted {
+		t.Errorf("expect not permitted, got %v", err)
+	}
+
+	expectGetChange(mock, &change)
+	mock.ExpectExec(`update config_changes set status=\?`).WithArgs(ChangeStatusApproved, 4, int64(7),
+		ChangeStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert into configs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`insert into config_histories`).WithArgs(nil, "db.host", "", int64(3), int64(4),
+		"move", "b", sqlmock.AnyArg(), int64(0)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	approved, rev, err := ctrl.ApproveChange(context.Background(), 7, 4)
+	if err != nil {
+		t.Fatalf("approve change fail: %v", err)
+	}
+	if approved.Status != ChangeStatusApproved || approved.ApproverID != 4 || rev <= 0 {
+		t.Errorf("unexpected approved change: %+v, rev: %d", approved, rev)
+	}
+	if cfg, _, _ := ctrl.resolve(context.Background(), "", "db.host"); cfg == nil || cfg.Value != "b" {
+		t.Errorf("change not applied: %+v", cfg)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestApproveChangeConflict(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.freezes.freezes = []ConfigFreeze{}
+	putLayers(t, ctrl, map[string]string{"db.host": "a"})
+	putLayers(t, ctrl, map[string]string{"db.host": "a2"})
+	change := ConfigChange{ID: 7, Status: ChangeStatusPending, Op: ChangeOpDelete, Name: "db.host", Version: 1, AppID: 3}
+
+	// config changed after request, approval is rolled back to pending
+	expectGetChange(mock, &change)
+	mock.ExpectExec(`update config_changes set status=\?`).WithArgs(ChangeStatusApproved, 4, int64(7),
+		ChangeStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`update config_changes set status=\?`).WithArgs(ChangeStatusPending, 0, int64(7),
+		ChangeStatusApproved).WillReturnResult(sqlmock.NewResult(0, 1))
+	if _, _, err := ctrl.ApproveChange(context.Background(), 7, 4); errCode(err) != utils.EcodeInvalidVersion {
+		t.Errorf("expect invalid version, got %v", err)
+	}
+
+	// approved already by others
+	expectGetChange(mock, &change)
+	mock.ExpectExec(`update config_changes set status=\?`).WillReturnResult(sqlmock.NewResult(0, 0))
+	if _, _, err := ctrl.ApproveChange(context.Background(), 7, 4); errCode(err) != utils.EcodeInvalidStatus {
+		t.Errorf("expect invalid status, got %v", err)
+	}
+	if cfg, _, _ := ctrl.resolve(context.Background(), "", "db.host"); cfg == nil || cfg.Value != "a2" {
+		t.Errorf("config should not be changed: %+v", cfg)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestRejectChange(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	change := ConfigChange{ID: 7, Status: ChangeStatusRejected, Op: ChangeOpPut, Name: "db.host", AppID: 3}
+
+	expectGetChange(mock, &change)
+	if _, err := ctrl.RejectChange(7, 4); errCode(err) != utils.EcodeInvalidStatus {
+		t.Errorf("expect invalid status, got %v", err)
+	}
+
+	change.Status = ChangeStatusPending
+	expectGetChange(mock, &change)
+	mock.ExpectExec(`update config_changes set status=\?`).WithArgs(ChangeStatusRejected, 4, int64(7),
+		ChangeStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+	if rejected, err := ctrl.RejectChange(7, 4); err != nil || rejected.Status != ChangeStatusRejected {
+		t.Errorf("reject change fail: %+v, %v", rejected, err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestListChangesPrefix(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+
+	// wildcards in prefix are matched literally
+	mock.ExpectQuery(`select \* from config_changes where 1=1 and name like \? escape`).
+		WithArgs(`db\_x\%.`+"%", 0, 10).WillReturnRows(sqlmock.NewRows(changeColumns))
+	if changes, err := ctrl.ListChanges(nil, "db_x%.", 0, 10); err != nil || len(changes) != 0 {
+		t.Fatalf("list changes fail: %v, %v", changes, err)
+	}
+	checkMockDB(t, mock)
+}
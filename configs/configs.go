@@ -3,7 +3,10 @@ package configs
 import (
 	"context"
 	"database/sql"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"fmt"
 
@@ -17,14 +20,40 @@ import (
 // ConfigItem config item
 type ConfigItem struct {
 	Name    string `json:"name"`
+	Env     string `json:"env,omitempty"`
 	Value   string `json:"value"`
 	Version int64  `json:"version"`
+	Format  string `json:"format,omitempty"`
+
+	Refs     []string `json:"refs,omitempty"`
+	Degraded bool     `json:"degraded,omitempty"`
+
+	// mod revision & format of the source layer, format is loaded by Convert if unknown
+	modRevision int64
+	srcFormat   *string
 }
 
 // Config module config
 type Config struct {
-	KeyPrefix string            `default:"/configs" yaml:"key_prefix"`
-	Etcd      *utils.ETCDConfig `default:"-"`
+	KeyPrefix         string            `default:"/configs" yaml:"key_prefix"`
+	Etcd              *utils.ETCDConfig `default:"-"`
+	ProtectedPrefixes []string          `yaml:"protected_prefixes"`
+
+	ReadTimeout           time.Duration `default:"5s" yaml:"read_timeout"`
+	HealthCheckInterval   time.Duration `default:"5s" yaml:"health_check_interval"`
+	FreezeRefreshInterval time.Duration `default:"1m" yaml:"freeze_refresh_interval"`
+	StateRefreshInterval  time.Duration `default:"1h" yaml:"state_refresh_interval"`
+
+	WebhookTimeout       time.Duration `default:"5s" yaml:"webhook_timeout"`
+	WebhookMaxAttempts   int           `default:"5" yaml:"webhook_max_attempts"`
+	WebhookRetryInterval time.Duration `default:"10s" yaml:"webhook_retry_interval"`
+	WebhookWorkers       int           `default:"4" yaml:"webhook_workers"`
+	WebhookQueueSize     int           `default:"100" yaml:"webhook_queue_size"`
+	WebhookPollInterval  time.Duration `default:"1s" yaml:"webhook_poll_interval"`
+	WebhookHistoryWait   time.Duration `default:"10s" yaml:"webhook_history_wait"`
+	// WebhookAllowedHosts hosts(or domain suffixes starting with ".") webhooks may be added to by config writers,
+	// others need admin perm
+	WebhookAllowedHosts []string `yaml:"webhook_allowed_hosts"`
 }
 
 // ConfigCtrl config ctrl
@@ -32,6 +61,12 @@ type ConfigCtrl struct {
 	config     Config
 	db         *sql.DB
 	etcdClient *clientv3.Client
+
+	health     health
+	lastValues sync.Map
+	states     sync.Map
+	formats    sync.Map
+	freezes    freezeCache
 }
 
 // NewConfigCtrl new config ctrl
@@ -43,51 +78,113 @@ func NewConfigCtrl(config *Config, db *sql.DB, etcdClient *clientv3.Client) *Con
 	return configs
 }
 
-const rangeLimit = 20
+const (
+	rangeLimit    = 20
+	maxRangeLimit = 1000
+)
 
-// Range range
-func (ctrl *ConfigCtrl) Range(ctx context.Context, from, end string, sortOption *clientv3.SortOption) ([]ConfigItem, bool, error) {
-	if err := checkNamePrefix(from); err != nil {
-		return nil, false, err
+// Range get effective configs of env in names [from, end) at revision(latest if 0), sorted by name;
+// from may be a cursor of utils.NextRangeFromKey(name), returns configs, revision, more
+func (ctrl *ConfigCtrl) Range(ctx context.Context, env, from, end string, limit int, revision int64) ([]ConfigItem, int64, bool, error) {
+	if err := checkNamePrefix(strings.TrimSuffix(from, utils.NextRangeFromKey(""))); err != nil {
+		return nil, 0, false, err
 	}
 	if err := checkNamePrefix(end); err != nil {
-		return nil, false, err
+		return nil, 0, false, err
 	}
-	fromKey := ctrl.configKey(from)
-	endKey := ctrl.configKey(end)
-	if end == "" {
-		endKey = ctrl.endKey()
+	if err := checkEnv(env); err != nil {
+		return nil, 0, false, err
+	}
+	if limit <= 0 {
+		limit = rangeLimit
+	} else if limit > maxRangeLimit {
+		limit = maxRangeLimit
 	}
 
-	resp, err := ctrl.etcdClient.Get(
-		ctx, fromKey, clientv3.WithRange(endKey),
-		clientv3.WithSort(sortOption.Target, sortOption.Order),
-		clientv3.WithLimit(rangeLimit))
+	baseKvs, rev, more, err := ctrl.rangeLayer(ctx, "", from, end, limit, revision)
 	if err != nil {
-		return nil, false, utils.CleanErr(err, "", "get range(%s, %s) fail: %v", from, end, err)
+		return nil, 0, false, err
+	}
+	var envKvs []*mvccpb.KeyValue
+	if env != "" {
+		var envMore bool
+		envKvs, _, envMore, err = ctrl.rangeLayer(ctx, env, from, end, limit, rev)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		more = more || envMore
+	}
+
+	cfgs := make([]ConfigItem, 0, len(baseKvs)+len(envKvs))
+	for i, j := 0, 0; i < len(baseKvs) || j < len(envKvs); {
+		var baseName, envName string
+		if i < len(baseKvs) {
+			baseName = ctrl.layerName("", string(baseKvs[i].Key))
+		}
+		if j < len(envKvs) {
+			envName = ctrl.layerName(env, string(envKvs[j].Key))
+		}
+		switch {
+		case j == len(envKvs) || (i < len(baseKvs) && baseName < envName):
+			cfgs = append(cfgs, configFromKv(baseName, baseKvs[i]))
+			i++
+		default:
+			if baseName == envName {
+				i++
+			}
+			cfg := configFromKv(envName, envKvs[j])
+			cfg.Env = env
+			cfgs = append(cfgs, cfg)
+			j++
+		}
+	}
+	if len(cfgs) > limit {
+		cfgs = cfgs[:limit]
+		more = true
+	}
+	return cfgs, rev, more, nil
+}
+
+func (ctrl *ConfigCtrl) rangeLayer(ctx context.Context, env, from, end string,
+	limit int, revision int64) ([]*mvccpb.KeyValue, int64, bool, error) {
+	fromKey := ctrl.layerKey(env, from)
+	endKey := ctrl.layerKey(env, end)
+	if end == "" {
+		endKey = utils.RangeEndKey(ctrl.layerKey(env, ""))
+	}
+	opts := []clientv3.OpOption{clientv3.WithRange(endKey),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+		clientv3.WithLimit(int64(limit))}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
 	}
-	cfgs := make([]ConfigItem, 0, len(resp.Kvs))
-	for _, kv := range resp.Kvs {
-		key := string(kv.Key)
-		if strings.HasPrefix(key, ctrl.config.KeyPrefix) {
-			name := key[len(ctrl.config.KeyPrefix)+1:]
-			cfgs = append(cfgs, configFromKv(name, kv))
-		} else {
-			glog.Errorf("invalid key from range(%s, %s): %s", from, end, key)
+	resp, err := ctrl.etcdClient.Get(ctx, fromKey, opts...)
+	if err != nil {
+		if err == v3rpc.ErrCompacted {
+			return nil, 0, false, utils.Errorf(utils.EcodeInvalidVersion, "revision %d is compacted", revision)
 		}
+		return nil, 0, false, utils.CleanErr(err, "", "get range(%s, %s) fail: %v", fromKey, endKey, err)
 	}
-	return cfgs, resp.More, nil
+	if revision <= 0 {
+		revision = resp.Header.Revision
+	}
+	return resp.Kvs, revision, resp.More, nil
 }
 
 // ListDBConfigs list db configs
 func (ctrl *ConfigCtrl) ListDBConfigs(ctx context.Context,
-	tag, prefix string, skip, limit int) (int64, []ConfigInfo, error) {
-	count, err := GetDBConfigCount(ctrl.db, tag, prefix)
+	tag, env, prefix string, skip, limit int) (int64, []ConfigInfo, error) {
+	if env != "" {
+		if err := checkEnv(env); err != nil {
+			return 0, nil, err
+		}
+	}
+	count, err := GetDBConfigCount(ctrl.db, tag, env, prefix)
 	if err != nil {
 		glog.Errorf("get db configs(prefix: %s) fail: %v", prefix, err)
 		return 0, nil, utils.NewSystemError("get configs count fail")
 	}
-	items, err := ListDBConfigs(ctrl.db, tag, prefix, skip, limit)
+	items, err := ListDBConfigs(ctrl.db, tag, env, prefix, skip, limit)
 	if err != nil {
 		glog.Errorf("get db configs fail: %v", err)
 		return 0, nil, utils.NewSystemError("get configs fail")
@@ -98,79 +195,165 @@ func (ctrl *ConfigCtrl) ListDBConfigs(ctx context.Context,
 	return count, items, nil
 }
 
-// Get get config
-func (ctrl *ConfigCtrl) Get(ctx context.Context, appID int64, node, name string) (*ConfigItem, int64, error) {
+// Get get config, resolve the effective value for env
+func (ctrl *ConfigCtrl) Get(ctx context.Context, appID int64, node, env, name string) (*ConfigItem, int64, error) {
 	if err := checkName(name); err != nil {
 		return nil, 0, err
 	}
-
-	resp, err := ctrl.etcdClient.Get(ctx, ctrl.configKey(name))
-	if err != nil {
-		return nil, 0, utils.CleanErr(err, "", "get config key(%s) fail: %v", name, err)
+	if err := checkEnv(env); err != nil {
+		return nil, 0, err
 	}
-	if resp.Kvs == nil {
-		return nil, 0, utils.NewError(utils.EcodeNotFound, name)
+	cfg, rev, err := ctrl.get(ctx, env, name)
+	if err != nil {
+		return nil, 0, err
 	}
-	cfg := configFromKv(name, resp.Kvs[0])
 	if err := ctrl.changeAppConfigState(appID, node, name, cfg.Version); err != nil {
 		return nil, 0, err
 	}
-	return &cfg, resp.Header.Revision, nil
+	return cfg, rev, nil
+}
+
+// get get config without recording app config state
+func (ctrl *ConfigCtrl) get(ctx context.Context, env, name string) (*ConfigItem, int64, error) {
+	if ctrl.Degraded() {
+		return ctrl.getDegraded(env, name)
+	}
+	rctx, cancel := context.WithTimeout(ctx, ctrl.config.ReadTimeout)
+	defer cancel()
+	cfg, rev, err := ctrl.resolve(rctx, env, name)
+	if err != nil {
+		if ctrl.Degraded() {
+			return ctrl.getDegraded(env, name)
+		}
+		return nil, 0, err
+	}
+	if cfg == nil {
+		ctrl.lastValues.Delete(ctrl.layerKey(env, name))
+		return nil, 0, utils.NewError(utils.EcodeNotFound, name)
+	}
+	ctrl.lastValues.Store(ctrl.layerKey(env, name), lastValue{cfg: *cfg, rev: rev})
+	return cfg, rev, nil
 }
 
-// Delete delete config
-func (ctrl *ConfigCtrl) Delete(ctx context.Context, name string) error {
-	if err := ctrl.deleteDBConfig(name); err != nil {
+// Delete delete config layer, base layer if env is empty; override is required in freeze windows
+func (ctrl *ConfigCtrl) Delete(ctx context.Context, env, name string, appID int64, remark string, override bool) error {
+	return ctrl.delete(ctx, &ConfigHistory{Env: env, Name: name, AppID: appID, Remark: remark}, -1, override)
+}
+
+func (ctrl *ConfigCtrl) delete(ctx context.Context, h *ConfigHistory, version int64, override bool) error {
+	if err := checkEnv(h.Env); err != nil {
 		return err
 	}
-	if _, err := ctrl.etcdClient.Delete(ctx, ctrl.configKey(name)); err != nil {
-		return utils.CleanErr(err, "", "delete config(%s) fail: %v", name, err)
+	if err := ctrl.checkWritable(); err != nil {
+		return err
 	}
-	return nil
+	freezeID, err := ctrl.checkFrozen(h.Name, override)
+	if err != nil {
+		return err
+	}
+	h.FreezeID = freezeID
+	key := ctrl.layerKey(h.Env, h.Name)
+	if version < 0 {
+		resp, err := ctrl.etcdClient.Delete(ctx, key)
+		if err != nil {
+			ctrl.checkUnavailable(err)
+			return utils.CleanErr(err, "", "delete config(%s@%s) fail: %v", h.Name, h.Env, err)
+		}
+		h.Revision = resp.Header.Revision
+		return ctrl.deleteDBConfig(h)
+	}
+
+	cmp := clientv3.Compare(clientv3.Version(key), "=", version)
+	if resp, err := ctrl.etcdClient.Txn(ctx).If(cmp).Then(clientv3.OpDelete(key)).Commit(); err != nil {
+		ctrl.checkUnavailable(err)
+		return utils.CleanErr(err, "", "delete config(%s@%s) with version(%d) fail: %v", h.Name, h.Env, version, err)
+	} else if !resp.Succeeded {
+		return utils.NewError(utils.EcodeInvalidVersion, "")
+	} else {
+		h.Revision = resp.Header.Revision
+	}
+	return ctrl.deleteDBConfig(h)
 }
 
 func configFromKv(name string, kv *mvccpb.KeyValue) ConfigItem {
 	return ConfigItem{Name: name,
-		Value:   string(kv.Value),
-		Version: kv.Version}
+		Value:       string(kv.Value),
+		Version:     kv.Version,
+		modRevision: kv.ModRevision}
 }
 
-// Put put config
-func (ctrl *ConfigCtrl) Put(ctx context.Context, tag, name string, appID int64, remark, value string, version int64) (int64, error) {
-	if err := checkName(name); err != nil {
+// Put put config layer, base layer if env is empty; format is kept if empty;
+// override is required in freeze windows
+func (ctrl *ConfigCtrl) Put(ctx context.Context, tag, format, env, name string, appID int64,
+	remark, value string, version int64, override bool) (int64, error) {
+	h := ConfigHistory{Tag: tag, Env: env, Name: name, AppID: appID, Remark: remark, Value: value}
+	return ctrl.put(ctx, format, &h, version, override)
+}
+
+func (ctrl *ConfigCtrl) put(ctx context.Context, format string, h *ConfigHistory, version int64, override bool) (int64, error) {
+	if err := checkName(h.Name); err != nil {
 		return 0, err
 	}
-	key := ctrl.configKey(name)
+	if err := checkEnv(h.Env); err != nil {
+		return 0, err
+	}
+	if err := checkValueFormat(format, h.Value); err != nil {
+		return 0, err
+	}
+	if err := ctrl.checkWritable(); err != nil {
+		return 0, err
+	}
+	freezeID, err := ctrl.checkFrozen(h.Name, override)
+	if err != nil {
+		return 0, err
+	}
+	h.FreezeID = freezeID
+	key := ctrl.layerKey(h.Env, h.Name)
 	if version < 0 {
-		resp, err := ctrl.etcdClient.Put(ctx, key, value)
+		resp, err := ctrl.etcdClient.Put(ctx, key, h.Value)
 		if err != nil {
-			return 0, utils.CleanErr(err, "", "put config key(%s) fail: %v", name, err)
+			ctrl.checkUnavailable(err)
+			return 0, utils.CleanErr(err, "", "put config key(%s) fail: %v", key, err)
 		}
-		if err := ctrl.setDBConfig(tag, name, appID, remark, value); err != nil {
+		h.Revision = resp.Header.Revision
+		if err := ctrl.setDBConfig(format, h); err != nil {
 			return 0, err
 		}
+		ctrl.formatChanged(h, format)
 		return resp.Header.Revision, nil
 	}
 
 	cmp := clientv3.Compare(clientv3.Version(key), "=", version)
-	opPut := clientv3.OpPut(key, value)
+	opPut := clientv3.OpPut(key, h.Value)
 	if resp, err := ctrl.etcdClient.Txn(ctx).If(cmp).Then(opPut).Commit(); err != nil {
-		return 0, utils.CleanErr(err, "", "put config key(%s) with version(%d) fail: %v", name, version, err)
+		ctrl.checkUnavailable(err)
+		return 0, utils.CleanErr(err, "", "put config key(%s) with version(%d) fail: %v", key, version, err)
 	} else if !resp.Succeeded {
 		return 0, utils.NewError(utils.EcodeInvalidVersion, "")
 	} else {
-		if err := ctrl.setDBConfig(tag, name, appID, remark, value); err != nil {
+		h.Revision = resp.Header.Revision
+		if err := ctrl.setDBConfig(format, h); err != nil {
 			return 0, err
 		}
+		ctrl.formatChanged(h, format)
 		return resp.Header.Revision, nil
 	}
 }
 
-// Watch watch config
-func (ctrl *ConfigCtrl) Watch(ctx context.Context, appID int64, node, name string, revision int64) (*ConfigItem, int64, error) {
+// Watch watch config, resolve the effective value for env
+func (ctrl *ConfigCtrl) Watch(ctx context.Context, appID int64, node, env, name string, revision int64) (*ConfigItem, int64, error) {
 	if err := checkName(name); err != nil {
 		return nil, 0, err
 	}
+	if err := checkEnv(env); err != nil {
+		return nil, 0, err
+	}
+	if err := ctrl.waitRecovered(ctx); err != nil {
+		return nil, 0, err
+	}
+	if env != "" {
+		return ctrl.watchEnv(ctx, appID, node, env, name, revision)
+	}
 	watcher := clientv3.NewWatcher(ctrl.etcdClient)
 	defer watcher.Close()
 
@@ -186,7 +369,7 @@ func (ctrl *ConfigCtrl) Watch(ctx context.Context, appID int64, node, name strin
 		// if revision is compacted, return latest revision
 		if err == v3rpc.ErrCompacted {
 			glog.Warningf("key [%s] with revision [%d] is compacted, call get instead", key, revision)
-			return ctrl.Get(ctx, appID, node, name)
+			return ctrl.Get(ctx, appID, node, env, name)
 		}
 		return nil, 0, utils.CleanErr(err, "", "watch key(%s) with revision(%d) fail: %v", name, revision, err)
 	}
@@ -207,3 +390,177 @@ func (ctrl *ConfigCtrl) Watch(ctx context.Context, appID int64, node, name strin
 	}
 	return nil, 0, utils.NewSystemError("unexpected event")
 }
+
+// ConfigChanges config changes of multi watch
+type ConfigChanges struct {
+	Configs  []*ConfigItem `json:"configs"`
+	Deleted  []string      `json:"deleted"`
+	Revision int64         `json:"revision"`
+	Snapshot bool          `json:"snapshot"`
+}
+
+// NameFilter config name filter
+type NameFilter func(name string) (bool, error)
+
+// WatchMulti watch configs by names or prefix, resolve the effective values for env
+func (ctrl *ConfigCtrl) WatchMulti(ctx context.Context, appID int64, node, env string,
+	names []string, prefix string, revision int64, filter NameFilter) (*ConfigChanges, error) {
+	if err := checkEnv(env); err != nil {
+		return nil, err
+	}
+	if err := ctrl.waitRecovered(ctx); err != nil {
+		return nil, err
+	}
+	var fromName, lastName string
+	nameSet := make(map[string]bool, len(names))
+	if len(names) > 0 {
+		for _, name := range names {
+			if err := checkName(name); err != nil {
+				return nil, err
+			}
+			nameSet[name] = true
+		}
+		sorted := append([]string(nil), names...)
+		sort.Strings(sorted)
+		fromName, lastName = sorted[0], sorted[len(sorted)-1]
+	} else {
+		if err := checkNamePrefix(prefix); err != nil {
+			return nil, err
+		}
+		fromName, lastName = prefix, prefix
+	}
+	fromKey := ctrl.configKey(fromName)
+	endKey := utils.RangeEndKey(ctrl.configKey(lastName))
+	match := func(name string) (bool, error) {
+		if len(nameSet) > 0 && !nameSet[name] {
+			return false, nil
+		}
+		if filter != nil {
+			return filter(name)
+		}
+		return true, nil
+	}
+
+	watcher := clientv3.NewWatcher(ctrl.etcdClient)
+	defer watcher.Close()
+	opts := []clientv3.OpOption{clientv3.WithRange(endKey)}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+	watchCh := watcher.Watch(ctx, fromKey, opts...)
+	var envCh clientv3.WatchChan
+	if env != "" {
+		envOpts := []clientv3.OpOption{clientv3.WithRange(utils.RangeEndKey(ctrl.envConfigKey(env, lastName)))}
+		if revision > 0 {
+			envOpts = append(envOpts, clientv3.WithRev(revision))
+		}
+		envCh = watcher.Watch(ctx, ctrl.envConfigKey(env, fromName), envOpts...)
+	}
+	for {
+		var resp clientv3.WatchResponse
+		var ok bool
+		select {
+		case resp, ok = <-watchCh:
+		case resp, ok = <-envCh:
+		}
+		if !ok {
+			break
+		}
+		if err := resp.Err(); err != nil {
+			// if revision is compacted, return full snapshot
+			if err == v3rpc.ErrCompacted {
+				glog.Warningf("range [%s, %s) with revision [%d] is compacted, return snapshot instead", fromKey, endKey, revision)
+				return ctrl.snapshot(ctx, appID, node, env, fromName, lastName, match)
+			}
+			return nil, utils.CleanErr(err, "", "watch range(%s, %s) with revision(%d) fail: %v", fromKey, endKey, revision, err)
+		}
+		if resp.Canceled {
+			return nil, utils.NewError(utils.EcodeEtcdWatchFailed, fmt.Sprintf("watch range(%s, %s) canceled", fromKey, endKey))
+		}
+
+		changes := &ConfigChanges{Configs: make([]*ConfigItem, 0), Deleted: make([]string, 0),
+			Revision: resp.Header.Revision}
+		latest := make(map[string]*ConfigItem)
+		fromEnv := make(map[string]bool)
+		order := make([]string, 0, len(resp.Events))
+		for _, event := range resp.Events {
+			name := ctrl.layerName(env, string(event.Kv.Key))
+			if name == "" {
+				continue
+			}
+			if env != "" && string(event.Kv.Key) == ctrl.envConfigKey(env, name) {
+				fromEnv[name] = true
+			}
+			if ok, err := match(name); err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+			if _, exists := latest[name]; !exists {
+				order = append(order, name)
+			}
+			switch event.Type {
+			case mvccpb.PUT:
+				cfg := configFromKv(name, event.Kv)
+				latest[name] = &cfg
+			case mvccpb.DELETE:
+				latest[name] = nil
+			}
+		}
+		if env != "" {
+			resolved := order[:0]
+			for _, name := range order {
+				cfg, _, err := ctrl.resolve(ctx, env, name)
+				if err != nil {
+					return nil, err
+				}
+				if !fromEnv[name] && cfg != nil && cfg.Env != "" {
+					// base layer changed but shadowed by env layer
+					continue
+				}
+				latest[name] = cfg
+				resolved = append(resolved, name)
+			}
+			order = resolved
+		}
+		for _, name := range order {
+			if cfg := latest[name]; cfg != nil {
+				if err := ctrl.changeAppConfigState(appID, node, name, cfg.Version); err != nil {
+					return nil, err
+				}
+				changes.Configs = append(changes.Configs, cfg)
+			} else {
+				changes.Deleted = append(changes.Deleted, name)
+			}
+		}
+		if len(order) > 0 {
+			return changes, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, utils.CleanErr(err, "", "watch range(%s, %s) fail: %v", fromKey, endKey, err)
+	}
+	return nil, utils.NewError(utils.EcodeEtcdWatchFailed, fmt.Sprintf("watch range(%s, %s) fail, no events", fromKey, endKey))
+}
+
+func (ctrl *ConfigCtrl) snapshot(ctx context.Context, appID int64, node, env string,
+	fromName, lastName string, match NameFilter) (*ConfigChanges, error) {
+	cfgs, rev, err := ctrl.resolveRange(ctx, env, fromName, lastName)
+	if err != nil {
+		return nil, err
+	}
+	changes := &ConfigChanges{Configs: make([]*ConfigItem, 0, len(cfgs)), Deleted: make([]string, 0),
+		Revision: rev, Snapshot: true}
+	for _, cfg := range cfgs {
+		if ok, err := match(cfg.Name); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		if err := ctrl.changeAppConfigState(appID, node, cfg.Name, cfg.Version); err != nil {
+			return nil, err
+		}
+		changes.Configs = append(changes.Configs, cfg)
+	}
+	return changes, nil
+}
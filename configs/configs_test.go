@@ -0,0 +1,96 @@
+package configs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/infrmods/xbus/utils"
+)
+
+func watchMulti(t *testing.T, ctrl *ConfigCtrl, env string, names []string, prefix string,
+	revision int64, filter NameFilter) *ConfigChanges {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes, err := ctrl.WatchMulti(ctx, 0, "", env, names, prefix, revision, filter)
+	if err != nil {
+		t.Fatalf("watch multi fail: %v", err)
+	}
+	return changes
+}
+
+func configValues(changes *ConfigChanges) map[string]string {
+	values := make(map[string]string)
+	for _, cfg := range changes.Configs {
+		values[cfg.Name] = cfg.Value
+	}
+	return values
+}
+
+func TestWatchMultiNames(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	rev := putLayers(t, ctrl, map[string]string{"db.keya": "1", "db.keyb": "2", "db.keyc": "3"})
+	rev = putLayers(t, ctrl, map[string]string{"db.keya": "", "db.keyb": "22", "db.keyc": "33"})
+
+	changes := watchMulti(t, ctrl, "", []string{"db.keyb", "db.keya"}, "", rev, nil)
+	if changes.Revision != rev || changes.Snapshot {
+		t.Errorf("unexpected revision %d(expect %d), snapshot: %v", changes.Revision, rev, changes.Snapshot)
+	}
+	if values := configValues(changes); len(values) != 1 || values["db.keyb"] != "22" {
+		t.Errorf("unexpected configs: %v", values)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0] != "db.keya" {
+		t.Errorf("unexpected deleted: %v", changes.Deleted)
+	}
+}
+
+func TestWatchMultiPrefix(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	rev := putLayers(t, ctrl, map[string]string{"db.keya": "1", "db.secret": "2", "dbxkey": "3", "mq.keya": "4"})
+	filter := func(name string) (bool, error) { return name != "db.secret", nil }
+
+	changes := watchMulti(t, ctrl, "", nil, "db.", rev, filter)
+	if values := configValues(changes); len(values) != 1 || values["db.keya"] != "1" {
+		t.Errorf("unexpected configs: %v", values)
+	}
+
+	// changes out of prefix or filtered are skipped
+	done := make(chan *ConfigChanges)
+	go func() { done <- watchMulti(t, ctrl, "", nil, "db.", rev+1, filter) }()
+	putLayers(t, ctrl, map[string]string{"mq.keya": "44"})
+	putLayers(t, ctrl, map[string]string{"db.secret": "22"})
+	putLayers(t, ctrl, map[string]string{"db.keyb": "5"})
+	if values := configValues(<-done); len(values) != 1 || values["db.keyb"] != "5" {
+		t.Errorf("unexpected configs: %v", values)
+	}
+}
+
+func TestWatchMultiCompacted(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	rev := putLayers(t, ctrl, map[string]string{"db.keya": "1", "db.keyb": "2"})
+	last := putLayers(t, ctrl, map[string]string{"db.keya": "11"})
+	if _, err := ctrl.etcdClient.Compact(context.Background(), last); err != nil {
+		t.Fatalf("compact fail: %v", err)
+	}
+
+	changes := watchMulti(t, ctrl, "", []string{"db.keya", "db.keyb"}, "", rev, nil)
+	if !changes.Snapshot {
+		t.Errorf("expect snapshot")
+	}
+	if values := configValues(changes); len(values) != 2 || values["db.keya"] != "11" || values["db.keyb"] != "2" {
+		t.Errorf("unexpected configs: %v", values)
+	}
+}
+
+func TestWatchMultiInvalid(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	ctx := context.Background()
+	if _, err := ctrl.WatchMulti(ctx, 0, "", "", []string{"db.keya", "1x"}, "", 0, nil); err == nil {
+		t.Errorf("expect invalid name error")
+	} else if e, ok := err.(*utils.Error); !ok || e.Code != utils.EcodeInvalidName {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := ctrl.WatchMulti(ctx, 0, "", "", nil, "db/", 0, nil); err == nil {
+		t.Errorf("expect invalid prefix error")
+	}
+}
@@ -21,17 +21,19 @@ type DBConfigItem struct {
 	ID         int64     `json:"id"`
 	Status     int       `json:"-"`
 	Tag        string    `json:"tag"`
+	Format     string    `json:"format"`
 	Name       string    `json:"name"`
+	Env        string    `json:"env"`
 	Value      string    `json:"value"`
 	CreateTime time.Time `json:"create_time"`
 	ModifyTime time.Time `json:"modify_time"`
 }
 
 // GetDBConfig get db config
-func GetDBConfig(db *sql.DB, name string) (*DBConfigItem, error) {
+func GetDBConfig(db *sql.DB, env, name string) (*DBConfigItem, error) {
 	var item DBConfigItem
 	if err := dbutil.Query(db, &item, `select * from configs where
-			status=? and name=?`, ConfigStatusOk, name); err == nil {
+			status=? and name=? and env=?`, ConfigStatusOk, name, env); err == nil {
 		return &item, nil
 	} else if err == sql.ErrNoRows {
 		return nil, nil
@@ -41,8 +43,8 @@ func GetDBConfig(db *sql.DB, name string) (*DBConfigItem, error) {
 }
 
 // GetDBConfigCount get db config count
-func GetDBConfigCount(db *sql.DB, tag, prefix string) (int64, error) {
-	args := make([]interface{}, 0, 3)
+func GetDBConfigCount(db *sql.DB, tag, env, prefix string) (int64, error) {
+	args := make([]interface{}, 0, 4)
 	q := `select count(*) from configs where status=?`
 	args = append(args, ConfigStatusOk)
 
@@ -50,6 +52,10 @@ func GetDBConfigCount(db *sql.DB, tag, prefix string) (int64, error) {
 		q += ` and tag = ?`
 		args = append(args, tag)
 	}
+	if env != "" {
+		q += ` and env = ?`
+		args = append(args, env)
+	}
 	if prefix != "" {
 		q += ` and name like ?`
 		args = append(args, prefix+"%")
@@ -63,22 +69,28 @@ func GetDBConfigCount(db *sql.DB, tag, prefix string) (int64, error) {
 	return count, nil
 }
 
-// ConfigInfo config info
+// ConfigInfo config info, env is empty for base layer
 type ConfigInfo struct {
 	Tag        *string   `json:"tag"`
+	Format     string    `json:"format"`
 	Name       string    `json:"name"`
+	Env        string    `json:"env"`
 	ModifyTime time.Time `json:"modify_time"`
 }
 
 // ListDBConfigs list db configs
-func ListDBConfigs(db *sql.DB, tag, prefix string, skip, limit int) ([]ConfigInfo, error) {
-	args := make([]interface{}, 0, 3)
-	q := `select tag,name,modify_time from configs where status=?`
+func ListDBConfigs(db *sql.DB, tag, env, prefix string, skip, limit int) ([]ConfigInfo, error) {
+	args := make([]interface{}, 0, 4)
+	q := `select tag,format,name,env,modify_time from configs where status=?`
 	args = append(args, ConfigStatusOk)
 	if tag != "" {
 		q += ` and tag = ?`
 		args = append(args, tag)
 	}
+	if env != "" {
+		q += ` and env = ?`
+		args = append(args, env)
+	}
 	if prefix != "" {
 		q += ` and name like ?`
 		args = append(args, prefix+"%")
@@ -100,13 +112,33 @@ type ConfigHistory struct {
 	ID         int64     `json:"id"`
 	Tag        string    `json:"tag"`
 	Name       string    `json:"name"`
+	Env        string    `json:"env"`
 	AppID      int64     `json:"modified_by"`
+	ApproverID int64     `json:"approved_by"`
 	Remark     string    `json:"remark"`
 	Value      string    `json:"value"`
+	Revision   int64     `json:"revision"`
+	FreezeID   int64     `json:"freeze_id"`
 	CreateTime time.Time `json:"create_time"`
 }
 
-func (ctrl *ConfigCtrl) setDBConfig(tag, name string, appID int64, remark, value string) (rerr error) {
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertDBConfigHistory(tx execer, h *ConfigHistory) error {
+	var tagV sql.NullString
+	if h.Tag != "" {
+		tagV.Valid = true
+		tagV.String = h.Tag
+	}
+	_, err := tx.Exec(`insert into config_histories(tag,name,env,app_id,approver_id,remark,value,revision,freeze_id,create_time)
+                       values(?,?,?,?,?,?,?,?,?,now())`, tagV, h.Name, h.Env, h.AppID, h.ApproverID, h.Remark,
+		h.Value, h.Revision, h.FreezeID)
+	return err
+}
+
+func (ctrl *ConfigCtrl) setDBConfig(format string, h *ConfigHistory) (rerr error) {
 	tx, err := ctrl.db.Begin()
 	if err != nil {
 		glog.Errorf("new db tx fail: %v", err)
@@ -122,36 +154,61 @@ func (ctrl *ConfigCtrl) setDBConfig(tag, name string, appID int64, remark, value
 	}()
 
 	var tagV sql.NullString
-	if tag != "" {
+	if h.Tag != "" {
 		tagV.Valid = true
-		tagV.String = tag
+		tagV.String = h.Tag
 	}
 
-	if _, err := tx.Exec(`insert into configs(status,tag,name,value,create_time,modify_time)
-                          values(?,?,?,?,now(),now())
-                          on duplicate key update status=?, tag=?, value=?, modify_time=now()`,
-		ConfigStatusOk, tagV, name, value, ConfigStatusOk, tagV, value); err != nil {
-		glog.Errorf("insert db config(%s) fail: %v", name, err)
+	if _, err := tx.Exec(`insert into configs(status,tag,format,name,env,value,create_time,modify_time)
+                          values(?,?,?,?,?,?,now(),now())
+                          on duplicate key update status=?, tag=?, format=if(?='', format, ?), value=?, modify_time=now()`,
+		ConfigStatusOk, tagV, format, h.Name, h.Env, h.Value, ConfigStatusOk, tagV, format, format, h.Value); err != nil {
+		glog.Errorf("insert db config(%s) fail: %v", h.Name, err)
 		return utils.NewError(utils.EcodeSystemError, "update db config fail")
 	}
-	if _, err := tx.Exec(`insert into config_histories(tag, name,app_id,remark,value,create_time)
-                          values(?,?,?,?,?,now())`, tagV, name, appID, remark, value); err != nil {
+	if err := insertDBConfigHistory(tx, h); err != nil {
 		glog.Errorf("insert db config history fail: %v", err)
 		return utils.NewError(utils.EcodeSystemError, "insert db config history fail")
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		glog.Errorf("set db config(%s), commit fail: %v", name, err)
+		glog.Errorf("set db config(%s), commit fail: %v", h.Name, err)
 		return utils.NewError(utils.EcodeSystemError, "commit db fail")
 	}
 	return nil
 }
 
-func (ctrl *ConfigCtrl) deleteDBConfig(name string) error {
-	if _, err := ctrl.db.Exec(`update configs set status=? where name=?`, ConfigStatusDeleted, name); err != nil {
+// deleteDBConfig delete db config, deletion is recorded in history with empty value
+func (ctrl *ConfigCtrl) deleteDBConfig(h *ConfigHistory) (rerr error) {
+	tx, err := ctrl.db.Begin()
+	if err != nil {
+		glog.Errorf("new db tx fail: %v", err)
+		return utils.NewError(utils.EcodeSystemError, "new db tx fail")
+	}
+
+	defer func() {
+		if rerr != nil {
+			if err := tx.Rollback(); err != nil {
+				glog.Warningf("tx roolback fail: %v", err)
+			}
+		}
+	}()
+
+	if _, err := tx.Exec(`update configs set status=? where name=? and env=?`, ConfigStatusDeleted, h.Name, h.Env); err != nil {
+		glog.Errorf("delete db config(%s) fail: %v", h.Name, err)
 		return utils.NewError(utils.EcodeSystemError, "delete config fail")
 	}
+	h.Value = ""
+	if err := insertDBConfigHistory(tx, h); err != nil {
+		glog.Errorf("insert db config(%s) deletion history fail: %v", h.Name, err)
+		return utils.NewError(utils.EcodeSystemError, "insert db config history fail")
+	}
+
+	if err := tx.Commit(); err != nil {
+		glog.Errorf("delete db config(%s), commit fail: %v", h.Name, err)
+		return utils.NewError(utils.EcodeSystemError, "commit db fail")
+	}
 	return nil
 }
 
@@ -166,17 +223,56 @@ type AppConfigState struct {
 	ModifyTime time.Time `json:"modify_time"`
 }
 
+type appConfigStateKey struct {
+	appID      int64
+	appNode    string
+	configName string
+}
+
+type appConfigStateMark struct {
+	version   int64
+	writeTime time.Time
+}
+
+// changeAppConfigState record config version read by app node,
+// unchanged versions are written at most once per StateRefreshInterval
 func (ctrl *ConfigCtrl) changeAppConfigState(appID int64, appNode, configName string, version int64) error {
 	if appID <= 0 {
 		return nil
 	}
+	key := appConfigStateKey{appID: appID, appNode: appNode, configName: configName}
+	now := time.Now()
+	if v, ok := ctrl.states.Load(key); ok {
+		if mark := v.(appConfigStateMark); mark.version == version && now.Sub(mark.writeTime) < ctrl.config.StateRefreshInterval {
+			return nil
+		}
+	}
 	_, err := ctrl.db.Exec(`insert into app_config_states(app_id,app_node,config_name,version,create_time,modify_time)
                             values(?,?,?,?,now(),now())
-                            on duplicate key update version=?`,
+                            on duplicate key update version=?, modify_time=now()`,
 		appID, appNode, configName, version, version)
 	if err != nil {
 		glog.Errorf("change app(%d - %s) config(%s) state(ver: %d) fail: %v", appID, appNode, configName, version, err)
 		return utils.NewError(utils.EcodeSystemError, "change app config state fail")
 	}
+	ctrl.states.Store(key, appConfigStateMark{version: version, writeTime: now})
 	return nil
 }
+
+// RunStateSweeper sweep app config state marks out of StateRefreshInterval periodically,
+// they no longer throttle writes, so marks of gone app nodes don't pile up
+func (ctrl *ConfigCtrl) RunStateSweeper() {
+	for {
+		time.Sleep(ctrl.config.StateRefreshInterval)
+		ctrl.sweepStates(time.Now())
+	}
+}
+
+func (ctrl *ConfigCtrl) sweepStates(now time.Time) {
+	ctrl.states.Range(func(key, v interface{}) bool {
+		if now.Sub(v.(appConfigStateMark).writeTime) >= ctrl.config.StateRefreshInterval {
+			ctrl.states.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,138 @@
+package configs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+	"google.golang.org/grpc/codes"
+)
+
+type health struct {
+	sync.Mutex
+	degraded  bool
+	recovered chan struct{}
+}
+
+// Degraded is etcd unavailable, configs are served from db or snapshot
+func (ctrl *ConfigCtrl) Degraded() bool {
+	ctrl.health.Lock()
+	defer ctrl.health.Unlock()
+	return ctrl.health.degraded
+}
+
+func (ctrl *ConfigCtrl) setDegraded(degraded bool) {
+	ctrl.health.Lock()
+	defer ctrl.health.Unlock()
+	if ctrl.health.degraded == degraded {
+		return
+	}
+	ctrl.health.degraded = degraded
+	if degraded {
+		glog.Warningf("configs etcd unavailable, switch to degraded mode")
+		ctrl.health.recovered = make(chan struct{})
+	} else {
+		glog.Infof("configs etcd recovered, leave degraded mode")
+		close(ctrl.health.recovered)
+	}
+}
+
+func (ctrl *ConfigCtrl) checkUnavailable(err error) {
+	if err == context.DeadlineExceeded {
+		ctrl.setDegraded(true)
+		return
+	}
+	switch utils.GetErrCode(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		ctrl.setDegraded(true)
+	}
+}
+
+func (ctrl *ConfigCtrl) checkWritable() error {
+	if ctrl.Degraded() {
+		return utils.NewError(utils.EcodeDegraded, "etcd unavailable, configs are read only")
+	}
+	return nil
+}
+
+// waitRecovered wait until etcd recovered if degraded
+func (ctrl *ConfigCtrl) waitRecovered(ctx context.Context) error {
+	ctrl.health.Lock()
+	degraded, recovered := ctrl.health.degraded, ctrl.health.recovered
+	ctrl.health.Unlock()
+	if !degraded {
+		return nil
+	}
+	select {
+	case <-recovered:
+		return nil
+	case <-ctx.Done():
+		return utils.CleanErr(ctx.Err(), "", "wait configs etcd recover fail: %v", ctx.Err())
+	}
+}
+
+// RunHealthCheck check etcd health periodically, switch degraded mode on/off
+func (ctrl *ConfigCtrl) RunHealthCheck() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), ctrl.config.ReadTimeout)
+		_, err := ctrl.etcdClient.Get(ctx, ctrl.configKey(""))
+		cancel()
+		if err == nil {
+			ctrl.setDegraded(false)
+		} else {
+			glog.Warningf("check configs etcd health fail: %v", err)
+			ctrl.checkUnavailable(err)
+		}
+		time.Sleep(ctrl.config.HealthCheckInterval)
+	}
+}
+
+// lastValue last effective config & revision read from etcd
+type lastValue struct {
+	cfg ConfigItem
+	rev int64
+}
+
+func (ctrl *ConfigCtrl) lastValue(env, name string) (lastValue, bool) {
+	if v, ok := ctrl.lastValues.Load(ctrl.layerKey(env, name)); ok {
+		return v.(lastValue), true
+	}
+	return lastValue{}, false
+}
+
+// getDegraded get config from db, then in-memory snapshot;
+// version & revision of db config are known only if its value is unchanged since last read
+func (ctrl *ConfigCtrl) getDegraded(env, name string) (*ConfigItem, int64, error) {
+	envs := []string{""}
+	if env != "" {
+		envs = []string{env, ""}
+	}
+	last, hasLast := ctrl.lastValue(env, name)
+	for _, e := range envs {
+		item, err := GetDBConfig(ctrl.db, e, name)
+		if err != nil {
+			glog.Errorf("get db config(%s@%s) fail: %v", name, e, err)
+			return ctrl.getSnapshot(env, name)
+		}
+		if item != nil {
+			cfg := ConfigItem{Name: name, Env: e, Value: item.Value, Degraded: true, srcFormat: &item.Format}
+			if hasLast && last.cfg.Env == e && last.cfg.Value == item.Value {
+				cfg.Version = last.cfg.Version
+				return &cfg, last.rev, nil
+			}
+			return &cfg, 0, nil
+		}
+	}
+	return nil, 0, utils.NewError(utils.EcodeNotFound, name)
+}
+
+func (ctrl *ConfigCtrl) getSnapshot(env, name string) (*ConfigItem, int64, error) {
+	if last, ok := ctrl.lastValue(env, name); ok {
+		cfg := last.cfg
+		cfg.Degraded = true
+		return &cfg, last.rev, nil
+	}
+	return nil, 0, utils.NewError(utils.EcodeDegraded, "etcd & db unavailable")
+}
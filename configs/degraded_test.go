@@ -0,0 +1,101 @@
+package configs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+var dbConfigColumns = []string{"id", "status", "tag", "format", "name", "env", "value", "create_time", "modify_time"}
+
+func expectGetDBConfig(mock sqlmock.Sqlmock, env, name, value string) {
+	now := time.Now()
+	rows := sqlmock.NewRows(dbConfigColumns)
+	if value != "" {
+		rows.AddRow(1, ConfigStatusOk, "", "", name, env, value, now, now)
+	}
+	mock.ExpectQuery(`select \* from configs where`).WithArgs(ConfigStatusOk, name, env).WillReturnRows(rows)
+}
+
+func TestGetDegraded(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	putLayers(t, ctrl, map[string]string{"db.host": "a"})
+	rev := putLayers(t, ctrl, map[string]string{"db.host": "b", "db.port@prod": "3306"})
+	ctx := context.Background()
+	for _, env := range []string{"", "prod"} {
+		if _, _, err := ctrl.Get(ctx, 0, "", env, "db.host"); err != nil {
+			t.Fatalf("get config fail: %v", err)
+		}
+	}
+	ctrl.setDegraded(true)
+
+	// value unchanged since last read, version & revision are known
+	expectGetDBConfig(mock, "", "db.host", "b")
+	cfg, r, err := ctrl.Get(ctx, 0, "", "", "db.host")
+	if err != nil || !cfg.Degraded || cfg.Value != "b" || cfg.Version != 2 || r != rev {
+		t.Errorf("unexpected degraded config: %+v, rev: %d, %v", cfg, r, err)
+	}
+
+	// env layer added after last read
+	expectGetDBConfig(mock, "prod", "db.host", "c")
+	cfg, r, err = ctrl.Get(ctx, 0, "", "prod", "db.host")
+	if err != nil || cfg.Value != "c" || cfg.Env != "prod" || cfg.Version != 0 || r != 0 {
+		t.Errorf("unexpected degraded config: %+v, rev: %d, %v", cfg, r, err)
+	}
+
+	// falls back to base layer, then snapshot on db failure
+	expectGetDBConfig(mock, "prod", "db.port", "")
+	expectGetDBConfig(mock, "", "db.port", "")
+	if _, _, err := ctrl.Get(ctx, 0, "", "prod", "db.port"); errCode(err) != utils.EcodeNotFound {
+		t.Errorf("expect not found, got %v", err)
+	}
+	mock.ExpectQuery(`select \* from configs where`).WillReturnError(sqlmock.ErrCancelled)
+	cfg, r, err = ctrl.Get(ctx, 0, "", "prod", "db.host")
+	if err != nil || cfg.Value != "b" || cfg.Version != 2 || r != rev || !cfg.Degraded {
+		t.Errorf("unexpected snapshot config: %+v, rev: %d, %v", cfg, r, err)
+	}
+	mock.ExpectQuery(`select \* from configs where`).WillReturnError(sqlmock.ErrCancelled)
+	if _, _, err := ctrl.Get(ctx, 0, "", "", "db.user"); errCode(err) != utils.EcodeDegraded {
+		t.Errorf("expect degraded error, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestWriteDegraded(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	ctrl.freezes.freezes = []ConfigFreeze{}
+
+	// etcd timeout of write switches to degraded mode
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if _, err := ctrl.Put(ctx, "", "", "", "db.host", 0, "", "a", -1, false); err == nil {
+		t.Fatalf("expect put fail")
+	}
+	if !ctrl.Degraded() {
+		t.Fatalf("expect degraded")
+	}
+	if _, err := ctrl.Put(context.Background(), "", "", "", "db.host", 0, "", "a", -1, false); errCode(err) != utils.EcodeDegraded {
+		t.Errorf("expect read only, got %v", err)
+	}
+	if err := ctrl.Delete(context.Background(), "", "db.host", 0, "", false); errCode(err) != utils.EcodeDegraded {
+		t.Errorf("expect read only, got %v", err)
+	}
+
+	// watches wait until recovered
+	done := make(chan error)
+	go func() { done <- ctrl.waitRecovered(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("wait recovered returned while degraded: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	ctrl.setDegraded(false)
+	if err := <-done; err != nil {
+		t.Errorf("wait recovered fail: %v", err)
+	}
+}
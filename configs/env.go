@@ -0,0 +1,191 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/coreos/etcd/clientv3"
+	v3rpc "github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// resolve get the effective config of env, env layer first, then base layer
+func (ctrl *ConfigCtrl) resolve(ctx context.Context, env, name string) (*ConfigItem, int64, error) {
+	if env == "" {
+		resp, err := ctrl.etcdClient.Get(ctx, ctrl.configKey(name))
+		if err != nil {
+			ctrl.checkUnavailable(err)
+			return nil, 0, utils.CleanErr(err, "", "get config key(%s) fail: %v", name, err)
+		}
+		if len(resp.Kvs) == 0 {
+			return nil, resp.Header.Revision, nil
+		}
+		cfg := configFromKv(name, resp.Kvs[0])
+		return &cfg, resp.Header.Revision, nil
+	}
+
+	resp, err := ctrl.etcdClient.Txn(ctx).Then(
+		clientv3.OpGet(ctrl.envConfigKey(env, name)),
+		clientv3.OpGet(ctrl.configKey(name))).Commit()
+	if err != nil {
+		ctrl.checkUnavailable(err)
+		return nil, 0, utils.CleanErr(err, "", "get config(%s@%s) fail: %v", name, env, err)
+	}
+	for i, r := range resp.Responses {
+		if kvs := r.GetResponseRange().Kvs; len(kvs) > 0 {
+			cfg := configFromKv(name, kvs[0])
+			if i == 0 {
+				cfg.Env = env
+			}
+			return &cfg, resp.Header.Revision, nil
+		}
+	}
+	return nil, resp.Header.Revision, nil
+}
+
+// GetLayer get config of exact layer, base layer if env is empty
+func (ctrl *ConfigCtrl) GetLayer(ctx context.Context, env, name string) (*ConfigItem, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	if err := checkEnv(env); err != nil {
+		return nil, err
+	}
+	key := ctrl.layerKey(env, name)
+	resp, err := ctrl.etcdClient.Get(ctx, key)
+	if err != nil {
+		return nil, utils.CleanErr(err, "", "get config key(%s) fail: %v", key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	cfg := configFromKv(name, resp.Kvs[0])
+	cfg.Env = env
+	return &cfg, nil
+}
+
+// ListLayer list all configs of exact layer with name prefix
+func (ctrl *ConfigCtrl) ListLayer(ctx context.Context, env, prefix string) ([]*ConfigItem, error) {
+	if err := checkNamePrefix(prefix); err != nil {
+		return nil, err
+	}
+	if err := checkEnv(env); err != nil {
+		return nil, err
+	}
+	fromKey := ctrl.layerKey(env, prefix)
+	resp, err := ctrl.etcdClient.Get(ctx, fromKey, clientv3.WithRange(utils.RangeEndKey(fromKey)),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, utils.CleanErr(err, "", "list configs(%s@%s) fail: %v", prefix, env, err)
+	}
+	cfgs := make([]*ConfigItem, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		name := ctrl.layerName(env, string(kv.Key))
+		if name == "" {
+			continue
+		}
+		cfg := configFromKv(name, kv)
+		cfg.Env = env
+		cfgs = append(cfgs, &cfg)
+	}
+	return cfgs, nil
+}
+
+// resolveRange get the effective configs of env in names [fromName, lastName*]
+func (ctrl *ConfigCtrl) resolveRange(ctx context.Context, env, fromName, lastName string) ([]*ConfigItem, int64, error) {
+	ops := []clientv3.Op{clientv3.OpGet(ctrl.configKey(fromName),
+		clientv3.WithRange(utils.RangeEndKey(ctrl.configKey(lastName))))}
+	if env != "" {
+		ops = append(ops, clientv3.OpGet(ctrl.envConfigKey(env, fromName),
+			clientv3.WithRange(utils.RangeEndKey(ctrl.envConfigKey(env, lastName)))))
+	}
+	resp, err := ctrl.etcdClient.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, 0, utils.CleanErr(err, "", "get range(%s, %s) fail: %v", fromName, lastName, err)
+	}
+
+	cfgs := make(map[string]*ConfigItem)
+	for _, r := range resp.Responses {
+		for _, kv := range r.GetResponseRange().Kvs {
+			name := ctrl.layerName(env, string(kv.Key))
+			if name == "" {
+				continue
+			}
+			cfg := configFromKv(name, kv)
+			if string(kv.Key) == ctrl.envConfigKey(env, name) {
+				cfg.Env = env
+			}
+			cfgs[name] = &cfg
+		}
+	}
+	names := make([]string, 0, len(cfgs))
+	for name := range cfgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]*ConfigItem, 0, len(names))
+	for _, name := range names {
+		items = append(items, cfgs[name])
+	}
+	return items, resp.Header.Revision, nil
+}
+
+func (ctrl *ConfigCtrl) watchEnv(ctx context.Context, appID int64, node, env, name string, revision int64) (*ConfigItem, int64, error) {
+	watcher := clientv3.NewWatcher(ctrl.etcdClient)
+	defer watcher.Close()
+
+	var opts []clientv3.OpOption
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+	baseCh := watcher.Watch(ctx, ctrl.configKey(name), opts...)
+	envCh := watcher.Watch(ctx, ctrl.envConfigKey(env, name), opts...)
+	for {
+		var resp clientv3.WatchResponse
+		var ok, fromEnv bool
+		select {
+		case resp, ok = <-baseCh:
+		case resp, ok = <-envCh:
+			fromEnv = true
+		}
+		if !ok {
+			break
+		}
+		if err := resp.Err(); err != nil {
+			// if revision is compacted, return latest revision
+			if err == v3rpc.ErrCompacted {
+				glog.Warningf("config [%s@%s] with revision [%d] is compacted, call get instead", name, env, revision)
+				return ctrl.Get(ctx, appID, node, env, name)
+			}
+			return nil, 0, utils.CleanErr(err, "", "watch config(%s@%s) with revision(%d) fail: %v", name, env, revision, err)
+		}
+		if resp.Canceled {
+			return nil, resp.Header.Revision, utils.NewError(utils.EcodeEtcdWatchFailed, fmt.Sprintf("watch config(%s@%s) canceled", name, env))
+		}
+		if len(resp.Events) == 0 {
+			continue
+		}
+
+		cfg, rev, err := ctrl.resolve(ctx, env, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		if cfg == nil {
+			return nil, 0, utils.NewError(utils.EcodeDeleted, "")
+		}
+		if !fromEnv && cfg.Env != "" {
+			// base layer changed but shadowed by env layer
+			continue
+		}
+		if err := ctrl.changeAppConfigState(appID, node, name, cfg.Version); err != nil {
+			return nil, 0, err
+		}
+		return cfg, rev, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, utils.CleanErr(err, "", "watch config(%s@%s) fail: %v", name, env, err)
+	}
+	return nil, 0, utils.NewError(utils.EcodeEtcdWatchFailed, fmt.Sprintf("watch config(%s@%s) fail, no events", name, env))
+}
@@ -0,0 +1,128 @@
+package configs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/infrmods/xbus/utils"
+)
+
+func TestResolveEnv(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	putLayers(t, ctrl, map[string]string{"db.host": "base", "db.port": "3306", "db.host@prod": "prod"})
+	ctx := context.Background()
+	cases := []struct {
+		env, name, value, fromEnv string
+	}{
+		{"", "db.host", "base", ""},
+		{"prod", "db.host", "prod", "prod"},
+		{"prod", "db.port", "3306", ""},
+		{"test", "db.host", "base", ""},
+	}
+	for _, c := range cases {
+		cfg, _, err := ctrl.resolve(ctx, c.env, c.name)
+		if err != nil {
+			t.Fatalf("resolve %s@%s fail: %v", c.name, c.env, err)
+		}
+		if cfg == nil || cfg.Value != c.value || cfg.Env != c.fromEnv {
+			t.Errorf("resolve %s@%s, expect %s from %q, got %+v", c.name, c.env, c.value, c.fromEnv, cfg)
+		}
+	}
+	if cfg, _, err := ctrl.resolve(ctx, "prod", "db.user"); err != nil || cfg != nil {
+		t.Errorf("expect not found, got %+v: %v", cfg, err)
+	}
+}
+
+func TestRangeEnv(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	rev := putLayers(t, ctrl, map[string]string{"db.key1": "1", "db.key2": "2", "db.key4": "4",
+		"db.key2@prod": "22", "db.key3@prod": "33", "db.key5@prod": "55", "db.key9@test": "99"})
+	ctx := context.Background()
+
+	cfgs, r, more, err := ctrl.Range(ctx, "prod", "db.", "", 3, 0)
+	if err != nil {
+		t.Fatalf("range fail: %v", err)
+	}
+	expected := []struct{ name, value, env string }{
+		{"db.key1", "1", ""}, {"db.key2", "22", "prod"}, {"db.key3", "33", "prod"}}
+	if r != rev || !more || len(cfgs) != len(expected) {
+		t.Fatalf("unexpected range result: %+v, rev: %d, more: %v", cfgs, r, more)
+	}
+	for i, e := range expected {
+		if cfgs[i].Name != e.name || cfgs[i].Value != e.value || cfgs[i].Env != e.env {
+			t.Errorf("unexpected config[%d]: %+v", i, cfgs[i])
+		}
+	}
+
+	cfgs, _, more, err = ctrl.Range(ctx, "prod", utils.NextRangeFromKey("db.key3"), "", 3, r)
+	if err != nil {
+		t.Fatalf("range fail: %v", err)
+	}
+	if more || len(cfgs) != 2 || cfgs[0].Name != "db.key4" || cfgs[1].Value != "55" {
+		t.Errorf("unexpected range result: %+v, more: %v", cfgs, more)
+	}
+
+	items, _, err := ctrl.resolveRange(ctx, "prod", "db.", "db.")
+	if err != nil {
+		t.Fatalf("resolve range fail: %v", err)
+	}
+	if len(items) != 5 || items[1].Value != "22" || items[1].Env != "prod" || items[3].Env != "" {
+		t.Errorf("unexpected resolve range result: %+v", items)
+	}
+}
+
+func TestParseLayerKey(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	cases := []struct {
+		key, env, name string
+		ok             bool
+	}{
+		{ctrl.configKey("db.host"), "", "db.host", true},
+		{ctrl.envConfigKey("prod", "db.host"), "prod", "db.host", true},
+		{ctrl.config.KeyPrefix + "-envs/prod", "", "", false},
+		{ctrl.config.KeyPrefix + "-other/db.host", "", "", false},
+	}
+	for _, c := range cases {
+		env, name, ok := ctrl.parseLayerKey(c.key)
+		if env != c.env || name != c.name || ok != c.ok {
+			t.Errorf("parse %s, expect (%q, %q, %v), got (%q, %q, %v)", c.key, c.env, c.name, c.ok, env, name, ok)
+		}
+	}
+}
+
+func TestWatchEnvShadowed(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	rev := putLayers(t, ctrl, map[string]string{"db.host": "base", "db.port": "3306", "db.host@prod": "prod"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type result struct {
+		cfg *ConfigItem
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		cfg, _, err := ctrl.Watch(ctx, 0, "", "prod", "db.host", rev+1)
+		done <- result{cfg, err}
+	}()
+	multiDone := make(chan *ConfigChanges)
+	go func() { multiDone <- watchMulti(t, ctrl, "prod", nil, "db.", rev+1, nil) }()
+
+	// base layer change shadowed by env layer is skipped
+	putLayers(t, ctrl, map[string]string{"db.host": "base2"})
+	putLayers(t, ctrl, map[string]string{"db.host@prod": "prod2"})
+	if r := <-done; r.err != nil || r.cfg.Value != "prod2" || r.cfg.Env != "prod" {
+		t.Errorf("unexpected watch result: %+v, %v", r.cfg, r.err)
+	}
+	if values := configValues(<-multiDone); len(values) != 1 || values["db.host"] != "prod2" {
+		t.Errorf("unexpected watch multi result: %v", values)
+	}
+
+	// env layer deleted, falls back to base layer
+	rev = putLayers(t, ctrl, map[string]string{"db.host@prod": ""})
+	changes := watchMulti(t, ctrl, "prod", []string{"db.host", "db.port"}, "", rev, nil)
+	if len(changes.Configs) != 1 || changes.Configs[0].Value != "base2" || changes.Configs[0].Env != "" {
+		t.Errorf("unexpected watch multi result: %+v", changes.Configs)
+	}
+}
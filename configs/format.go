@@ -0,0 +1,488 @@
+package configs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// FormatJSON json format
+	FormatJSON = "json"
+	// FormatYAML yaml format
+	FormatYAML = "yaml"
+	// FormatProperties java properties format
+	FormatProperties = "properties"
+	// FormatTOML toml format
+	FormatTOML = "toml"
+)
+
+func checkFormat(format string) error {
+	switch format {
+	case "", FormatJSON, FormatYAML, FormatProperties, FormatTOML:
+		return nil
+	}
+	return utils.Errorf(utils.EcodeInvalidFormat, "unknown format: %s", format)
+}
+
+// checkValueFormat check value is valid in format
+func checkValueFormat(format, value string) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+	if format == "" {
+		return nil
+	}
+	if _, err := parseValue(format, value); err != nil {
+		return utils.Errorf(utils.EcodeInvalidValue, "invalid %s value: %v", format, err)
+	}
+	return nil
+}
+
+// ConvertValue convert value in format from to format to, select subtree by path(dotted) if not empty;
+// scalar subtree is returned as plain string
+func ConvertValue(from, to, value, path string) (string, error) {
+	if err := checkFormat(to); err != nil {
+		return "", err
+	}
+	if from == to && path == "" {
+		return value, nil
+	}
+	v, err := parseValue(from, value)
+	if err != nil {
+		return "", utils.Errorf(utils.EcodeInvalidValue, "invalid %s value: %v", from, err)
+	}
+	if path != "" {
+		if v, err = subtree(v, path); err != nil {
+			return "", err
+		}
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+		case nil:
+			return "", nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+	}
+	result, err := formatValue(to, v)
+	if err != nil {
+		return "", utils.Errorf(utils.EcodeInvalidFormat, "convert to %s fail: %v", to, err)
+	}
+	return result, nil
+}
+
+// Convert convert config value to format(source format if empty), select subtree by path if not empty;
+// value of config without format is taken as in format
+func (ctrl *ConfigCtrl) Convert(cfg *ConfigItem, format, path string) error {
+	from, err := ctrl.sourceFormat(cfg)
+	if err != nil {
+		return err
+	}
+	if from == "" {
+		if format == "" {
+			return utils.Errorf(utils.EcodeInvalidFormat, "config(%s) has no format", cfg.Name)
+		}
+		if path == "" {
+			if err := checkValueFormat(format, cfg.Value); err != nil {
+				return err
+			}
+		}
+		from = format
+	} else if format == "" {
+		format = from
+	}
+	value, err := ConvertValue(from, format, cfg.Value, path)
+	if err != nil {
+		return err
+	}
+	cfg.Value = value
+	cfg.Format = format
+	return nil
+}
+
+type formatMark struct {
+	modRevision int64
+	format      string
+}
+
+// sourceFormat format of config's source layer, loaded from db once per mod revision
+func (ctrl *ConfigCtrl) sourceFormat(cfg *ConfigItem) (string, error) {
+	if cfg.srcFormat != nil {
+		return *cfg.srcFormat, nil
+	}
+	key := ctrl.layerKey(cfg.Env, cfg.Name)
+	if v, ok := ctrl.formats.Load(key); ok {
+		if mark := v.(formatMark); mark.modRevision == cfg.modRevision {
+			return mark.format, nil
+		}
+	}
+	item, err := GetDBConfig(ctrl.db, cfg.Env, cfg.Name)
+	if err != nil {
+		glog.Errorf("get db config(%s@%s) fail: %v", cfg.Name, cfg.Env, err)
+		return "", utils.NewSystemError("get config format fail")
+	}
+	if item == nil {
+		return "", nil
+	}
+	// db is written after etcd, cached only if it has caught up
+	if cfg.modRevision > 0 && item.Value == cfg.Value {
+		ctrl.formats.Store(key, formatMark{modRevision: cfg.modRevision, format: item.Format})
+	}
+	return item.Format, nil
+}
+
+// formatChanged cache format of put, kept format is loaded on next convert
+func (ctrl *ConfigCtrl) formatChanged(h *ConfigHistory, format string) {
+	key := ctrl.layerKey(h.Env, h.Name)
+	if format == "" {
+		ctrl.formats.Delete(key)
+		return
+	}
+	ctrl.formats.Store(key, formatMark{modRevision: h.Revision, format: format})
+}
+
+func parseValue(format, value string) (interface{}, error) {
+	var v interface{}
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			return nil, err
+		}
+	case FormatYAML:
+		if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		m := make(map[string]interface{})
+		if _, err := toml.Decode(value, &m); err != nil {
+			return nil, err
+		}
+		v = m
+	case FormatProperties:
+		props, err := parseProperties(value)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = unflatten(props); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	return normalize(v)
+}
+
+func formatValue(format string, v interface{}) (string, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case FormatYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case FormatTOML:
+		if _, ok := v.(map[string]interface{}); !ok {
+			return "", fmt.Errorf("toml value must be a table")
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	case FormatProperties:
+		props := make(map[string]string)
+		flatten("", v, props)
+		return formatProperties(props), nil
+	}
+	return "", fmt.Errorf("unknown format: %s", format)
+}
+
+// normalize convert yaml maps to string keyed maps and json numbers to int64/float64
+func normalize(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = n
+		}
+		return m, nil
+	case map[string]interface{}:
+		for k, item := range val {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			val[k] = n
+		}
+		return val, nil
+	case []interface{}:
+		for i, item := range val {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			val[i] = n
+		}
+		return val, nil
+	case []map[string]interface{}:
+		items := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, n)
+		}
+		return items, nil
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n, nil
+		}
+		return val.Float64()
+	}
+	return v, nil
+}
+
+func subtree(v interface{}, path string) (interface{}, error) {
+	for _, part := range strings.Split(path, ".") {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			item, ok := val[part]
+			if !ok {
+				return nil, utils.Errorf(utils.EcodeNotFound, "path not found: %s", path)
+			}
+			v = item
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil, utils.Errorf(utils.EcodeNotFound, "path not found: %s", path)
+			}
+			v = val[i]
+		default:
+			return nil, utils.Errorf(utils.EcodeNotFound, "path not found: %s", path)
+		}
+	}
+	return v, nil
+}
+
+func flatten(prefix string, v interface{}, props map[string]string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flatten(key, item, props)
+		}
+	case []interface{}:
+		for i, item := range val {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), item, props)
+		}
+	case nil:
+		props[prefix] = ""
+	default:
+		props[prefix] = fmt.Sprint(val)
+	}
+}
+
+func unflatten(props map[string]string) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	root := make(map[string]interface{})
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		m := root
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				if _, ok := m[part]; ok {
+					return nil, fmt.Errorf("conflict key: %s", key)
+				}
+				m[part] = props[key]
+				break
+			}
+			child, ok := m[part]
+			if !ok {
+				child = make(map[string]interface{})
+				m[part] = child
+			}
+			if m, ok = child.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("conflict key: %s", key)
+			}
+		}
+	}
+	return root, nil
+}
+
+func parseProperties(value string) (map[string]string, error) {
+	props := make(map[string]string)
+	add := func(line string) error {
+		key, val := splitProperty(line)
+		k, err := unescapeProperty(key)
+		if err != nil {
+			return err
+		}
+		v, err := unescapeProperty(val)
+		if err != nil {
+			return err
+		}
+		props[k] = v
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(value))
+	var logical string
+	for scanner.Scan() {
+		line := strings.TrimLeftFunc(scanner.Text(), unicode.IsSpace)
+		if logical == "" && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		// odd trailing backslashes continue the line
+		n := len(line) - len(strings.TrimRight(line, `\`))
+		if n%2 == 1 {
+			logical += line[:len(line)-1]
+			continue
+		}
+		if err := add(logical + line); err != nil {
+			return nil, err
+		}
+		logical = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if logical != "" {
+		if err := add(logical); err != nil {
+			return nil, err
+		}
+	}
+	return props, nil
+}
+
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeftFunc(line[i+1:], unicode.IsSpace)
+		case ' ', '\t', '\f':
+			rest := strings.TrimLeftFunc(line[i:], unicode.IsSpace)
+			if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+				rest = strings.TrimLeftFunc(rest[1:], unicode.IsSpace)
+			}
+			return line[:i], rest
+		}
+	}
+	return line, ""
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			buf.WriteByte('\t')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("invalid unicode escape: %s", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape: %s", s)
+			}
+			buf.WriteRune(rune(r))
+			i += 4
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String(), nil
+}
+
+func escapeProperty(s string, isKey bool) string {
+	var buf strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			if isKey || i == 0 {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				buf.WriteRune('\\')
+			}
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+func formatProperties(props map[string]string) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	for _, k := range keys {
+		buf.WriteString(escapeProperty(k, true))
+		buf.WriteByte('=')
+		buf.WriteString(escapeProperty(props[k], false))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
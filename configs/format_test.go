@@ -0,0 +1,110 @@
+package configs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+func TestConvertValue(t *testing.T) {
+	yamlValue := "db:\n  host: localhost\n  pool:\n    size: 10\n"
+	cases := []struct {
+		from, to, value, path, expected string
+	}{
+		{FormatYAML, FormatProperties, yamlValue, "", "db.host=localhost\ndb.pool.size=10\n"},
+		{FormatYAML, FormatJSON, yamlValue, "db.pool", "{\n  \"size\": 10\n}"},
+		{FormatYAML, FormatJSON, yamlValue, "db.host", "localhost"},
+		{FormatProperties, FormatYAML, "a.b = 1\na.c:x\\\n  y\n", "", "a:\n  b: \"1\"\n  c: xy\n"},
+		{FormatJSON, FormatTOML, `{"db": {"port": 3306}}`, "", "[db]\n  port = 3306\n"},
+		{FormatTOML, FormatJSON, "[db]\nport = 3306\n", "db", "{\n  \"port\": 3306\n}"},
+	}
+	for _, c := range cases {
+		v, err := ConvertValue(c.from, c.to, c.value, c.path)
+		if err != nil {
+			t.Errorf("convert %s -> %s fail: %v", c.from, c.to, err)
+		} else if v != c.expected {
+			t.Errorf("convert %s -> %s, expect %q, got %q", c.from, c.to, c.expected, v)
+		}
+	}
+}
+
+func TestConvertInvalid(t *testing.T) {
+	if _, err := ConvertValue(FormatProperties, FormatJSON, "a=1\na.b=2\n", ""); err == nil {
+		t.Errorf("expect conflict error")
+	}
+	if _, err := ConvertValue(FormatJSON, "xml", "{}", ""); err == nil {
+		t.Errorf("expect unknown format error")
+	}
+	if _, err := ConvertValue(FormatJSON, FormatYAML, `{"a": 1}`, "b"); err == nil {
+		t.Errorf("expect path not found error")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	putLayers(t, ctrl, map[string]string{"db.pool": `{"size": 10}`, "db.user": "root"})
+	ctx := context.Background()
+	get := func(name string) *ConfigItem {
+		cfg, _, err := ctrl.get(ctx, "", name)
+		if err != nil {
+			t.Fatalf("get config fail: %v", err)
+		}
+		return cfg
+	}
+	expectFormat := func(name, format, value string) {
+		now := time.Now()
+		mock.ExpectQuery(`select \* from configs where`).WithArgs(ConfigStatusOk, name, "").WillReturnRows(
+			sqlmock.NewRows(dbConfigColumns).AddRow(1, ConfigStatusOk, "", format, name, "", value, now, now))
+	}
+
+	// format is loaded once per revision
+	expectFormat("db.pool", FormatJSON, `{"size": 10}`)
+	for i := 0; i < 2; i++ {
+		cfg := get("db.pool")
+		if err := ctrl.Convert(cfg, FormatYAML, ""); err != nil || cfg.Value != "size: 10\n" || cfg.Format != FormatYAML {
+			t.Fatalf("unexpected converted config: %+v, %v", cfg, err)
+		}
+	}
+	cfg := get("db.pool")
+	if err := ctrl.Convert(cfg, "", "size"); err != nil || cfg.Value != "10" {
+		t.Errorf("unexpected subtree: %+v, %v", cfg, err)
+	}
+
+	// db not caught up with etcd yet, not cached
+	rev := putLayers(t, ctrl, map[string]string{"db.pool": `{"size": 20}`})
+	expectFormat("db.pool", FormatJSON, `{"size": 10}`)
+	expectFormat("db.pool", FormatJSON, `{"size": 20}`)
+	for i := 0; i < 3; i++ {
+		if cfg := get("db.pool"); ctrl.Convert(cfg, "", "size") != nil || cfg.Value != "20" {
+			t.Errorf("unexpected subtree: %+v", cfg)
+		}
+	}
+	if v, ok := ctrl.formats.Load(ctrl.layerKey("", "db.pool")); !ok || v.(formatMark).modRevision != rev {
+		t.Errorf("unexpected format mark: %+v", v)
+	}
+
+	// config without format is taken as in requested format
+	expectFormat("db.user", "", "root")
+	cfg = get("db.user")
+	if err := ctrl.Convert(cfg, "", ""); errCode(err) != utils.EcodeInvalidFormat {
+		t.Errorf("expect invalid format, got %v", err)
+	}
+	cfg = get("db.pool")
+	ctrl.formats.Store(ctrl.layerKey("", "db.pool"), formatMark{modRevision: rev})
+	if err := ctrl.Convert(cfg, FormatJSON, ""); err != nil || cfg.Value != `{"size": 20}` {
+		t.Errorf("expect value unchanged, got %+v, %v", cfg, err)
+	}
+	cfg = get("db.pool")
+	if err := ctrl.Convert(cfg, FormatJSON, "size"); err != nil || cfg.Value != "20" {
+		t.Errorf("unexpected subtree: %+v, %v", cfg, err)
+	}
+	cfg = get("db.user")
+	if err := ctrl.Convert(cfg, FormatJSON, ""); errCode(err) != utils.EcodeInvalidValue {
+		t.Errorf("expect invalid value, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
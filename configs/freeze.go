@@ -0,0 +1,202 @@
+package configs
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// ConfigFreeze config freeze window table, changes of configs with prefix are rejected in [start, end)
+type ConfigFreeze struct {
+	ID         int64     `json:"id"`
+	Prefix     string    `json:"prefix"`
+	Reason     string    `json:"reason"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	AppID      int64     `json:"app_id"`
+	CreateTime time.Time `json:"create_time"`
+}
+
+// Active is freeze window active at t
+func (freeze *ConfigFreeze) Active(t time.Time) bool {
+	return !t.Before(freeze.StartTime) && t.Before(freeze.EndTime)
+}
+
+// InsertConfigFreeze insert config freeze
+func InsertConfigFreeze(db *sql.DB, freeze *ConfigFreeze) error {
+	id, err := dbutil.Insert(db,
+		`insert into config_freezes(prefix, reason, start_time, end_time, app_id) values(?, ?, ?, ?, ?)`,
+		freeze.Prefix, freeze.Reason, freeze.StartTime, freeze.EndTime, freeze.AppID)
+	if err != nil {
+		return err
+	}
+	freeze.ID = id
+	return nil
+}
+
+// GetConfigFreeze get config freeze
+func GetConfigFreeze(db *sql.DB, id int64) (*ConfigFreeze, error) {
+	var freeze ConfigFreeze
+	if err := dbutil.Query(db, &freeze, `select * from config_freezes where id=?`, id); err == nil {
+		return &freeze, nil
+	} else if err == sql.ErrNoRows {
+		return nil, nil
+	} else {
+		return nil, err
+	}
+}
+
+// ListConfigFreezes list config freezes not ended at t
+func ListConfigFreezes(db *sql.DB, t time.Time) ([]ConfigFreeze, error) {
+	var freezes []ConfigFreeze
+	if err := dbutil.Query(db, &freezes, `select * from config_freezes where end_time>? order by start_time`, t); err != nil {
+		return nil, err
+	}
+	return freezes, nil
+}
+
+// DeleteConfigFreeze delete config freeze
+func DeleteConfigFreeze(db *sql.DB, id int64) error {
+	_, err := dbutil.Update(db, `delete from config_freezes where id=?`, id)
+	return err
+}
+
+// freezeCache freezes not ended at load time, nil until loaded by RunFreezeWatcher
+type freezeCache struct {
+	sync.RWMutex
+	freezes []ConfigFreeze
+}
+
+func (ctrl *ConfigCtrl) freezesKey() string {
+	return ctrl.config.KeyPrefix + "-freezes"
+}
+
+// reloadFreezes reload freeze cache, the previous one is kept on failure
+func (ctrl *ConfigCtrl) reloadFreezes() error {
+	freezes, err := ListConfigFreezes(ctrl.db, time.Now())
+	if err != nil {
+		return err
+	}
+	if freezes == nil {
+		freezes = make([]ConfigFreeze, 0)
+	}
+	ctrl.freezes.Lock()
+	defer ctrl.freezes.Unlock()
+	ctrl.freezes.freezes = freezes
+	return nil
+}
+
+// freezesChanged reload local freeze cache & notify others
+func (ctrl *ConfigCtrl) freezesChanged(reason string) {
+	if err := ctrl.reloadFreezes(); err != nil {
+		glog.Warningf("reload freezes fail: %v", err)
+	}
+	if _, err := ctrl.etcdClient.Put(context.Background(), ctrl.freezesKey(), reason); err != nil {
+		glog.Warningf("notify freezes change(%s) fail: %v", reason, err)
+	}
+}
+
+// activeFreezes freezes not ended at t, from freeze cache if loaded
+func (ctrl *ConfigCtrl) activeFreezes(t time.Time) ([]ConfigFreeze, error) {
+	ctrl.freezes.RLock()
+	freezes := ctrl.freezes.freezes
+	ctrl.freezes.RUnlock()
+	if freezes != nil {
+		return freezes, nil
+	}
+	return ListConfigFreezes(ctrl.db, t)
+}
+
+// RunFreezeWatcher load freeze cache, then reload on changes & periodically;
+// freeze checks query db directly until loaded
+func (ctrl *ConfigCtrl) RunFreezeWatcher() {
+	if err := ctrl.reloadFreezes(); err != nil {
+		glog.Errorf("load freezes fail: %v", err)
+	}
+	utils.RunReloader(ctrl.etcdClient, "freezes", ctrl.freezesKey(), ctrl.config.FreezeRefreshInterval, ctrl.reloadFreezes)
+}
+
+// AddFreeze add config freeze window
+func (ctrl *ConfigCtrl) AddFreeze(freeze *ConfigFreeze) error {
+	if err := checkNamePrefix(freeze.Prefix); err != nil {
+		return err
+	}
+	if !freeze.EndTime.After(freeze.StartTime) {
+		return utils.Errorf(utils.EcodeInvalidParam, "end time should be after start time")
+	}
+	if err := InsertConfigFreeze(ctrl.db, freeze); err != nil {
+		glog.Errorf("insert config freeze(%s) fail: %v", freeze.Prefix, err)
+		return utils.NewSystemError("create freeze fail")
+	}
+	ctrl.freezesChanged("add " + freeze.Prefix)
+	return nil
+}
+
+// GetFreeze get config freeze window
+func (ctrl *ConfigCtrl) GetFreeze(id int64) (*ConfigFreeze, error) {
+	freeze, err := GetConfigFreeze(ctrl.db, id)
+	if err != nil {
+		glog.Errorf("get config freeze(%d) fail: %v", id, err)
+		return nil, utils.NewSystemError("get freeze fail")
+	}
+	if freeze == nil {
+		return nil, utils.Errorf(utils.EcodeNotFound, "no such freeze: %d", id)
+	}
+	return freeze, nil
+}
+
+// ListFreezes list current and upcoming config freeze windows
+func (ctrl *ConfigCtrl) ListFreezes() ([]ConfigFreeze, error) {
+	freezes, err := ListConfigFreezes(ctrl.db, time.Now())
+	if err != nil {
+		glog.Errorf("list config freezes fail: %v", err)
+		return nil, utils.NewSystemError("list freezes fail")
+	}
+	if freezes == nil {
+		freezes = make([]ConfigFreeze, 0)
+	}
+	return freezes, nil
+}
+
+// DeleteFreeze delete config freeze window
+func (ctrl *ConfigCtrl) DeleteFreeze(id int64) error {
+	if err := DeleteConfigFreeze(ctrl.db, id); err != nil {
+		if err == dbutil.ZeroEffected {
+			return utils.Errorf(utils.EcodeNotFound, "no such freeze: %d", id)
+		}
+		glog.Errorf("delete config freeze(%d) fail: %v", id, err)
+		return utils.NewSystemError("delete freeze fail")
+	}
+	ctrl.freezesChanged("delete " + strconv.FormatInt(id, 10))
+	return nil
+}
+
+// checkFrozen check config is not in any freeze window,
+// returns the overridden freeze id if override
+func (ctrl *ConfigCtrl) checkFrozen(name string, override bool) (int64, error) {
+	now := time.Now()
+	freezes, err := ctrl.activeFreezes(now)
+	if err != nil {
+		glog.Errorf("list config freezes fail: %v", err)
+		return 0, utils.NewSystemError("check freeze fail")
+	}
+	for _, freeze := range freezes {
+		if !freeze.Active(now) || !strings.HasPrefix(name, freeze.Prefix) {
+			continue
+		}
+		if !override {
+			return 0, utils.Errorf(utils.EcodeConfigFrozen, "config(%s) is frozen until %s: %s",
+				name, freeze.EndTime.Format(time.RFC3339), freeze.Reason)
+		}
+		glog.Warningf("config(%s) change overrides freeze(%d)", name, freeze.ID)
+		return freeze.ID, nil
+	}
+	return 0, nil
+}
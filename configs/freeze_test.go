@@ -0,0 +1,111 @@
+package configs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+var freezeColumns = []string{"id", "prefix", "reason", "start_time", "end_time", "app_id", "create_time"}
+
+func TestCheckFrozen(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	now := time.Now()
+
+	// queried from db until freeze cache loaded
+	mock.ExpectQuery(`select \* from config_freezes where end_time>\?`).WillReturnRows(
+		sqlmock.NewRows(freezeColumns).
+			AddRow(1, "mq.", "upcoming", now.Add(time.Hour), now.Add(2*time.Hour), 3, now).
+			AddRow(2, "db.", "release", now.Add(-time.Hour), now.Add(time.Hour), 3, now))
+	if err := ctrl.reloadFreezes(); err != nil {
+		t.Fatalf("reload freezes fail: %v", err)
+	} else if len(ctrl.freezes.freezes) != 2 {
+		t.Errorf("unexpected freeze cache: %+v", ctrl.freezes.freezes)
+	}
+	mock.ExpectQuery(`select \* from config_freezes where end_time>\?`).WillReturnRows(sqlmock.NewRows(freezeColumns))
+	ctrl.freezes.freezes = nil
+	if id, err := ctrl.checkFrozen("db.host", false); err != nil || id != 0 {
+		t.Errorf("expect not frozen, got %d: %v", id, err)
+	}
+	checkMockDB(t, mock)
+	ctrl.freezes.freezes = []ConfigFreeze{
+		{ID: 1, Prefix: "mq.", StartTime: now.Add(time.Hour), EndTime: now.Add(2 * time.Hour)},
+		{ID: 2, Prefix: "db.", StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour)}}
+
+	if _, err := ctrl.checkFrozen("db.host", false); errCode(err) != utils.EcodeConfigFrozen {
+		t.Errorf("expect frozen, got %v", err)
+	}
+	if id, err := ctrl.checkFrozen("db.host", true); err != nil || id != 2 {
+		t.Errorf("expect override freeze 2, got %d: %v", id, err)
+	}
+	if id, err := ctrl.checkFrozen("mq.topic", false); err != nil || id != 0 {
+		t.Errorf("expect upcoming freeze inactive, got %d: %v", id, err)
+	}
+}
+
+func TestPutDeleteFrozen(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	now := time.Now()
+	ctrl.freezes.freezes = []ConfigFreeze{{ID: 2, Prefix: "db.", StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour)}}
+	ctx := context.Background()
+
+	if _, err := ctrl.Put(ctx, "", "", "", "db.host", 3, "", "a", -1, false); errCode(err) != utils.EcodeConfigFrozen {
+		t.Errorf("expect frozen, got %v", err)
+	}
+	if err := ctrl.Delete(ctx, "", "db.host", 3, "", false); errCode(err) != utils.EcodeConfigFrozen {
+		t.Errorf("expect frozen, got %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`insert into configs`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`insert into config_histories`).WithArgs(nil, "db.host", "", int64(3), int64(0),
+		"hotfix", "a", sqlmock.AnyArg(), int64(2)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if _, err := ctrl.Put(ctx, "", "", "", "db.host", 3, "hotfix", "a", -1, true); err != nil {
+		t.Errorf("put with override fail: %v", err)
+	}
+
+	// deletion is always recorded in history
+	mock.ExpectBegin()
+	mock.ExpectExec(`update configs set status=\?`).WithArgs(ConfigStatusDeleted, "mq.topic", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert into config_histories`).WithArgs(nil, "mq.topic", "", int64(3), int64(0),
+		"cleanup", "", sqlmock.AnyArg(), int64(0)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := ctrl.Delete(ctx, "", "mq.topic", 3, "cleanup", false); err != nil {
+		t.Errorf("delete fail: %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestFreezesChanged(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	now := time.Now()
+
+	mock.ExpectExec(`insert into config_freezes`).WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectQuery(`select \* from config_freezes where end_time>\?`).WillReturnRows(
+		sqlmock.NewRows(freezeColumns).AddRow(9, "db.", "release", now, now.Add(time.Hour), 3, now))
+	freeze := ConfigFreeze{Prefix: "db.", Reason: "release", StartTime: now, EndTime: now.Add(time.Hour), AppID: 3}
+	if err := ctrl.AddFreeze(&freeze); err != nil {
+		t.Fatalf("add freeze fail: %v", err)
+	}
+	if len(ctrl.freezes.freezes) != 1 || ctrl.freezes.freezes[0].ID != 9 {
+		t.Errorf("freeze cache not reloaded: %+v", ctrl.freezes.freezes)
+	}
+	resp, err := ctrl.etcdClient.Get(context.Background(), ctrl.freezesKey())
+	if err != nil || len(resp.Kvs) != 1 {
+		t.Errorf("freezes change not notified: %v", err)
+	}
+
+	bad := ConfigFreeze{Prefix: "db.", StartTime: now, EndTime: now}
+	if err := ctrl.AddFreeze(&bad); errCode(err) != utils.EcodeInvalidParam {
+		t.Errorf("expect invalid param, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
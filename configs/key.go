@@ -3,7 +3,9 @@ package configs
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
+	"github.com/golang/glog"
 	"github.com/infrmods/xbus/utils"
 )
 
@@ -16,7 +18,18 @@ func checkName(name string) error {
 	return nil
 }
 
-var rValidNamePrefix = regexp.MustCompile(`(?i)^[a-z][a-z0-9_.-]?$`)
+// CheckConfig check name & value in format(unchecked if empty) of config to put
+func CheckConfig(format, name, value string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if value == "" {
+		return utils.NewError(utils.EcodeInvalidValue, "empty value")
+	}
+	return checkValueFormat(format, value)
+}
+
+var rValidNamePrefix = regexp.MustCompile(`(?i)^[a-z][a-z0-9_.-]*$`)
 
 func checkNamePrefix(name string) error {
 	if name != "" {
@@ -27,10 +40,65 @@ func checkNamePrefix(name string) error {
 	return nil
 }
 
+func checkEnv(env string) error {
+	if env != "" && !utils.IsValidEnv(env) {
+		return utils.NewError(utils.EcodeInvalidEnv, "")
+	}
+	return nil
+}
+
 func (ctrl *ConfigCtrl) configKey(name string) string {
 	return fmt.Sprintf("%s/%s", ctrl.config.KeyPrefix, name)
 }
 
+func (ctrl *ConfigCtrl) envConfigKey(env, name string) string {
+	return fmt.Sprintf("%s-envs/%s/%s", ctrl.config.KeyPrefix, env, name)
+}
+
+func (ctrl *ConfigCtrl) envsKeyPrefix() string {
+	return ctrl.config.KeyPrefix + "-envs/"
+}
+
+func (ctrl *ConfigCtrl) layerKey(env, name string) string {
+	if env == "" {
+		return ctrl.configKey(name)
+	}
+	return ctrl.envConfigKey(env, name)
+}
+
+func (ctrl *ConfigCtrl) layerName(env, key string) string {
+	if env != "" {
+		prefix := fmt.Sprintf("%s-envs/%s/", ctrl.config.KeyPrefix, env)
+		if strings.HasPrefix(key, prefix) {
+			return key[len(prefix):]
+		}
+	}
+	return ctrl.configName(key)
+}
+
+func (ctrl *ConfigCtrl) configName(key string) string {
+	prefix := ctrl.config.KeyPrefix + "/"
+	if strings.HasPrefix(key, prefix) {
+		return key[len(prefix):]
+	}
+	glog.Errorf("invalid config key: %s", key)
+	return ""
+}
+
+// parseLayerKey parse env & name from config layer key
+func (ctrl *ConfigCtrl) parseLayerKey(key string) (string, string, bool) {
+	if prefix := ctrl.config.KeyPrefix + "/"; strings.HasPrefix(key, prefix) {
+		return "", key[len(prefix):], true
+	}
+	if prefix := ctrl.envsKeyPrefix(); strings.HasPrefix(key, prefix) {
+		parts := strings.SplitN(key[len(prefix):], "/", 2)
+		if len(parts) == 2 {
+			return parts[0], parts[1], true
+		}
+	}
+	return "", "", false
+}
+
 func (ctrl *ConfigCtrl) endKey() string {
 	return utils.RangeEndKey(ctrl.config.KeyPrefix)
 }
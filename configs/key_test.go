@@ -0,0 +1,37 @@
+package configs
+
+import (
+	"testing"
+)
+
+func TestCheckNamePrefix(t *testing.T) {
+	for _, prefix := range []string{"", "d", "db", "db.common.", "db-x_1."} {
+		if err := checkNamePrefix(prefix); err != nil {
+			t.Errorf("prefix %q should be valid: %v", prefix, err)
+		}
+	}
+	for _, prefix := range []string{"1db", ".db", "db/x", "db common"} {
+		if err := checkNamePrefix(prefix); err == nil {
+			t.Errorf("prefix %q should be invalid", prefix)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	cases := []struct {
+		format, name, value string
+		valid               bool
+	}{
+		{"", "db.host", "localhost", true},
+		{FormatJSON, "db.pool", `{"size": 10}`, true},
+		{FormatJSON, "db.pool", `{"size": `, false},
+		{"", "db", "localhost", false},
+		{"", "db.host", "", false},
+		{"xml", "db.host", "<a/>", false},
+	}
+	for _, c := range cases {
+		if err := CheckConfig(c.format, c.name, c.value); (err == nil) != c.valid {
+			t.Errorf("check config(%s, %s, %q), expect valid: %v, got %v", c.format, c.name, c.value, c.valid, err)
+		}
+	}
+}
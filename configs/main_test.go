@@ -0,0 +1,82 @@
+package configs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/infrmods/xbus/utils"
+	"github.com/infrmods/xbus/utils/etcdtest"
+)
+
+var testEtcd *etcdtest.Server
+
+func TestMain(m *testing.M) {
+	server, err := etcdtest.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start embedded etcd fail: %v\n", err)
+		os.Exit(1)
+	}
+	testEtcd = server
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// newTestCtrl new config ctrl with key prefix of test name
+func newTestCtrl(t *testing.T, db *sql.DB) *ConfigCtrl {
+	config := Config{KeyPrefix: "/" + strings.Replace(t.Name(), "/", "_", -1),
+		ReadTimeout: 5 * time.Second, WebhookTimeout: time.Second,
+		WebhookMaxAttempts: 2, WebhookRetryInterval: 10 * time.Millisecond}
+	return NewConfigCtrl(&config, db, testEtcd.Client)
+}
+
+// putLayers put configs of layers in one revision, names are "name" or "name@env", empty value for deletion
+func putLayers(t *testing.T, ctrl *ConfigCtrl, values map[string]string) int64 {
+	ops := make([]clientv3.Op, 0, len(values))
+	for k, v := range values {
+		parts := strings.SplitN(k, "@", 2)
+		key := ctrl.configKey(parts[0])
+		if len(parts) == 2 {
+			key = ctrl.envConfigKey(parts[1], parts[0])
+		}
+		if v == "" {
+			ops = append(ops, clientv3.OpDelete(key))
+		} else {
+			ops = append(ops, clientv3.OpPut(key, v))
+		}
+	}
+	resp, err := ctrl.etcdClient.Txn(context.Background()).Then(ops...).Commit()
+	if err != nil {
+		t.Fatalf("put layers fail: %v", err)
+	}
+	return resp.Header.Revision
+}
+
+// newMockDB new sqlmock db
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("new sqlmock fail: %v", err)
+	}
+	return db, mock
+}
+
+func checkMockDB(t *testing.T, mock sqlmock.Sqlmock) {
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
+
+func errCode(err error) string {
+	if e, ok := err.(*utils.Error); ok {
+		return e.Code
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+	v3rpc "github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+// rRef matches references like ${db.common.host}, $${ is escaped as literal ${
+var rRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z][A-Za-z0-9_.-]*)\}`)
+
+const maxRefDepth = 16
+
+// refExpander expand references, referenced configs are read without recording app config states
+type refExpander struct {
+	ctrl   *ConfigCtrl
+	ctx    context.Context
+	env    string
+	filter NameFilter
+
+	values   map[string]string
+	refs     []string
+	revision int64
+}
+
+func (e *refExpander) expand(value string, path []string) (string, error) {
+	var rerr error
+	result := rRef.ReplaceAllStringFunc(value, func(m string) string {
+		if rerr != nil {
+			return m
+		}
+		if m == "$${" {
+			return "${"
+		}
+		ref := m[2 : len(m)-1]
+		v, err := e.expandRef(ref, path)
+		if err != nil {
+			rerr = err
+			return m
+		}
+		return v
+	})
+	if rerr != nil {
+		return "", rerr
+	}
+	return result, nil
+}
+
+func (e *refExpander) expandRef(ref string, path []string) (string, error) {
+	for _, name := range path {
+		if name == ref {
+			return "", utils.Errorf(utils.EcodeInvalidRef, "reference cycle: %s -> %s", strings.Join(path, " -> "), ref)
+		}
+	}
+	if len(path) >= maxRefDepth {
+		return "", utils.Errorf(utils.EcodeInvalidRef, "reference too deep: %s", strings.Join(path, " -> "))
+	}
+	if v, ok := e.values[ref]; ok {
+		return v, nil
+	}
+
+	if e.filter != nil {
+		if ok, err := e.filter(ref); err != nil {
+			return "", err
+		} else if !ok {
+			return "", utils.NewNotPermittedError(fmt.Sprintf("not permitted reference: %s", ref), []string{ref})
+		}
+	}
+	if err := checkName(ref); err != nil {
+		return "", utils.Errorf(utils.EcodeInvalidRef, "invalid reference name: %s", ref)
+	}
+	cfg, rev, err := e.ctrl.get(e.ctx, e.env, ref)
+	if err != nil {
+		if uerr, ok := err.(*utils.Error); ok && uerr.Code == utils.EcodeNotFound {
+			return "", utils.Errorf(utils.EcodeInvalidRef, "referenced config not found: %s", ref)
+		}
+		return "", err
+	}
+	e.refs = append(e.refs, ref)
+	if rev > e.revision {
+		e.revision = rev
+	}
+	v, err := e.expand(cfg.Value, append(path, ref))
+	if err != nil {
+		return "", err
+	}
+	e.values[ref] = v
+	return v, nil
+}
+
+// GetResolved get config with references expanded, filter checks referenced names
+func (ctrl *ConfigCtrl) GetResolved(ctx context.Context, appID int64, node, env, name string, filter NameFilter) (*ConfigItem, int64, error) {
+	cfg, rev, err := ctrl.Get(ctx, appID, node, env, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ctrl.expandRefs(ctx, env, cfg, rev, filter)
+}
+
+func (ctrl *ConfigCtrl) expandRefs(ctx context.Context, env string,
+	cfg *ConfigItem, rev int64, filter NameFilter) (*ConfigItem, int64, error) {
+	e := refExpander{ctrl: ctrl, ctx: ctx, env: env, filter: filter,
+		values: make(map[string]string), revision: rev}
+	value, err := e.expand(cfg.Value, []string{cfg.Name})
+	if err != nil {
+		return nil, 0, err
+	}
+	cfg.Value = value
+	cfg.Refs = e.refs
+	return cfg, e.revision, nil
+}
+
+// WatchResolved watch config with references expanded,
+// fires when the config or any config it references changes
+func (ctrl *ConfigCtrl) WatchResolved(ctx context.Context, appID int64, node, env, name string,
+	revision int64, filter NameFilter) (*ConfigItem, int64, error) {
+	if err := checkName(name); err != nil {
+		return nil, 0, err
+	}
+	if err := checkEnv(env); err != nil {
+		return nil, 0, err
+	}
+	if err := ctrl.waitRecovered(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	names := []string{name}
+	if cfg, rev, err := ctrl.GetResolved(ctx, 0, "", env, name, filter); err == nil {
+		names = append(names, cfg.Refs...)
+		if revision <= 0 {
+			revision = rev + 1
+		}
+	} else if e, ok := err.(*utils.Error); !ok || e.Code != utils.EcodeNotFound {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watcher := clientv3.NewWatcher(ctrl.etcdClient)
+	defer watcher.Close()
+	var opts []clientv3.OpOption
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+	// select on ctx & all watch channels, the number of channels is known until runtime
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+	for _, n := range names {
+		keys := []string{ctrl.configKey(n)}
+		if env != "" {
+			keys = append(keys, ctrl.envConfigKey(env, n))
+		}
+		for _, key := range keys {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv,
+				Chan: reflect.ValueOf(watcher.Watch(ctx, key, opts...))})
+		}
+	}
+
+	for {
+		i, v, ok := reflect.Select(cases)
+		if i == 0 {
+			return nil, 0, utils.CleanErr(ctx.Err(), "", "watch config(%s@%s) fail: %v", name, env, ctx.Err())
+		} else if !ok {
+			return nil, 0, utils.NewError(utils.EcodeEtcdWatchFailed, fmt.Sprintf("watch config(%s@%s) closed", name, env))
+		}
+		resp := v.Interface().(clientv3.WatchResponse)
+		if err := resp.Err(); err != nil {
+			if err == v3rpc.ErrCompacted {
+				glog.Warningf("config [%s@%s] with revision [%d] is compacted, call get instead", name, env, revision)
+				return ctrl.GetResolved(ctx, appID, node, env, name, filter)
+			}
+			return nil, 0, utils.CleanErr(err, "", "watch config(%s@%s) with revision(%d) fail: %v", name, env, revision, err)
+		}
+		if resp.Canceled {
+			return nil, resp.Header.Revision, utils.NewError(utils.EcodeEtcdWatchFailed, fmt.Sprintf("watch config(%s@%s) canceled", name, env))
+		}
+		if len(resp.Events) == 0 {
+			continue
+		}
+
+		cfg, rev, err := ctrl.GetResolved(ctx, appID, node, env, name, filter)
+		if err != nil {
+			if e, ok := err.(*utils.Error); ok && e.Code == utils.EcodeNotFound {
+				return nil, 0, utils.NewError(utils.EcodeDeleted, "")
+			}
+			return nil, 0, err
+		}
+		return cfg, rev, nil
+	}
+}
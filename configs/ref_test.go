@@ -0,0 +1,95 @@
+package configs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+func TestGetResolved(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	rev := putLayers(t, ctrl, map[string]string{
+		"db.host":      "127.0.0.1",
+		"db.port":      "3306",
+		"db.port@prod": "3307",
+		"db.addr":      "${db.host}:${db.port}",
+		"db.url":       "mysql://${db.addr}/${db.host}?x=$${y}"})
+	ctx := context.Background()
+
+	// only the requested config records app config state
+	mock.ExpectExec(`insert into app_config_states`).WithArgs(7, "node1", "db.url", 1, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	cfg, r, err := ctrl.GetResolved(ctx, 7, "node1", "", "db.url", nil)
+	if err != nil {
+		t.Fatalf("get resolved fail: %v", err)
+	}
+	if cfg.Value != "mysql://127.0.0.1:3306/127.0.0.1?x=${y}" || r != rev {
+		t.Errorf("unexpected resolved config: %+v, rev: %d", cfg, r)
+	}
+	if strings.Join(cfg.Refs, ",") != "db.addr,db.host,db.port" {
+		t.Errorf("unexpected refs: %v", cfg.Refs)
+	}
+
+	cfg, _, err = ctrl.GetResolved(ctx, 0, "", "prod", "db.addr", nil)
+	if err != nil || cfg.Value != "127.0.0.1:3307" {
+		t.Errorf("unexpected resolved env config: %+v, %v", cfg, err)
+	}
+
+	filter := func(name string) (bool, error) { return name != "db.port", nil }
+	if _, _, err := ctrl.GetResolved(ctx, 0, "", "", "db.url", filter); errCode(err) != utils.EcodeNotPermitted {
+		t.Errorf("expect not permitted, got %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestGetResolvedInvalid(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	putLayers(t, ctrl, map[string]string{
+		"loop.self": "${loop.self}",
+		"loop.keya": "a${loop.keyb}",
+		"loop.keyb": "b${loop.keyc}",
+		"loop.keyc": "c${loop.keya}",
+		"bad.short": "${a.b}",
+		"bad.nokey": "${bad.missing}"})
+	ctx := context.Background()
+	for _, name := range []string{"loop.self", "loop.keya", "loop.keyc", "bad.short", "bad.nokey"} {
+		_, _, err := ctrl.GetResolved(ctx, 0, "", "", name, nil)
+		if errCode(err) != utils.EcodeInvalidRef {
+			t.Errorf("expect invalid ref of %s, got %v", name, err)
+		}
+	}
+	if _, _, err := ctrl.GetResolved(ctx, 0, "", "", "loop.keya", nil); err == nil ||
+		!strings.Contains(err.Error(), "loop.keya -> loop.keyb -> loop.keyc -> loop.keya") {
+		t.Errorf("unexpected cycle error: %v", err)
+	}
+}
+
+func TestWatchResolved(t *testing.T) {
+	ctrl := newTestCtrl(t, nil)
+	rev := putLayers(t, ctrl, map[string]string{"db.host": "127.0.0.1", "db.addr": "${db.host}:3306"})
+	putLayers(t, ctrl, map[string]string{"db.other": "x"})
+	next := putLayers(t, ctrl, map[string]string{"db.host@prod": "10.0.0.1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cfg, r, err := ctrl.WatchResolved(ctx, 0, "", "prod", "db.addr", rev+1, nil)
+	if err != nil || cfg.Value != "10.0.0.1:3306" || r != next {
+		t.Fatalf("unexpected watched config: %+v, rev: %d, %v", cfg, r, err)
+	}
+
+	putLayers(t, ctrl, map[string]string{"db.host": ""})
+	if _, _, err := ctrl.WatchResolved(ctx, 0, "", "", "db.addr", next+1, nil); errCode(err) != utils.EcodeInvalidRef {
+		t.Errorf("expect invalid ref, got %v", err)
+	}
+
+	wctx, wcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer wcancel()
+	if _, _, err := ctrl.WatchResolved(wctx, 0, "", "prod", "db.addr", 0, nil); err == nil {
+		t.Errorf("expect watch timeout")
+	}
+}
@@ -0,0 +1,119 @@
+package configs
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+const (
+	// UnusedUnread configs with no reads in the last N days
+	UnusedUnread = "unread"
+	// UnusedOrphaned configs read only by apps that no longer exist
+	UnusedOrphaned = "orphaned"
+)
+
+// UnusedConfig unused config, reads are tracked by app_config_states(anonymous reads are not tracked)
+type UnusedConfig struct {
+	Tag          *string    `json:"tag"`
+	Name         string     `json:"name"`
+	Env          string     `json:"env"`
+	ModifyTime   time.Time  `json:"modify_time"`
+	LastReadTime *time.Time `json:"last_read_time"`
+}
+
+// unusedCondition where condition of unused configs(aliased as c),
+// recently modified configs are not considered unread
+func unusedCondition(typ string, days int) (string, []interface{}, error) {
+	switch typ {
+	case UnusedUnread:
+		if days <= 0 {
+			return "", nil, utils.Errorf(utils.EcodeInvalidParam, "invalid days: %d", days)
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+		return ` and c.modify_time<? and not exists (select 1 from app_config_states s
+                  where s.config_name=c.name and s.modify_time>=?)`, []interface{}{cutoff, cutoff}, nil
+	case UnusedOrphaned:
+		return ` and exists (select 1 from app_config_states s where s.config_name=c.name)
+                 and not exists (select 1 from app_config_states s join apps a on a.id=s.app_id
+                                 where s.config_name=c.name and a.status=?)`, []interface{}{utils.StatusOk}, nil
+	}
+	return "", nil, utils.Errorf(utils.EcodeInvalidParam, "invalid type: %s", typ)
+}
+
+// ListUnusedConfigs list unused db configs
+func ListUnusedConfigs(db *sql.DB, typ string, days int, prefix string, skip, limit int) ([]UnusedConfig, error) {
+	cond, condArgs, err := unusedCondition(typ, days)
+	if err != nil {
+		return nil, err
+	}
+	q := `select c.tag, c.name, c.env, c.modify_time,
+                 (select max(s.modify_time) from app_config_states s where s.config_name=c.name) as last_read_time
+          from configs c where c.status=?` + cond
+	args := append([]interface{}{ConfigStatusOk}, condArgs...)
+	if prefix != "" {
+		q += ` and c.name like ? escape '\\'`
+		args = append(args, utils.EscapeLike(prefix)+"%")
+	}
+	q += ` order by c.name, c.env limit ?,?`
+	args = append(args, skip, limit)
+
+	var items []UnusedConfig
+	if err := dbutil.Query(db, &items, q, args...); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func isConfigUnused(db *sql.DB, typ string, days int, env, name string) (bool, error) {
+	cond, condArgs, err := unusedCondition(typ, days)
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	args := append([]interface{}{ConfigStatusOk, name, env}, condArgs...)
+	if err := dbutil.Query(db, &count,
+		`select count(*) from configs c where c.status=? and c.name=? and c.env=?`+cond, args...); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListUnused list unused configs of type(unread/orphaned)
+func (ctrl *ConfigCtrl) ListUnused(typ string, days int, prefix string, skip, limit int) ([]UnusedConfig, error) {
+	if err := checkNamePrefix(prefix); err != nil {
+		return nil, err
+	}
+	items, err := ListUnusedConfigs(ctrl.db, typ, days, prefix, skip, limit)
+	if err != nil {
+		if _, ok := err.(*utils.Error); ok {
+			return nil, err
+		}
+		glog.Errorf("list unused configs fail: %v", err)
+		return nil, utils.NewSystemError("list unused configs fail")
+	}
+	if items == nil {
+		items = make([]UnusedConfig, 0)
+	}
+	return items, nil
+}
+
+// Archive soft delete config if it is still unused, db config & histories are kept
+func (ctrl *ConfigCtrl) Archive(ctx context.Context, typ string, days int, env, name string, appID int64, remark string) error {
+	unused, err := isConfigUnused(ctrl.db, typ, days, env, name)
+	if err != nil {
+		if _, ok := err.(*utils.Error); ok {
+			return err
+		}
+		glog.Errorf("check config(%s@%s) unused fail: %v", name, env, err)
+		return utils.NewSystemError("check config unused fail")
+	}
+	if !unused {
+		return utils.Errorf(utils.EcodeInvalidStatus, "config(%s@%s) is not %s", name, env, typ)
+	}
+	return ctrl.Delete(ctx, env, name, appID, remark, false)
+}
@@ -0,0 +1,115 @@
+package configs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/infrmods/xbus/utils"
+)
+
+func TestArchive(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.freezes.freezes = []ConfigFreeze{}
+	rev := putLayers(t, ctrl, map[string]string{"db.host": "a", "db.port": "3306"})
+	ctx := context.Background()
+
+	if err := ctrl.Archive(ctx, "unknown", 90, "", "db.host", 3, ""); errCode(err) != utils.EcodeInvalidParam {
+		t.Errorf("expect invalid param, got %v", err)
+	}
+	if err := ctrl.Archive(ctx, UnusedUnread, 0, "", "db.host", 3, ""); errCode(err) != utils.EcodeInvalidParam {
+		t.Errorf("expect invalid param, got %v", err)
+	}
+
+	mock.ExpectQuery(`select count\(\*\) from configs c where`).
+		WithArgs(ConfigStatusOk, "db.port", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	if err := ctrl.Archive(ctx, UnusedUnread, 90, "", "db.port", 3, ""); errCode(err) != utils.EcodeInvalidStatus {
+		t.Errorf("expect invalid status, got %v", err)
+	}
+
+	// archive is recorded in history like deletion
+	mock.ExpectQuery(`select count\(\*\) from configs c where`).
+		WithArgs(ConfigStatusOk, "db.host", "", utils.StatusOk).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`update configs set status=\?`).WithArgs(ConfigStatusDeleted, "db.host", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`insert into config_histories`).WithArgs(nil, "db.host", "", int64(3), int64(0),
+		"orphaned", "", rev+1, int64(0)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := ctrl.Archive(ctx, UnusedOrphaned, 0, "", "db.host", 3, "orphaned"); err != nil {
+		t.Fatalf("archive fail: %v", err)
+	}
+	if cfg, err := ctrl.GetLayer(ctx, "", "db.host"); err != nil || cfg != nil {
+		t.Errorf("expect archived config deleted, got %+v, %v", cfg, err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestChangeAppConfigState(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.config.StateRefreshInterval = time.Hour
+	expectState := func(version int64) {
+		mock.ExpectExec(`insert into app_config_states`).WithArgs(3, "node1", "db.host", version, version).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	// anonymous reads are not tracked
+	if err := ctrl.changeAppConfigState(0, "", "db.host", 1); err != nil {
+		t.Fatalf("change state fail: %v", err)
+	}
+
+	expectState(1)
+	expectState(2)
+	expectState(2)
+	for _, version := range []int64{1, 1, 2, 2} {
+		if err := ctrl.changeAppConfigState(3, "node1", "db.host", version); err != nil {
+			t.Fatalf("change state fail: %v", err)
+		}
+	}
+	key := appConfigStateKey{appID: 3, appNode: "node1", configName: "db.host"}
+	ctrl.states.Store(key, appConfigStateMark{version: 2, writeTime: time.Now().Add(-2 * time.Hour)})
+	if err := ctrl.changeAppConfigState(3, "node1", "db.host", 2); err != nil {
+		t.Fatalf("change state fail: %v", err)
+	}
+
+	// failed writes are retried on next read
+	mock.ExpectExec(`insert into app_config_states`).WillReturnError(sqlmock.ErrCancelled)
+	expectState(3)
+	if err := ctrl.changeAppConfigState(3, "node1", "db.host", 3); errCode(err) != utils.EcodeSystemError {
+		t.Errorf("expect system error, got %v", err)
+	}
+	if err := ctrl.changeAppConfigState(3, "node1", "db.host", 3); err != nil {
+		t.Fatalf("change state fail: %v", err)
+	}
+
+	// marks out of refresh interval are swept
+	other := appConfigStateKey{appID: 3, appNode: "node2", configName: "db.host"}
+	ctrl.states.Store(other, appConfigStateMark{version: 3, writeTime: time.Now().Add(-2 * time.Hour)})
+	ctrl.sweepStates(time.Now())
+	if _, ok := ctrl.states.Load(other); ok {
+		t.Errorf("expect stale mark swept")
+	}
+	if _, ok := ctrl.states.Load(key); !ok {
+		t.Errorf("expect fresh mark kept")
+	}
+	checkMockDB(t, mock)
+}
+
+func TestListUnusedPrefix(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+
+	// wildcards in prefix are matched literally
+	mock.ExpectQuery(`(?s)from configs c where c.status=\?.* and c.name like \? escape`).
+		WithArgs(ConfigStatusOk, utils.StatusOk, `db\_x.`+"%", 0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "name", "env", "modify_time", "last_read_time"}))
+	if items, err := ctrl.ListUnused(UnusedOrphaned, 0, "db_x.", 0, 10); err != nil || len(items) != 0 {
+		t.Fatalf("list unused fail: %v, %v", items, err)
+	}
+	checkMockDB(t, mock)
+}
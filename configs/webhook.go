@@ -0,0 +1,589 @@
+package configs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	v3rpc "github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/gocomm/dbutil"
+	"github.com/golang/glog"
+	"github.com/infrmods/xbus/utils"
+)
+
+const (
+	// DeliveryStatusPending delivery status pending, attempted at next attempt time
+	DeliveryStatusPending = 0
+	// DeliveryStatusOk delivery status ok
+	DeliveryStatusOk = 1
+	// DeliveryStatusFailed delivery status failed, all attempts failed
+	DeliveryStatusFailed = 2
+
+	// WebhookOpGap payload op of changes lost by etcd compaction, between from_revision & revision
+	WebhookOpGap = "gap"
+
+	// WebhookSignatureHeader hex hmac-sha256 of body, keyed by webhook secret
+	WebhookSignatureHeader = "X-Xbus-Signature"
+	// WebhookDeliveryHeader delivery id
+	WebhookDeliveryHeader = "X-Xbus-Delivery"
+)
+
+// ConfigWebhook config webhook table
+type ConfigWebhook struct {
+	ID         int64     `json:"id"`
+	Prefix     string    `json:"prefix"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	AppID      int64     `json:"app_id"`
+	CreateTime time.Time `json:"create_time"`
+}
+
+// WebhookDelivery webhook delivery log table
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	WebhookID  int64     `json:"webhook_id"`
+	Status     int       `json:"status"`
+	Name       string    `json:"name"`
+	Env        string    `json:"env"`
+	Revision   int64     `json:"revision"`
+	Payload    string    `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error"`
+	CreateTime time.Time `json:"create_time"`
+	ModifyTime time.Time `json:"modify_time"`
+
+	NextAttemptTime *time.Time `json:"next_attempt_time"`
+}
+
+// WebhookPayload webhook payload
+type WebhookPayload struct {
+	Op           string `json:"op"`
+	Name         string `json:"name"`
+	Env          string `json:"env,omitempty"`
+	OldVersion   int64  `json:"old_version"`
+	NewVersion   int64  `json:"new_version"`
+	FromRevision int64  `json:"from_revision,omitempty"`
+	Revision     int64  `json:"revision"`
+	Remark       string `json:"remark"`
+	AppID        int64  `json:"app_id"`
+	AppName      string `json:"app_name"`
+}
+
+// InsertConfigWebhook insert config webhook
+func InsertConfigWebhook(db *sql.DB, hook *ConfigWebhook) error {
+	id, err := dbutil.Insert(db, `insert into config_webhooks(prefix, url, secret, app_id) values(?, ?, ?, ?)`,
+		hook.Prefix, hook.URL, hook.Secret, hook.AppID)
+	if err != nil {
+		return err
+	}
+	hook.ID = id
+	return nil
+}
+
+// GetConfigWebhook get config webhook
+func GetConfigWebhook(db *sql.DB, id int64) (*ConfigWebhook, error) {
+	var hook ConfigWebhook
+	if err := dbutil.Query(db, &hook, `select * from config_webhooks where id=?`, id); err == nil {
+		return &hook, nil
+	} else if err == sql.ErrNoRows {
+		return nil, nil
+	} else {
+		return nil, err
+	}
+}
+
+// ListConfigWebhooks list config webhooks
+func ListConfigWebhooks(db *sql.DB) ([]ConfigWebhook, error) {
+	var hooks []ConfigWebhook
+	if err := dbutil.Query(db, &hooks, `select * from config_webhooks order by id`); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// DeleteConfigWebhook delete config webhook
+func DeleteConfigWebhook(db *sql.DB, id int64) error {
+	_, err := dbutil.Update(db, `delete from config_webhooks where id=?`, id)
+	return err
+}
+
+// ListWebhookDeliveries list webhook deliveries
+func ListWebhookDeliveries(db *sql.DB, webhookID int64, skip, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if err := dbutil.Query(db, &deliveries, `select * from config_webhook_deliveries where webhook_id=?
+                                             order by id desc limit ?,?`, webhookID, skip, limit); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func insertWebhookDelivery(db *sql.DB, delivery *WebhookDelivery) error {
+	id, err := dbutil.Insert(db,
+		`insert ignore into config_webhook_deliveries(webhook_id, status, name, env, revision, payload, next_attempt_time)
+         values(?, ?, ?, ?, ?, ?, ?)`, delivery.WebhookID, delivery.Status, delivery.Name, delivery.Env,
+		delivery.Revision, delivery.Payload, delivery.NextAttemptTime)
+	if err != nil {
+		return err
+	}
+	delivery.ID = id
+	return nil
+}
+
+func updateWebhookDelivery(db *sql.DB, delivery *WebhookDelivery) error {
+	_, err := db.Exec(`update config_webhook_deliveries set status=?, payload=?, attempts=?, status_code=?, error=?,
+                       next_attempt_time=?, modify_time=now() where id=?`, delivery.Status, delivery.Payload,
+		delivery.Attempts, delivery.StatusCode, delivery.Error, delivery.NextAttemptTime, delivery.ID)
+	return err
+}
+
+func listDueWebhookDeliveries(db *sql.DB, now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	if err := dbutil.Query(db, &deliveries, `select * from config_webhook_deliveries where next_attempt_time<=?
+                                             order by next_attempt_time limit ?`, now, limit); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// claimWebhookDelivery postpone next attempt of due delivery until the claim expires,
+// ZeroEffected if claimed by others
+func claimWebhookDelivery(db *sql.DB, id int64, now, until time.Time) error {
+	_, err := dbutil.Update(db, `update config_webhook_deliveries set next_attempt_time=?
+                                 where id=? and next_attempt_time<=?`, until, id, now)
+	return err
+}
+
+func getLastDeliveredRevision(db *sql.DB) (int64, error) {
+	var rev sql.NullInt64
+	if err := db.QueryRow(`select max(revision) from config_webhook_deliveries`).Scan(&rev); err != nil {
+		return 0, err
+	}
+	return rev.Int64, nil
+}
+
+func getConfigHistoryByRevision(db *sql.DB, env, name string, revision int64) (*WebhookPayload, error) {
+	var remark sql.NullString
+	payload := WebhookPayload{Name: name, Env: env, Revision: revision}
+	err := db.QueryRow(`select h.remark, h.app_id, ifnull(a.name, '') from config_histories h
+                        left join apps a on a.id=h.app_id
+                        where h.name=? and h.env=? and h.revision=?`, name, env, revision).Scan(
+		&remark, &payload.AppID, &payload.AppName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	payload.Remark = remark.String
+	return &payload, nil
+}
+
+// AddWebhook add config webhook
+func (ctrl *ConfigCtrl) AddWebhook(hook *ConfigWebhook) error {
+	if err := checkNamePrefix(hook.Prefix); err != nil {
+		return err
+	}
+	if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return utils.Errorf(utils.EcodeInvalidParam, "invalid url: %s", hook.URL)
+	}
+	if err := InsertConfigWebhook(ctrl.db, hook); err != nil {
+		glog.Errorf("insert config webhook(%s) fail: %v", hook.URL, err)
+		return utils.NewSystemError("create webhook fail")
+	}
+	return nil
+}
+
+// IsWebhookHostAllowed whether host of webhook url is in WebhookAllowedHosts
+func (ctrl *ConfigCtrl) IsWebhookHostAllowed(hookURL string) bool {
+	u, err := url.Parse(hookURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range ctrl.config.WebhookAllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWebhook get config webhook
+func (ctrl *ConfigCtrl) GetWebhook(id int64) (*ConfigWebhook, error) {
+	hook, err := GetConfigWebhook(ctrl.db, id)
+	if err != nil {
+		glog.Errorf("get config webhook(%d) fail: %v", id, err)
+		return nil, utils.NewSystemError("get webhook fail")
+	}
+	if hook == nil {
+		return nil, utils.Errorf(utils.EcodeNotFound, "no such webhook: %d", id)
+	}
+	return hook, nil
+}
+
+// ListWebhooks list config webhooks
+func (ctrl *ConfigCtrl) ListWebhooks() ([]ConfigWebhook, error) {
+	hooks, err := ListConfigWebhooks(ctrl.db)
+	if err != nil {
+		glog.Errorf("list config webhooks fail: %v", err)
+		return nil, utils.NewSystemError("list webhooks fail")
+	}
+	if hooks == nil {
+		hooks = make([]ConfigWebhook, 0)
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook delete config webhook
+func (ctrl *ConfigCtrl) DeleteWebhook(id int64) error {
+	if err := DeleteConfigWebhook(ctrl.db, id); err != nil {
+		if err == dbutil.ZeroEffected {
+			return utils.Errorf(utils.EcodeNotFound, "no such webhook: %d", id)
+		}
+		glog.Errorf("delete config webhook(%d) fail: %v", id, err)
+		return utils.NewSystemError("delete webhook fail")
+	}
+	return nil
+}
+
+// ListWebhookDeliveries list webhook deliveries
+func (ctrl *ConfigCtrl) ListWebhookDeliveries(webhookID int64, skip, limit int) ([]WebhookDelivery, error) {
+	deliveries, err := ListWebhookDeliveries(ctrl.db, webhookID, skip, limit)
+	if err != nil {
+		glog.Errorf("list webhook(%d) deliveries fail: %v", webhookID, err)
+		return nil, utils.NewSystemError("list webhook deliveries fail")
+	}
+	if deliveries == nil {
+		deliveries = make([]WebhookDelivery, 0)
+	}
+	return deliveries, nil
+}
+
+type webhookJob struct {
+	hook     ConfigWebhook
+	delivery WebhookDelivery
+}
+
+// RunWebhookDispatcher watch config changes and insert deliveries of them, due deliveries are polled
+// and delivered by a worker pool; deliveries are deduplicated by (webhook, name, env, revision)
+// and claimed in db among xbus instances
+func (ctrl *ConfigCtrl) RunWebhookDispatcher() {
+	client := &http.Client{Timeout: ctrl.config.WebhookTimeout}
+	jobs := make(chan *webhookJob, ctrl.config.WebhookQueueSize)
+	for i := 0; i < ctrl.config.WebhookWorkers; i++ {
+		go ctrl.runWebhookWorker(client, jobs)
+	}
+	go ctrl.runWebhookPoller(jobs)
+	rev, err := getLastDeliveredRevision(ctrl.db)
+	if err != nil {
+		glog.Errorf("get last delivered revision fail: %v", err)
+	}
+	for {
+		rev = ctrl.dispatchWebhooks(context.Background(), rev)
+		time.Sleep(time.Second)
+	}
+}
+
+func (ctrl *ConfigCtrl) runWebhookWorker(client *http.Client, jobs <-chan *webhookJob) {
+	for job := range jobs {
+		ctrl.deliver(client, job.hook, &job.delivery)
+	}
+}
+
+func (ctrl *ConfigCtrl) runWebhookPoller(jobs chan<- *webhookJob) {
+	ticker := time.NewTicker(ctrl.config.WebhookPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ctrl.pollWebhookDeliveries(jobs); err != nil {
+			glog.Errorf("poll webhook deliveries fail: %v", err)
+		}
+	}
+}
+
+// webhookClaimTimeout longest time a claimed delivery may wait in queue & be posted
+func (ctrl *ConfigCtrl) webhookClaimTimeout() time.Duration {
+	return time.Duration(ctrl.config.WebhookQueueSize/ctrl.config.WebhookWorkers+2) * ctrl.config.WebhookTimeout
+}
+
+// pollWebhookDeliveries claim due deliveries up to free space of jobs & queue them,
+// the only sender of jobs, so it never blocks
+func (ctrl *ConfigCtrl) pollWebhookDeliveries(jobs chan<- *webhookJob) error {
+	free := cap(jobs) - len(jobs)
+	if free <= 0 {
+		return nil
+	}
+	now := time.Now()
+	deliveries, err := listDueWebhookDeliveries(ctrl.db, now, free)
+	if err != nil || len(deliveries) == 0 {
+		return err
+	}
+	hooks, err := ListConfigWebhooks(ctrl.db)
+	if err != nil {
+		return err
+	}
+	hookMap := make(map[int64]ConfigWebhook, len(hooks))
+	for _, hook := range hooks {
+		hookMap[hook.ID] = hook
+	}
+	until := now.Add(ctrl.webhookClaimTimeout())
+	for _, delivery := range deliveries {
+		if err := claimWebhookDelivery(ctrl.db, delivery.ID, now, until); err != nil {
+			if err == dbutil.ZeroEffected {
+				// claimed by others
+				continue
+			}
+			return err
+		}
+		hook, ok := hookMap[delivery.WebhookID]
+		if !ok {
+			delivery.Status, delivery.Error, delivery.NextAttemptTime = DeliveryStatusFailed, "webhook deleted", nil
+			if err := updateWebhookDelivery(ctrl.db, &delivery); err != nil {
+				glog.Errorf("update webhook delivery(%d) fail: %v", delivery.ID, err)
+			}
+			continue
+		}
+		jobs <- &webhookJob{hook: hook, delivery: delivery}
+	}
+	return nil
+}
+
+// dispatchWebhooks watch base & env layers separately(other keys may share the key prefix),
+// returns the revision deliveries of all events up to are inserted
+func (ctrl *ConfigCtrl) dispatchWebhooks(ctx context.Context, rev int64) int64 {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watcher := clientv3.NewWatcher(ctrl.etcdClient)
+	defer watcher.Close()
+	opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithProgressNotify()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	baseCh := watcher.Watch(ctx, ctrl.configKey(""), opts...)
+	envCh := watcher.Watch(ctx, ctrl.envsKeyPrefix(), opts...)
+	baseRev, envRev := rev, rev
+watch:
+	for {
+		var resp clientv3.WatchResponse
+		var ok, fromEnv bool
+		select {
+		case resp, ok = <-baseCh:
+		case resp, ok = <-envCh:
+			fromEnv = true
+		}
+		if !ok {
+			break
+		}
+		if err := resp.Err(); err != nil {
+			if err == v3rpc.ErrCompacted {
+				if err := ctrl.dispatchGap(rev+1, resp.CompactRevision-1); err != nil {
+					glog.Errorf("dispatch compacted revisions [%d, %d) fail: %v", rev+1, resp.CompactRevision, err)
+					break
+				}
+				glog.Warningf("webhook watch revision [%d] is compacted, skip to %d", rev+1, resp.CompactRevision)
+				return resp.CompactRevision - 1
+			}
+			glog.Errorf("watch configs for webhooks fail: %v", err)
+			break
+		}
+		if len(resp.Events) > 0 {
+			hooks, err := ListConfigWebhooks(ctrl.db)
+			if err != nil {
+				glog.Errorf("list config webhooks fail: %v", err)
+				break
+			}
+			for _, event := range resp.Events {
+				if err := ctrl.dispatchEvent(hooks, event); err != nil {
+					glog.Errorf("dispatch config change(%s) fail: %v", event.Kv.Key, err)
+					break watch
+				}
+			}
+		}
+		if fromEnv {
+			envRev = resp.Header.Revision
+		} else {
+			baseRev = resp.Header.Revision
+		}
+	}
+	if envRev < baseRev {
+		return envRev
+	}
+	return baseRev
+}
+
+// dispatchEvent insert deliveries of event to matched webhooks, due immediately
+func (ctrl *ConfigCtrl) dispatchEvent(hooks []ConfigWebhook, event *clientv3.Event) error {
+	env, name, ok := ctrl.parseLayerKey(string(event.Kv.Key))
+	if !ok {
+		return nil
+	}
+	matched := make([]ConfigWebhook, 0)
+	for _, hook := range hooks {
+		if strings.HasPrefix(name, hook.Prefix) {
+			matched = append(matched, hook)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	payload := WebhookPayload{Name: name, Env: env, Revision: event.Kv.ModRevision}
+	if event.PrevKv != nil {
+		payload.OldVersion = event.PrevKv.Version
+	}
+	if event.Type == mvccpb.DELETE {
+		payload.Op = ChangeOpDelete
+	} else {
+		payload.Op = ChangeOpPut
+		payload.NewVersion = event.Kv.Version
+	}
+	data, err := json.Marshal(&payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, hook := range matched {
+		delivery := WebhookDelivery{WebhookID: hook.ID, Status: DeliveryStatusPending,
+			Name: name, Env: env, Revision: payload.Revision, Payload: string(data), NextAttemptTime: &now}
+		if err := insertWebhookDelivery(ctrl.db, &delivery); err != nil && err != dbutil.ZeroEffected {
+			// ZeroEffected: dispatched by others
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchGap insert gap deliveries to all webhooks for changes between revisions lost by compaction,
+// keyed by empty name which no config has
+func (ctrl *ConfigCtrl) dispatchGap(fromRev, toRev int64) error {
+	hooks, err := ListConfigWebhooks(ctrl.db)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, hook := range hooks {
+		data, err := json.Marshal(&WebhookPayload{Op: WebhookOpGap, Name: hook.Prefix,
+			FromRevision: fromRev, Revision: toRev})
+		if err != nil {
+			return err
+		}
+		delivery := WebhookDelivery{WebhookID: hook.ID, Status: DeliveryStatusPending,
+			Revision: toRev, Payload: string(data), NextAttemptTime: &now}
+		if err := insertWebhookDelivery(ctrl.db, &delivery); err != nil && err != dbutil.ZeroEffected {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillPayloadHistory fill remark & app of put change from history, false if not ready;
+// history is inserted right after etcd changes, so it's waited for at most WebhookHistoryWait
+// since the delivery is created, then the change is delivered without it
+func (ctrl *ConfigCtrl) fillPayloadHistory(delivery *WebhookDelivery) (bool, error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+		return false, err
+	}
+	if payload.Op != ChangeOpPut {
+		return true, nil
+	}
+	history, err := getConfigHistoryByRevision(ctrl.db, payload.Env, payload.Name, payload.Revision)
+	if err != nil {
+		return false, err
+	}
+	if history == nil {
+		if time.Since(delivery.CreateTime) < ctrl.config.WebhookHistoryWait {
+			return false, nil
+		}
+		glog.Warningf("no history of config(%s) revision(%d)", payload.Name, payload.Revision)
+		return true, nil
+	}
+	payload.Remark, payload.AppID, payload.AppName = history.Remark, history.AppID, history.AppName
+	data, err := json.Marshal(&payload)
+	if err != nil {
+		return false, err
+	}
+	delivery.Payload = string(data)
+	return true, nil
+}
+
+// deliver attempt delivery once, failed ones are rescheduled with exponential backoff
+func (ctrl *ConfigCtrl) deliver(client *http.Client, hook ConfigWebhook, delivery *WebhookDelivery) {
+	now := time.Now()
+	ready := delivery.Attempts > 0
+	if !ready {
+		var err error
+		if ready, err = ctrl.fillPayloadHistory(delivery); err != nil {
+			glog.Errorf("fill webhook delivery(%d) history fail: %v", delivery.ID, err)
+		}
+	}
+	if !ready {
+		next := now.Add(ctrl.config.WebhookPollInterval)
+		delivery.NextAttemptTime = &next
+	} else {
+		delivery.Attempts++
+		code, err := postWebhook(client, hook.URL, hook.Secret, delivery.ID, []byte(delivery.Payload))
+		delivery.StatusCode = code
+		if err == nil {
+			delivery.Status, delivery.Error, delivery.NextAttemptTime = DeliveryStatusOk, "", nil
+		} else {
+			delivery.Error = err.Error()
+			if len(delivery.Error) > 256 {
+				delivery.Error = delivery.Error[:256]
+			}
+			glog.Warningf("deliver config(%s) change to webhook(%d) fail(attempt %d): %v",
+				delivery.Name, hook.ID, delivery.Attempts, err)
+			if delivery.Attempts < ctrl.config.WebhookMaxAttempts {
+				next := now.Add(ctrl.config.WebhookRetryInterval << uint(delivery.Attempts-1))
+				delivery.Status, delivery.NextAttemptTime = DeliveryStatusPending, &next
+			} else {
+				delivery.Status, delivery.NextAttemptTime = DeliveryStatusFailed, nil
+			}
+		}
+	}
+	if err := updateWebhookDelivery(ctrl.db, delivery); err != nil {
+		glog.Errorf("update webhook delivery(%d) fail: %v", delivery.ID, err)
+	}
+}
+
+// SignWebhookPayload sign webhook payload
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(client *http.Client, hookURL, secret string, deliveryID int64, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookDeliveryHeader, fmt.Sprint(deliveryID))
+	if secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,212 @@
+package configs
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostWebhook(t *testing.T) {
+	body := []byte(`{"op":"put","name":"db.common.host"}`)
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		data, _ := ioutil.ReadAll(r.Body)
+		if sig := r.Header.Get(WebhookSignatureHeader); sig != SignWebhookPayload("secret", data) {
+			t.Errorf("invalid signature: %s", sig)
+		}
+		if r.Header.Get(WebhookDeliveryHeader) != "7" {
+			t.Errorf("invalid delivery id: %s", r.Header.Get(WebhookDeliveryHeader))
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	if code, err := postWebhook(http.DefaultClient, server.URL, "secret", 7, body); err == nil || code != 500 {
+		t.Errorf("expect 500 error, got %d: %v", code, err)
+	}
+	if code, err := postWebhook(http.DefaultClient, server.URL, "secret", 7, body); err != nil || code != 200 {
+		t.Errorf("expect ok, got %d: %v", code, err)
+	}
+}
+
+var deliveryColumns = []string{"id", "webhook_id", "status", "name", "env", "revision", "payload", "attempts",
+	"status_code", "error", "create_time", "modify_time", "next_attempt_time"}
+
+func TestDispatchWebhooks(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	rev := putLayers(t, ctrl, map[string]string{"db.host": "a"})
+	expectHooks := func() {
+		mock.ExpectQuery(`select \* from config_webhooks`).WillReturnRows(
+			sqlmock.NewRows([]string{"id", "prefix", "url", "secret", "app_id", "create_time"}).
+				AddRow(1, "db.", "http://127.0.0.1", "", 0, time.Now()).
+				AddRow(2, "mq.", "http://127.0.0.1", "", 0, time.Now()))
+	}
+
+	// cursor is kept if deliveries are not inserted
+	expectHooks()
+	mock.ExpectExec(`insert ignore into config_webhook_deliveries`).WillReturnError(sqlmock.ErrCancelled)
+	if r := ctrl.dispatchWebhooks(context.Background(), rev-1); r != rev-1 {
+		t.Fatalf("expect cursor %d, got %d", rev-1, r)
+	}
+
+	// deliveries are inserted due, without waiting for history
+	expectHooks()
+	mock.ExpectExec(`insert ignore into config_webhook_deliveries`).
+		WithArgs(1, DeliveryStatusPending, "db.host", "", rev, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	ctrl.dispatchWebhooks(ctx, rev-1)
+	checkMockDB(t, mock)
+}
+
+func TestPollWebhookDeliveries(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.config.WebhookQueueSize, ctrl.config.WebhookWorkers = 2, 1
+	now := time.Now()
+	jobs := make(chan *webhookJob, 2)
+	jobs <- &webhookJob{}
+
+	// only free space of queue is polled, claimed & deleted hooks are skipped
+	mock.ExpectQuery(`select \* from config_webhook_deliveries where next_attempt_time<=\?`).
+		WithArgs(sqlmock.AnyArg(), 1).WillReturnRows(sqlmock.NewRows(deliveryColumns).
+		AddRow(7, 1, DeliveryStatusPending, "db.host", "", 3, "{}", 0, 0, "", now, now, now).
+		AddRow(8, 1, DeliveryStatusPending, "db.port", "", 4, "{}", 0, 0, "", now, now, now).
+		AddRow(9, 5, DeliveryStatusPending, "db.user", "", 5, "{}", 0, 0, "", now, now, now))
+	mock.ExpectQuery(`select \* from config_webhooks`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "prefix", "url", "secret", "app_id", "create_time"}).
+			AddRow(1, "db.", "http://127.0.0.1", "", 0, now))
+	mock.ExpectExec(`update config_webhook_deliveries set next_attempt_time=\?`).
+		WithArgs(sqlmock.AnyArg(), 7, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`update config_webhook_deliveries set next_attempt_time=\?`).
+		WithArgs(sqlmock.AnyArg(), 8, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`update config_webhook_deliveries set next_attempt_time=\?`).
+		WithArgs(sqlmock.AnyArg(), 9, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`update config_webhook_deliveries set status=\?`).
+		WithArgs(DeliveryStatusFailed, "{}", 0, 0, "webhook deleted", nil, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := ctrl.pollWebhookDeliveries(jobs); err != nil {
+		t.Fatalf("poll deliveries fail: %v", err)
+	}
+	<-jobs
+	if job := <-jobs; job.hook.ID != 1 || job.delivery.ID != 8 {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	// full queue is not polled
+	jobs <- &webhookJob{}
+	jobs <- &webhookJob{}
+	if err := ctrl.pollWebhookDeliveries(jobs); err != nil {
+		t.Fatalf("poll deliveries fail: %v", err)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var payload WebhookPayload
+	var fail bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload fail: %v", err)
+		}
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	ctrl.config.WebhookMaxAttempts, ctrl.config.WebhookRetryInterval = 2, time.Minute
+	ctrl.config.WebhookHistoryWait, ctrl.config.WebhookPollInterval = time.Minute, time.Second
+	hook := ConfigWebhook{ID: 1, Prefix: "db.", URL: server.URL}
+	delivery := WebhookDelivery{ID: 7, WebhookID: 1, Name: "db.host", Revision: 3, CreateTime: time.Now(),
+		Payload: `{"op":"put","name":"db.host","revision":3}`}
+	expectHistory := func(rows *sqlmock.Rows) {
+		mock.ExpectQuery(`select h.remark, h.app_id`).WithArgs("db.host", "", 3).WillReturnRows(rows)
+	}
+	expectUpdate := func(status, attempts, code int) {
+		mock.ExpectExec(`update config_webhook_deliveries set status=\?`).
+			WithArgs(status, sqlmock.AnyArg(), attempts, code, sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	// history not written yet, rescheduled without attempts
+	expectHistory(sqlmock.NewRows([]string{"remark", "app_id", "name"}))
+	expectUpdate(DeliveryStatusPending, 0, 0)
+	ctrl.deliver(http.DefaultClient, hook, &delivery)
+	if delivery.Attempts != 0 || delivery.NextAttemptTime == nil || payload.Name != "" {
+		t.Fatalf("expect delivery rescheduled: %+v", delivery)
+	}
+
+	// failed attempt is retried later
+	fail = true
+	expectHistory(sqlmock.NewRows([]string{"remark", "app_id", "name"}).AddRow("init", 3, "ops"))
+	expectUpdate(DeliveryStatusPending, 1, http.StatusBadGateway)
+	ctrl.deliver(http.DefaultClient, hook, &delivery)
+	if delivery.NextAttemptTime == nil || time.Until(*delivery.NextAttemptTime) < 50*time.Second {
+		t.Errorf("expect retry after interval: %+v", delivery)
+	}
+	if payload.Remark != "init" || payload.AppName != "ops" || payload.AppID != 3 {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+
+	// history is filled once, all attempts failed
+	expectUpdate(DeliveryStatusFailed, 2, http.StatusBadGateway)
+	ctrl.deliver(http.DefaultClient, hook, &delivery)
+	if delivery.NextAttemptTime != nil {
+		t.Errorf("expect no more attempts: %+v", delivery)
+	}
+
+	fail = false
+	delivery.Attempts = 1
+	expectUpdate(DeliveryStatusOk, 2, http.StatusOK)
+	ctrl.deliver(http.DefaultClient, hook, &delivery)
+	if delivery.Status != DeliveryStatusOk || delivery.NextAttemptTime != nil || payload.Remark != "init" {
+		t.Errorf("unexpected delivery: %+v, payload: %+v", delivery, payload)
+	}
+	checkMockDB(t, mock)
+}
+
+func TestDispatchCompactedWebhooks(t *testing.T) {
+	db, mock := newMockDB(t)
+	ctrl := newTestCtrl(t, db)
+	rev := putLayers(t, ctrl, map[string]string{"db.host": "a"})
+	compactRev := putLayers(t, ctrl, map[string]string{"db.host": "b"})
+	if _, err := ctrl.etcdClient.Compact(context.Background(), compactRev); err != nil {
+		t.Fatal(err)
+	}
+	expectHooks := func() {
+		mock.ExpectQuery(`select \* from config_webhooks`).WillReturnRows(
+			sqlmock.NewRows([]string{"id", "prefix", "url", "secret", "app_id", "create_time"}).
+				AddRow(1, "db.", "http://127.0.0.1", "", 0, time.Now()))
+	}
+
+	// cursor is kept if gap deliveries are not inserted
+	expectHooks()
+	mock.ExpectExec(`insert ignore into config_webhook_deliveries`).WillReturnError(sqlmock.ErrCancelled)
+	if r := ctrl.dispatchWebhooks(context.Background(), rev-1); r != rev-1 {
+		t.Fatalf("expect cursor %d, got %d", rev-1, r)
+	}
+
+	// lost changes are delivered as gap
+	expectHooks()
+	payload, _ := json.Marshal(&WebhookPayload{Op: WebhookOpGap, Name: "db.", FromRevision: rev, Revision: compactRev - 1})
+	mock.ExpectExec(`insert ignore into config_webhook_deliveries`).
+		WithArgs(1, DeliveryStatusPending, "", "", compactRev-1, string(payload), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	if r := ctrl.dispatchWebhooks(context.Background(), rev-1); r != compactRev-1 {
+		t.Fatalf("expect cursor %d, got %d", compactRev-1, r)
+	}
+	checkMockDB(t, mock)
+}
@@ -79,6 +79,14 @@ func (x *XBus) NewAppCtrl(db *sql.DB, etcdClient *clientv3.Client) *apps.AppCtrl
 	return appCtrl
 }
 
+// NewConfigCtrl new config ctrl
+func (x *XBus) NewConfigCtrl(db *sql.DB, etcdClient *clientv3.Client) *configs.ConfigCtrl {
+	if x.Config.Configs.Etcd != nil {
+		etcdClient = x.Config.Configs.Etcd.NewEtcdClient()
+	}
+	return configs.NewConfigCtrl(&x.Config.Configs, db, etcdClient)
+}
+
 func main() {
 	subcommands.Register(subcommands.HelpCommand(), "")
 	subcommands.Register(subcommands.FlagsCommand(), "")
@@ -88,9 +96,20 @@ func main() {
 	subcommands.Register(&GenRootCmd{}, "")
 	subcommands.Register(&FixCmd{}, "")
 	subcommands.Register(&ListGroupCmd{}, "")
+	subcommands.Register(&GroupCmd{}, "")
 	subcommands.Register(&ListPermCmd{}, "")
 	subcommands.Register(&GrantCmd{}, "")
+	subcommands.Register(&RevokeCmd{}, "")
+	subcommands.Register(&ExplainPermCmd{}, "")
 	subcommands.Register(&KeyCertCmd{}, "")
+	subcommands.Register(&RenewCertCmd{}, "")
+	subcommands.Register(&RevokeCertCmd{}, "")
+	subcommands.Register(&EncryptKeysCmd{}, "")
+	subcommands.Register(&ExpiringCertsCmd{}, "")
+	subcommands.Register(&AppStatusCmd{disable: true}, "")
+	subcommands.Register(&AppStatusCmd{}, "")
+	subcommands.Register(&ConfigCmd{}, "")
+	subcommands.Register(&AgentCmd{}, "")
 
 	flag.Set("logtostderr", "true")
 	flag.Parse()
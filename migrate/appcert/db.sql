@@ -0,0 +1,11 @@
+create table app_certs (
+  id bigint(20) not null auto_increment,
+  app_id bigint(20) not null,
+  serial_no varchar(64) not null,
+  cert varchar(4096) not null,
+  not_after datetime not null,
+  expire_time datetime default null,
+  create_time datetime not null default current_timestamp,
+  primary key (id),
+  unique key app_serial_uniq (app_id, serial_no)
+) engine=InnoDB default charset=utf8;
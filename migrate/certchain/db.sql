@@ -0,0 +1,2 @@
+alter table apps modify column cert text;
+alter table app_certs modify column cert text not null;
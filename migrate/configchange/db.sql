@@ -0,0 +1,18 @@
+alter table config_histories add column approver_id bigint(20) not null default 0 after app_id;
+create table config_changes (
+  id bigint(20) not null auto_increment,
+  status tinyint(4) not null default 0,
+  op varchar(8) not null,
+  tag varchar(32) not null default '',
+  name varchar(64) not null,
+  env varchar(32) not null default '',
+  value text not null,
+  version bigint(20) not null,
+  remark varchar(128) not null default '',
+  app_id bigint(20) not null,
+  approver_id bigint(20) not null default 0,
+  create_time datetime not null default current_timestamp,
+  modify_time datetime not null default current_timestamp,
+  primary key (id),
+  key status_name (status, name)
+) engine=InnoDB default charset=utf8;
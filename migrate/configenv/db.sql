@@ -0,0 +1,5 @@
+alter table apps add column env varchar(32) not null default '' after description;
+alter table configs add column env varchar(32) not null default '' after name;
+alter table configs drop index name_uniq;
+alter table configs add unique index name_uniq (name, env);
+alter table config_histories add column env varchar(32) not null default '' after name;
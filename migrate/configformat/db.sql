@@ -0,0 +1,2 @@
+alter table configs add column format varchar(16) not null default '' after tag;
+alter table config_changes add column format varchar(16) not null default '' after tag;
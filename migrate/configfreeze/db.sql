@@ -0,0 +1,12 @@
+alter table config_histories add column freeze_id bigint(20) not null default 0 after revision;
+create table config_freezes (
+  id bigint(20) not null auto_increment,
+  prefix varchar(64) not null default '',
+  reason varchar(256) not null default '',
+  start_time datetime not null,
+  end_time datetime not null,
+  app_id bigint(20) not null default 0,
+  create_time datetime not null default current_timestamp,
+  primary key (id),
+  key end_time_key (end_time)
+) engine=InnoDB default charset=utf8;
@@ -0,0 +1,28 @@
+alter table config_histories add column revision bigint(20) not null default 0 after value;
+alter table config_histories add index name_revision (name, env, revision);
+create table config_webhooks (
+  id bigint(20) not null auto_increment,
+  prefix varchar(64) not null default '',
+  url varchar(256) not null,
+  secret varchar(128) not null default '',
+  app_id bigint(20) not null,
+  create_time datetime not null default current_timestamp,
+  primary key (id)
+) engine=InnoDB default charset=utf8;
+create table config_webhook_deliveries (
+  id bigint(20) not null auto_increment,
+  webhook_id bigint(20) not null,
+  status tinyint(4) not null default 0,
+  name varchar(64) not null,
+  env varchar(32) not null default '',
+  revision bigint(20) not null,
+  payload text not null,
+  attempts int(11) not null default 0,
+  status_code int(11) not null default 0,
+  error varchar(256) not null default '',
+  create_time datetime not null default current_timestamp,
+  modify_time datetime not null default current_timestamp,
+  primary key (id),
+  unique key webhook_event (webhook_id, name, env, revision),
+  key revision_key (revision)
+) engine=InnoDB default charset=utf8;
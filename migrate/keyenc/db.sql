@@ -0,0 +1 @@
+alter table apps modify column private_key text;
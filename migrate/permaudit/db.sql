@@ -0,0 +1,14 @@
+create table perm_audits (
+  id bigint(20) not null auto_increment,
+  action varchar(16) not null,
+  perm_id bigint(20) not null,
+  perm_type tinyint(4) not null,
+  target_type tinyint(4) not null,
+  target_id bigint(20) not null,
+  can_write tinyint(4) not null,
+  content varchar(128) not null,
+  operator varchar(128) not null default '',
+  create_time datetime not null default current_timestamp,
+  primary key (id),
+  key content_idx (content)
+) engine=InnoDB default charset=utf8;
@@ -0,0 +1,2 @@
+alter table perms add column deny tinyint(4) not null default 0 after can_write;
+alter table perm_audits add column deny tinyint(4) not null default 0 after can_write;
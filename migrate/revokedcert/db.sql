@@ -0,0 +1,9 @@
+create table revoked_certs (
+  id bigint(20) not null auto_increment,
+  serial_no varchar(64) not null,
+  app_id bigint(20) not null default 0,
+  reason varchar(256) not null default '',
+  revoke_time datetime not null default current_timestamp,
+  primary key (id),
+  unique key serial_no_uniq (serial_no)
+) engine=InnoDB default charset=utf8;
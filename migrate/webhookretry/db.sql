@@ -0,0 +1,3 @@
+alter table config_webhook_deliveries add column next_attempt_time datetime default null after modify_time;
+alter table config_webhook_deliveries add index next_attempt_key (next_attempt_time);
+update config_webhook_deliveries set next_attempt_time=now() where status=0;
@@ -7,11 +7,15 @@ import yaml
 
 def recovery(db, etcd, prefix):
     cursor = db.cursor()
-    cursor.execute('select name, value from configs where status=0')
+    cursor.execute('select name, env, value from configs where status=0')
     configs = list(cursor.fetchall())
-    for name, value in configs:
-        print('%s/%s' % (prefix, name))
-        etcd.put('%s/%s' % (prefix, name), value)
+    for name, env, value in configs:
+        if env:
+            key = '%s-envs/%s/%s' % (prefix, env, name)
+        else:
+            key = '%s/%s' % (prefix, name)
+        print(key)
+        etcd.put(key, value)
     print('finished %d' % len(configs))
 
 
@@ -36,6 +36,25 @@ CREATE TABLE `app_config_states` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `app_certs`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `app_certs` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `app_id` bigint(20) NOT NULL,
+  `serial_no` varchar(64) NOT NULL,
+  `cert` text NOT NULL,
+  `not_after` datetime NOT NULL,
+  `expire_time` datetime DEFAULT NULL,
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `app_serial_uniq` (`app_id`,`serial_no`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `apps`
 --
@@ -47,8 +66,9 @@ CREATE TABLE `apps` (
   `status` tinyint(4) NOT NULL,
   `name` varchar(64) NOT NULL,
   `description` varchar(512) NOT NULL,
-  `private_key` varchar(4096) DEFAULT NULL,
-  `cert` varchar(4096) DEFAULT NULL,
+  `env` varchar(32) NOT NULL DEFAULT '',
+  `private_key` text,
+  `cert` text,
   `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `modify_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`),
@@ -56,6 +76,51 @@ CREATE TABLE `apps` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `config_changes`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `config_changes` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `status` tinyint(4) NOT NULL DEFAULT '0',
+  `op` varchar(8) NOT NULL,
+  `tag` varchar(32) NOT NULL DEFAULT '',
+  `format` varchar(16) NOT NULL DEFAULT '',
+  `name` varchar(64) NOT NULL,
+  `env` varchar(32) NOT NULL DEFAULT '',
+  `value` text NOT NULL,
+  `version` bigint(20) NOT NULL,
+  `remark` varchar(128) NOT NULL DEFAULT '',
+  `app_id` bigint(20) NOT NULL,
+  `approver_id` bigint(20) NOT NULL DEFAULT '0',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `modify_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `status_name` (`status`,`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `config_freezes`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `config_freezes` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `prefix` varchar(64) NOT NULL DEFAULT '',
+  `reason` varchar(256) NOT NULL DEFAULT '',
+  `start_time` datetime NOT NULL,
+  `end_time` datetime NOT NULL,
+  `app_id` bigint(20) NOT NULL DEFAULT '0',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `end_time_key` (`end_time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `config_histories`
 --
@@ -66,12 +131,61 @@ CREATE TABLE `config_histories` (
   `id` bigint(20) NOT NULL AUTO_INCREMENT,
   `tag` varchar(32) DEFAULT NULL,
   `name` varchar(64) NOT NULL,
+  `env` varchar(32) NOT NULL DEFAULT '',
   `app_id` bigint(20) NOT NULL,
+  `approver_id` bigint(20) NOT NULL DEFAULT '0',
   `remark` varchar(128) DEFAULT NULL,
   `value` text NOT NULL,
+  `revision` bigint(20) NOT NULL DEFAULT '0',
+  `freeze_id` bigint(20) NOT NULL DEFAULT '0',
   `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`),
-  KEY `name_key` (`name`) USING BTREE
+  KEY `name_key` (`name`) USING BTREE,
+  KEY `name_revision` (`name`,`env`,`revision`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `config_webhooks`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `config_webhooks` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `prefix` varchar(64) NOT NULL DEFAULT '',
+  `url` varchar(256) NOT NULL,
+  `secret` varchar(128) NOT NULL DEFAULT '',
+  `app_id` bigint(20) NOT NULL,
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `config_webhook_deliveries`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `config_webhook_deliveries` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `webhook_id` bigint(20) NOT NULL,
+  `status` tinyint(4) NOT NULL DEFAULT '0',
+  `name` varchar(64) NOT NULL,
+  `env` varchar(32) NOT NULL DEFAULT '',
+  `revision` bigint(20) NOT NULL,
+  `payload` text NOT NULL,
+  `attempts` int(11) NOT NULL DEFAULT '0',
+  `status_code` int(11) NOT NULL DEFAULT '0',
+  `error` varchar(256) NOT NULL DEFAULT '',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `modify_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `next_attempt_time` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `webhook_event` (`webhook_id`,`name`,`env`,`revision`),
+  KEY `revision_key` (`revision`),
+  KEY `next_attempt_key` (`next_attempt_time`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
@@ -103,12 +217,14 @@ CREATE TABLE `configs` (
   `id` bigint(20) NOT NULL AUTO_INCREMENT,
   `status` tinyint(4) NOT NULL DEFAULT '0',
   `tag` varchar(32) DEFAULT NULL,
+  `format` varchar(16) NOT NULL DEFAULT '',
   `name` varchar(64) NOT NULL,
+  `env` varchar(32) NOT NULL DEFAULT '',
   `value` text NOT NULL,
   `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   `modify_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`),
-  UNIQUE KEY `name_uniq` (`name`) USING BTREE,
+  UNIQUE KEY `name_uniq` (`name`,`env`) USING BTREE,
   KEY `tag_name` (`tag`,`name`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 /*!40101 SET character_set_client = @saved_cs_client */;
@@ -147,6 +263,29 @@ CREATE TABLE `groups` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `perm_audits`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `perm_audits` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `action` varchar(16) NOT NULL,
+  `perm_id` bigint(20) NOT NULL,
+  `perm_type` tinyint(4) NOT NULL,
+  `target_type` tinyint(4) NOT NULL,
+  `target_id` bigint(20) NOT NULL,
+  `can_write` tinyint(4) NOT NULL,
+  `deny` tinyint(4) NOT NULL DEFAULT '0',
+  `content` varchar(128) NOT NULL,
+  `operator` varchar(128) NOT NULL DEFAULT '',
+  `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `content_idx` (`content`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `perms`
 --
@@ -159,6 +298,7 @@ CREATE TABLE `perms` (
   `target_type` tinyint(4) NOT NULL,
   `target_id` bigint(20) NOT NULL,
   `can_write` tinyint(4) NOT NULL,
+  `deny` tinyint(4) NOT NULL DEFAULT '0',
   `content` varchar(128) NOT NULL,
   `create_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`id`),
@@ -166,6 +306,23 @@ CREATE TABLE `perms` (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
+--
+-- Table structure for table `revoked_certs`
+--
+
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `revoked_certs` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `serial_no` varchar(64) NOT NULL,
+  `app_id` bigint(20) NOT NULL DEFAULT '0',
+  `reason` varchar(256) NOT NULL DEFAULT '',
+  `revoke_time` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `serial_no_uniq` (`serial_no`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `services`
 --
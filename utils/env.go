@@ -0,0 +1,12 @@
+package utils
+
+import (
+	"regexp"
+)
+
+var rValidEnv = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// IsValidEnv is valid env name
+func IsValidEnv(env string) bool {
+	return rValidEnv.MatchString(env)
+}
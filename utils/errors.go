@@ -13,6 +13,8 @@ const (
 	EcodeMissingParam = "MISSING_PARAM"
 	// EcodeInvalidName INVALID_NAME
 	EcodeInvalidName = "INVALID_NAME"
+	// EcodeInvalidEnv INVALID_ENV
+	EcodeInvalidEnv = "INVALID_ENV"
 	// EcodeInvalidService INVALID_SERVICE
 	EcodeInvalidService = "INVALID_SERVICE"
 	// EcodeInvalidZone INVALID_ZONE
@@ -45,6 +47,16 @@ const (
 	EcodeNameDuplicated = "NAME_DUPLICATED"
 	// EcodeNotPermitted NOT_PERMITTED
 	EcodeNotPermitted = "NOT_PERMITTED"
+	// EcodeInvalidStatus INVALID_STATUS
+	EcodeInvalidStatus = "INVALID_STATUS"
+	// EcodeDegraded DEGRADED
+	EcodeDegraded = "DEGRADED"
+	// EcodeInvalidRef INVALID_REFERENCE
+	EcodeInvalidRef = "INVALID_REFERENCE"
+	// EcodeInvalidFormat INVALID_FORMAT
+	EcodeInvalidFormat = "INVALID_FORMAT"
+	// EcodeConfigFrozen CONFIG_FROZEN
+	EcodeConfigFrozen = "CONFIG_FROZEN"
 	// EcodeEtcdWatchFailed ETCD_WATCH_FAILED
 	EcodeEtcdWatchFailed = "ETCD_WATCH_FAILED"
 )
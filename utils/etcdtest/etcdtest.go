@@ -0,0 +1,83 @@
+// Package etcdtest embedded etcd server for tests
+package etcdtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/embed"
+)
+
+// Server embedded etcd server
+type Server struct {
+	etcd *embed.Etcd
+	dir  string
+
+	Client *clientv3.Client
+}
+
+func freeURL() (url.URL, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return url.URL{}, err
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}, nil
+}
+
+// Start start embedded etcd server on random local ports
+func Start() (*Server, error) {
+	dir, err := ioutil.TempDir("", "etcdtest")
+	if err != nil {
+		return nil, err
+	}
+	clientURL, err := freeURL()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	peerURL, err := freeURL()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("embedded etcd start timeout")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints: []string{clientURL.String()}, DialTimeout: 5 * time.Second})
+	if err != nil {
+		e.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &Server{etcd: e, dir: dir, Client: client}, nil
+}
+
+// Close close client & server, remove data dir
+func (s *Server) Close() {
+	s.Client.Close()
+	s.etcd.Close()
+	os.RemoveAll(s.dir)
+}
@@ -0,0 +1,432 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+	"unicode/utf16"
+)
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidPKCS8ShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBEWithSHAAnd3DES        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidSHA1                     = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	// java marks certs of pkcs12 trusted entries with this attribute
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+	oidJKSKeyProtector     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+)
+
+const (
+	pkcs12Iterations = 2048
+	jksMagic         = 0xfeedfeed
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// explicit [0] wrapping, asn1 ignores explicit tags of raw values
+func explicitRaw(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+func bmpString(s string) []byte {
+	var buf bytes.Buffer
+	for _, c := range utf16.Encode([]rune(s)) {
+		buf.WriteByte(byte(c >> 8))
+		buf.WriteByte(byte(c))
+	}
+	return buf.Bytes()
+}
+
+// pkcs12Password password as null terminated bmp string
+func pkcs12Password(password string) []byte {
+	return append(bmpString(password), 0, 0)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// pkcs12KDF key derivation of RFC 7292 appendix B with sha1
+func pkcs12KDF(password, salt []byte, iterations int, id byte, size int) []byte {
+	const v = 64
+	fill := func(data []byte) []byte {
+		n := (len(data) + v - 1) / v * v
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+	d := bytes.Repeat([]byte{id}, v)
+	var input []byte
+	if len(salt) > 0 {
+		input = append(input, fill(salt)...)
+	}
+	if len(password) > 0 {
+		input = append(input, fill(password)...)
+	}
+
+	var out []byte
+	one := big.NewInt(1)
+	for len(out) < size {
+		sum := sha1.Sum(append(append([]byte{}, d...), input...))
+		a := sum[:]
+		for i := 1; i < iterations; i++ {
+			sum = sha1.Sum(a)
+			a = sum[:]
+		}
+		out = append(out, a...)
+		if len(out) >= size {
+			break
+		}
+		b := new(big.Int).SetBytes(fill(a)[:v])
+		for j := 0; j < len(input); j += v {
+			n := new(big.Int).SetBytes(input[j : j+v])
+			n.Add(n, b).Add(n, one)
+			nb := n.Bytes()
+			if len(nb) > v {
+				nb = nb[len(nb)-v:]
+			}
+			block := input[j : j+v]
+			for k := range block {
+				block[k] = 0
+			}
+			copy(block[v-len(nb):], nb)
+		}
+	}
+	return out[:size]
+}
+
+// pbeEncrypt encrypt with pbeWithSHAAnd3-KeyTripleDES-CBC
+func pbeEncrypt(data, password []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	var alg pkix.AlgorithmIdentifier
+	salt, err := randomBytes(8)
+	if err != nil {
+		return alg, nil, err
+	}
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return alg, nil, err
+	}
+	alg = pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3DES, Parameters: asn1.RawValue{FullBytes: params}}
+
+	block, err := des.NewTripleDESCipher(pkcs12KDF(password, salt, pkcs12Iterations, 1, 24))
+	if err != nil {
+		return alg, nil, err
+	}
+	iv := pkcs12KDF(password, salt, pkcs12Iterations, 2, block.BlockSize())
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	encrypted := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+	return alg, encrypted, nil
+}
+
+func newPKCS12Attribute(id asn1.ObjectIdentifier, value interface{}) (pkcs12Attribute, error) {
+	data, err := asn1.Marshal(value)
+	if err != nil {
+		return pkcs12Attribute{}, err
+	}
+	return pkcs12Attribute{ID: id,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: data}}, nil
+}
+
+func newFriendlyName(name string) (pkcs12Attribute, error) {
+	return newPKCS12Attribute(oidFriendlyName, asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpString(name)})
+}
+
+func newCertBag(cert *x509.Certificate, attrs ...pkcs12Attribute) (safeBag, error) {
+	data, err := asn1.Marshal(certBag{ID: oidCertTypeX509, Data: cert.Raw})
+	if err != nil {
+		return safeBag{}, err
+	}
+	return safeBag{ID: oidCertBag, Value: explicitRaw(data), Attributes: attrs}, nil
+}
+
+func newDataContentInfo(data []byte) (contentInfo, error) {
+	content, err := asn1.Marshal(data)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidDataContentType, Content: explicitRaw(content)}, nil
+}
+
+// EncodePKCS12 encode key & cert chain to pkcs12, caCerts are added as trusted entries
+func EncodePKCS12(key crypto.Signer, certs []*x509.Certificate, caCerts []*x509.Certificate,
+	alias, password string) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no cert")
+	}
+	pass := pkcs12Password(password)
+	keyID := sha1.Sum(certs[0].Raw)
+	localKeyID, err := newPKCS12Attribute(oidLocalKeyID, keyID[:])
+	if err != nil {
+		return nil, err
+	}
+	friendlyName, err := newFriendlyName(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, cert := range certs {
+		var attrs []pkcs12Attribute
+		if i == 0 {
+			attrs = []pkcs12Attribute{localKeyID, friendlyName}
+		}
+		bag, err := newCertBag(cert, attrs...)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+	trusted, err := newPKCS12Attribute(oidJavaTrustedKeyUsage, oidAnyExtendedKeyUsage)
+	if err != nil {
+		return nil, err
+	}
+	for i, cert := range caCerts {
+		name, err := newFriendlyName(caAlias(i))
+		if err != nil {
+			return nil, err
+		}
+		bag, err := newCertBag(cert, name, trusted)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+	certsData, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	alg, encrypted, err := pbeEncrypt(certsData, pass)
+	if err != nil {
+		return nil, err
+	}
+	certsContent, err := asn1.Marshal(encryptedData{Version: 0, EncryptedContentInfo: encryptedContentInfo{
+		ContentType: oidDataContentType, ContentEncryptionAlgorithm: alg, EncryptedContent: encrypted}})
+	if err != nil {
+		return nil, err
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	alg, encrypted, err = pbeEncrypt(pkcs8, pass)
+	if err != nil {
+		return nil, err
+	}
+	keyData, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: alg, EncryptedData: encrypted})
+	if err != nil {
+		return nil, err
+	}
+	keyBags, err := asn1.Marshal([]safeBag{{ID: oidPKCS8ShroudedKeyBag, Value: explicitRaw(keyData),
+		Attributes: []pkcs12Attribute{localKeyID, friendlyName}}})
+	if err != nil {
+		return nil, err
+	}
+	keyContent, err := newDataContentInfo(keyBags)
+	if err != nil {
+		return nil, err
+	}
+
+	authSafe, err := asn1.Marshal([]contentInfo{
+		{ContentType: oidEncryptedDataContentType, Content: explicitRaw(certsContent)}, keyContent})
+	if err != nil {
+		return nil, err
+	}
+	salt, err := randomBytes(8)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, pkcs12KDF(pass, salt, pkcs12Iterations, 3, sha1.Size))
+	mac.Write(authSafe)
+
+	pfx := pfxPdu{Version: 3}
+	if pfx.AuthSafe, err = newDataContentInfo(authSafe); err != nil {
+		return nil, err
+	}
+	pfx.MacData = macData{Mac: digestInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		Digest:    mac.Sum(nil)}, MacSalt: salt, Iterations: pkcs12Iterations}
+	return asn1.Marshal(pfx)
+}
+
+func caAlias(i int) string {
+	if i == 0 {
+		return "cacert"
+	}
+	return fmt.Sprintf("cacert%d", i+1)
+}
+
+// jksPassword password as utf-16 big endian bytes
+func jksPassword(password string) []byte {
+	return bmpString(password)
+}
+
+// jksProtectKey protect pkcs8 key as sun's KeyProtector
+func jksProtectKey(pkcs8, password []byte) ([]byte, error) {
+	salt, err := randomBytes(sha1.Size)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := make([]byte, len(pkcs8))
+	digest := salt
+	for i := 0; i < len(pkcs8); i += sha1.Size {
+		sum := sha1.Sum(append(append([]byte{}, password...), digest...))
+		digest = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(pkcs8); j++ {
+			encrypted[i+j] = pkcs8[i+j] ^ digest[j]
+		}
+	}
+	check := sha1.Sum(append(append([]byte{}, password...), pkcs8...))
+	data := append(append(salt, encrypted...), check[:]...)
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: data})
+}
+
+type jksWriter struct {
+	bytes.Buffer
+}
+
+func (w *jksWriter) writeUint32(n uint32) {
+	binary.Write(w, binary.BigEndian, n)
+}
+
+func (w *jksWriter) writeUTF(s string) {
+	binary.Write(w, binary.BigEndian, uint16(len(s)))
+	w.WriteString(s)
+}
+
+func (w *jksWriter) writeCert(cert *x509.Certificate) {
+	w.writeUTF("X.509")
+	w.writeUint32(uint32(len(cert.Raw)))
+	w.Write(cert.Raw)
+}
+
+// EncodeJKS encode key & cert chain to java keystore(jks), caCerts are added as trusted entries
+func EncodeJKS(key crypto.Signer, certs []*x509.Certificate, caCerts []*x509.Certificate,
+	alias, password string) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no cert")
+	}
+	pass := jksPassword(password)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := jksProtectKey(pkcs8, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	now := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	var w jksWriter
+	w.writeUint32(jksMagic)
+	w.writeUint32(2)
+	w.writeUint32(uint32(1 + len(caCerts)))
+
+	w.writeUint32(1)
+	w.writeUTF(alias)
+	binary.Write(&w, binary.BigEndian, now)
+	w.writeUint32(uint32(len(protected)))
+	w.Write(protected)
+	w.writeUint32(uint32(len(certs)))
+	for _, cert := range certs {
+		w.writeCert(cert)
+	}
+	for i, cert := range caCerts {
+		w.writeUint32(2)
+		w.writeUTF(caAlias(i))
+		binary.Write(&w, binary.BigEndian, now)
+		w.writeCert(cert)
+	}
+
+	h := sha1.New()
+	h.Write(pass)
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(w.Bytes())
+	w.Write(h.Sum(nil))
+	return w.Bytes(), nil
+}
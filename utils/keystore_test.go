@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+func newTestKeyCert(t *testing.T) (crypto.Signer, *x509.Certificate) {
+	key, err := NewPrivateKey("P256", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "app"},
+		NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	key, cert := newTestKeyCert(t)
+	data, err := EncodePKCS12(key, []*x509.Certificate{cert}, nil, "app", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pkcs12.Decode(data, "wrong"); err == nil {
+		t.Fatalf("wrong password accepted")
+	}
+	_, decoded, err := pkcs12.Decode(data, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(cert) {
+		t.Errorf("cert mismatch")
+	}
+}
+
+func TestEncodeJKS(t *testing.T) {
+	key, cert := newTestKeyCert(t)
+	data, err := EncodeJKS(key, []*x509.Certificate{cert}, []*x509.Certificate{cert}, "app", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass := jksPassword("secret")
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	sum := sha1.Sum(append(append(append([]byte{}, pass...), "Mighty Aphrodite"...), body...))
+	if !bytes.Equal(sum[:], digest) {
+		t.Fatalf("keystore digest mismatch")
+	}
+	if binary.BigEndian.Uint32(body) != jksMagic || binary.BigEndian.Uint32(body[8:]) != 2 {
+		t.Fatalf("invalid keystore header")
+	}
+
+	// tag, alias, timestamp, protected key
+	offset := 12 + 4 + 2 + len("app") + 8
+	size := int(binary.BigEndian.Uint32(body[offset:]))
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(body[offset+4:offset+4+size], &info); err != nil {
+		t.Fatal(err)
+	}
+	protected := info.EncryptedData
+	salt, encrypted := protected[:sha1.Size], protected[sha1.Size:len(protected)-sha1.Size]
+	plain := make([]byte, len(encrypted))
+	digest = salt
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		s := sha1.Sum(append(append([]byte{}, pass...), digest...))
+		digest = s[:]
+		for j := 0; j < sha1.Size && i+j < len(encrypted); j++ {
+			plain[i+j] = encrypted[i+j] ^ digest[j]
+		}
+	}
+	decoded, err := x509.ParsePKCS8PrivateKey(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.(crypto.Signer).Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public()) {
+		t.Errorf("key mismatch")
+	}
+}
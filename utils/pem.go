@@ -85,6 +85,62 @@ func ReadPEM(path string) (*pem.Block, error) {
 	return block, nil
 }
 
+// ParsePrivateKey parse private key(pkcs1/ec/pkcs8) from pem block
+func ParsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse key(rsa) fail: %v", err)
+		}
+		return privKey, nil
+	case "EC PRIVATE KEY":
+		privKey, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse key(ec) fail: %v", err)
+		}
+		return privKey, nil
+	case "PRIVATE KEY":
+		privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse key(pkcs8) fail: %v", err)
+		}
+		signer, ok := privKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported pkcs8 key: %T", privKey)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", block.Type)
+}
+
+// DecodePrivateKeyFromPem decode private key from pem
+func DecodePrivateKeyFromPem(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("invalid pem key")
+	}
+	return ParsePrivateKey(block)
+}
+
+// DecodeCertificateFromPem decode cert from pem
+func DecodeCertificateFromPem(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("invalid pem cert")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// DecodeCSRFromPem decode certificate request from pem
+func DecodeCSRFromPem(data string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, fmt.Errorf("invalid pem csr")
+	}
+	return x509.ParseCertificateRequest(block.Bytes)
+}
+
 // ReadPEMCertificate read cert from pem
 func ReadPEMCertificate(path string) (*x509.Certificate, error) {
 	block, err := ReadPEM(path)
@@ -101,3 +157,40 @@ func ReadPEMCertificate(path string) (*x509.Certificate, error) {
 	}
 	return cert, nil
 }
+
+// DecodeCertificatesFromPem decode all certs from pem
+func DecodeCertificatesFromPem(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no cert in pem")
+	}
+	return certs, nil
+}
+
+// ReadPEMCertificates read all certs from pem file
+func ReadPEMCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read pem file(%s) fail: %v", path, err)
+	}
+	certs, err := DecodeCertificatesFromPem(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse certs(%s) fail: %v", path, err)
+	}
+	return certs, nil
+}
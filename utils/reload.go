@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/golang/glog"
+)
+
+// RunReloader call reload on changes of notify key, and periodically in case of missed notifications
+func RunReloader(client *clientv3.Client, name, key string, interval time.Duration, reload func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		watchCh := client.Watch(ctx, key)
+	watch:
+		for {
+			select {
+			case resp, ok := <-watchCh:
+				if !ok {
+					break watch
+				}
+				if err := resp.Err(); err != nil {
+					glog.Errorf("watch %s fail: %v", name, err)
+					break watch
+				}
+				if len(resp.Events) == 0 {
+					continue
+				}
+			case <-ticker.C:
+			}
+			if err := reload(); err != nil {
+				glog.Errorf("reload %s fail: %v", name, err)
+			}
+		}
+		cancel()
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,10 @@
+package utils
+
+import "strings"
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escape wildcards of like pattern, used with escape '\\'
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}